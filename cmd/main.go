@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	_ "github.com/franciscosanchezn/gin-pizza-api/docs" // Import generated docs
@@ -28,10 +30,12 @@ const (
 )
 
 var (
-	db              *gorm.DB
-	pizzaService    services.PizzaService
-	pizzaController controllers.PizzaController
-	configuration   *config.Config
+	db                 *gorm.DB
+	pizzaService       services.PizzaService
+	pizzaController    controllers.PizzaController
+	idempotencyService services.IdempotencyService
+	oauthService       *auth.OAuthService
+	configuration      *config.Config
 )
 
 // @title Pizza API
@@ -62,6 +66,18 @@ func main() {
 	// Initialize services and controllers
 	pizzaService = services.NewPizzaService(db)
 	pizzaController = controllers.NewPizzaController(pizzaService)
+	idempotencyService = services.NewIdempotencyService(db, configuration.IdempotencyKeyTTL)
+	go purgeExpiredIdempotencyKeys(time.Hour)
+
+	// Initialize OAuth service
+	oauthService = auth.NewOAuthService(db, auth.Config{
+		Issuer:          configuration.OAuthIssuer,
+		JWTSecret:       configuration.JWTSecret,
+		SigningKey:      loadSigningKey(),
+		AccessTokenTTL:  configuration.AccessTokenTTL,
+		RefreshTokenTTL: configuration.RefreshTokenTTL,
+	})
+	go purgeExpiredOAuthTokens(time.Hour)
 
 	// Initialize Gin router
 	var router *gin.Engine = setupRouter()
@@ -73,6 +89,21 @@ func main() {
 	}
 }
 
+// loadSigningKey loads the private key that seeds an empty signing key ring, or falls back to HS512
+// with the shared secret. Once the ring is seeded, keys are replaced with POST /api/v1/keys:rotate.
+func loadSigningKey() *auth.SigningKey {
+	signingKey := auth.NewHMACSigningKey([]byte(configuration.JWTSecret))
+	if configuration.JWTSigningKeyFile != "" {
+		var err error
+		signingKey, err = auth.LoadSigningKey(configuration.JWTSigningKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load JWT signing key: %v", err)
+		}
+	}
+	log.WithFields(log.Fields{"alg": signingKey.Method.Alg(), "kid": signingKey.ID}).Info("JWT signing key loaded")
+	return signingKey
+}
+
 // checkPanicErr checks if an error occurred and panics if it did
 func checkPanicErr(err error) {
 	if err != nil {
@@ -80,6 +111,34 @@ func checkPanicErr(err error) {
 	}
 }
 
+// purgeExpiredIdempotencyKeys periodically deletes stored responses that can no longer be replayed
+func purgeExpiredIdempotencyKeys(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		purged, err := idempotencyService.PurgeExpired()
+		if err != nil {
+			log.WithError(err).Error("Failed to purge expired idempotency keys")
+			continue
+		}
+		log.Debugf("Purged %d expired idempotency keys", purged)
+	}
+}
+
+// purgeExpiredOAuthTokens periodically deletes stored OAuth tokens whose access and refresh tokens have expired
+func purgeExpiredOAuthTokens(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		purged, err := oauthService.PurgeExpiredTokens()
+		if err != nil {
+			log.WithError(err).Error("Failed to purge expired OAuth tokens")
+			continue
+		}
+		log.Debugf("Purged %d expired OAuth tokens", purged)
+	}
+}
+
 // loadDotenvFile loads environment variables from a .env file
 // If the file is not found, it will log a warning and use system environment variables
 func loadDotenvFile() {
@@ -108,6 +167,7 @@ func loadConfig() *config.Config {
 	log.Info("Loading configuration from environment variables")
 	conf, err := config.LoadConfig()
 	checkPanicErr(err)
+	checkPanicErr(models.SetDefaultCurrency(conf.DefaultCurrency))
 	log.Infof("Configuration loaded: %+v", conf)
 	return conf
 }
@@ -134,18 +194,47 @@ func setupDatabase() *gorm.DB {
 	log.Infof("Database initialized: driver=%s", configuration.DBDriver)
 
 	// Migrate the schema
-	if err := db.AutoMigrate(&models.Pizza{}); err != nil {
+	if err := db.AutoMigrate(&models.Ingredient{}, &models.Pizza{}, &models.PizzaIngredient{}, &models.PizzaVariant{}); err != nil {
 		log.Fatalf("Failed to migrate Pizza schema: %v", err)
 	}
+
+	if err := db.AutoMigrate(&models.Order{}, &models.OrderItem{}); err != nil {
+		log.Fatalf("Failed to migrate Order schema: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.IdempotencyRecord{}); err != nil {
+		log.Fatalf("Failed to migrate idempotency schema: %v", err)
+	}
+
+	// Move ingredients stored in the legacy JSON column into the catalog
+	if err := services.MigrateIngredientCatalog(db); err != nil {
+		log.Fatalf("Failed to migrate ingredient catalog: %v", err)
+	}
+
+	// Convert legacy floating point prices into exact minor units
+	if err := services.MigratePriceToMinorUnits(db); err != nil {
+		log.Fatalf("Failed to migrate prices: %v", err)
+	}
+
 	// Add OAuth models
 	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Pizza{},
 		&models.OAuthClient{},
+		&models.OAuthToken{},
+		&models.RevokedToken{},
+		&models.SigningKeyRecord{},
+		&models.DeviceAuthorization{},
+		&models.LoginFailure{},
 	); err != nil {
 		log.Fatalf("Failed to migrate OAuth schemas: %v", err)
 	}
 
+	// Scopes and grant types were stored comma- or space-separated; token issuance now checks them
+	if err := services.NormalizeClientRegistrations(db); err != nil {
+		log.Fatalf("Failed to normalize OAuth clients: %v", err)
+	}
+
 	// Create only if is empty
 	var count int64
 	db.Model(&models.Pizza{}).Count(&count)
@@ -169,6 +258,7 @@ func bootstrapOAuthClient() {
 	var existing models.OAuthClient
 	if err := db.Where("id = ?", clientID).First(&existing).Error; err == nil {
 		log.WithField("client_id", clientID).Info("Bootstrap OAuth client already exists, skipping")
+		grantBootstrapClientAdminScope(&existing)
 		return
 	}
 
@@ -212,10 +302,11 @@ func bootstrapOAuthClient() {
 	}
 
 	oauthClient := models.OAuthClient{
-		ID:     clientID,
-		Secret: string(hashedSecret),
-		UserID: systemUser.ID,
-		Scopes: "read write",
+		ID:         clientID,
+		Secret:     string(hashedSecret),
+		UserID:     systemUser.ID,
+		Scopes:     "read pizzas:write orders:write ingredients:write clients:admin keys:admin",
+		GrantTypes: models.DefaultClientGrantTypes,
 	}
 
 	if err := db.Create(&oauthClient).Error; err != nil {
@@ -233,6 +324,21 @@ func bootstrapOAuthClient() {
 	log.Warn("IMPORTANT: Save the bootstrap client credentials securely")
 }
 
+// grantBootstrapClientAdminScope adds the clients:admin scope to a bootstrap client created before
+// client management required it, so the client can still manage other clients
+func grantBootstrapClientAdminScope(client *models.OAuthClient) {
+	if client.HasScope(models.ScopeClientsAdmin) {
+		return
+	}
+
+	scopes := strings.Join(append(models.SplitScopes(client.Scopes), models.ScopeClientsAdmin), " ")
+	if err := db.Model(client).Update("scopes", scopes).Error; err != nil {
+		log.WithError(err).Error("Failed to grant clients:admin scope to bootstrap OAuth client")
+		return
+	}
+	log.WithField("client_id", client.ID).Info("✓ Granted clients:admin scope to bootstrap OAuth client")
+}
+
 // seedDatabase seeds the database with initial data
 func seedDatabase() {
 	log.Info("Seeding database with initial data")
@@ -251,7 +357,8 @@ func seedDatabase() {
 		systemUser.ID = existingUser.ID
 		log.Info("System user already exists, using existing ID")
 	} else {
-		// Create new system user
+		// Create new system user, with a password to sign in at /api/v1/oauth/authorize
+		setSeedPassword(&systemUser, "SEED_ADMIN_PASSWORD", "admin-password-123")
 		if err := db.Create(&systemUser).Error; err != nil {
 			log.Errorf("Failed to create system user: %v", err)
 			return
@@ -271,6 +378,7 @@ func seedDatabase() {
 		regularUser.ID = existingRegularUser.ID
 		log.Info("Regular user already exists, using existing ID")
 	} else {
+		setSeedPassword(&regularUser, "SEED_USER_PASSWORD", "user-password-123")
 		if err := db.Create(&regularUser).Error; err != nil {
 			log.Errorf("Failed to create regular user: %v", err)
 			return
@@ -279,21 +387,41 @@ func seedDatabase() {
 	}
 
 	pizzas := []models.Pizza{
-		{Name: "Margherita", Price: 10.99, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Basil"}, CreatedBy: systemUser.ID},
-		{Name: "Pepperoni", Price: 12.99, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Pepperoni"}, CreatedBy: systemUser.ID},
-		{Name: "Vegetarian", Price: 11.99, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Bell Peppers", "Olives"}, CreatedBy: systemUser.ID},
+		{Name: "Margherita", Price: models.Money{Amount: 1099, Currency: models.DefaultCurrency()}, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Basil"}, CreatedBy: systemUser.ID},
+		{Name: "Pepperoni", Price: models.Money{Amount: 1299, Currency: models.DefaultCurrency()}, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Pepperoni"}, CreatedBy: systemUser.ID},
+		{Name: "Vegetarian", Price: models.Money{Amount: 1199, Currency: models.DefaultCurrency()}, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Bell Peppers", "Olives"}, CreatedBy: systemUser.ID},
 	}
+	seedPizzaService := services.NewPizzaService(db)
 	for _, pizza := range pizzas {
-		db.Create(&pizza)
+		if _, err := seedPizzaService.CreatePizza(pizza); err != nil {
+			log.Errorf("Failed to seed pizza %s: %v", pizza.Name, err)
+		}
 	}
 
 	// Create development OAuth clients for local testing
 	createDevOAuthClient(systemUser.ID)
 	createUserOAuthClient(regularUser.ID)
+	createWebOAuthClient(regularUser.ID)
+	createDeviceOAuthClient(regularUser.ID)
 
 	log.Info("Database seeded successfully")
 }
 
+// setSeedPassword sets the password of a seeded user from the environment variable
+// Only development falls back to a well-known password. Elsewhere a user seeded without the
+// variable has no password, so nobody can sign in as them.
+func setSeedPassword(user *models.User, envVar, developmentPassword string) {
+	password := os.Getenv(envVar)
+	if password == "" && configuration.Environment == "development" {
+		password = developmentPassword
+	}
+	if password == "" {
+		log.WithField("email", user.Email).Warnf("%s not set, the seeded user cannot sign in", envVar)
+		return
+	}
+	checkPanicErr(user.SetPassword(password))
+}
+
 // createDevOAuthClient creates a dev-client for local development and testing
 func createDevOAuthClient(userID uint) {
 	clientID := "dev-client"
@@ -314,11 +442,12 @@ func createDevOAuthClient(userID uint) {
 	}
 
 	devClient := models.OAuthClient{
-		ID:     clientID,
-		Secret: string(hashedSecret),
-		Name:   "Development Client",
-		UserID: userID,
-		Scopes: "read write",
+		ID:         clientID,
+		Secret:     string(hashedSecret),
+		Name:       "Development Client",
+		UserID:     userID,
+		Scopes:     "read pizzas:write orders:write ingredients:write clients:admin keys:admin",
+		GrantTypes: models.DefaultClientGrantTypes,
 	}
 
 	if err := db.Create(&devClient).Error; err != nil {
@@ -352,11 +481,12 @@ func createUserOAuthClient(userID uint) {
 	}
 
 	userClient := models.OAuthClient{
-		ID:     clientID,
-		Secret: string(hashedSecret),
-		Name:   "User Test Client",
-		UserID: userID,
-		Scopes: "read write",
+		ID:         clientID,
+		Secret:     string(hashedSecret),
+		Name:       "User Test Client",
+		UserID:     userID,
+		Scopes:     "read pizzas:write orders:write",
+		GrantTypes: models.DefaultClientGrantTypes,
 	}
 
 	if err := db.Create(&userClient).Error; err != nil {
@@ -370,12 +500,82 @@ func createUserOAuthClient(userID uint) {
 	}).Info("✓ User OAuth client created (for testing USER role)")
 }
 
+// createWebOAuthClient creates a web-client that signs users in with the authorization code grant
+func createWebOAuthClient(userID uint) {
+	clientID := "web-client"
+	clientSecret := "web-secret-123"
+
+	var existing models.OAuthClient
+	if err := db.Where("id = ?", clientID).First(&existing).Error; err == nil {
+		log.Info("Web OAuth client already exists")
+		return
+	}
+
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
+	if err != nil {
+		log.WithError(err).Error("Failed to hash web client secret")
+		return
+	}
+
+	webClient := models.OAuthClient{
+		ID:          clientID,
+		Secret:      string(hashedSecret),
+		Name:        "Web Test Client",
+		UserID:      userID,
+		Scopes:      "openid profile email read pizzas:write orders:write",
+		GrantTypes:  "authorization_code refresh_token",
+		RedirectURI: "http://localhost:3000/callback",
+	}
+
+	if err := db.Create(&webClient).Error; err != nil {
+		log.WithError(err).Error("Failed to create web OAuth client")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+		"redirect_uri":  webClient.RedirectURI,
+	}).Info("✓ Web OAuth client created (for testing the authorization code grant)")
+}
+
+// createDeviceOAuthClient creates a device-client that signs users in with the device authorization grant
+func createDeviceOAuthClient(userID uint) {
+	clientID := "device-client"
+
+	var existing models.OAuthClient
+	if err := db.Where("id = ?", clientID).First(&existing).Error; err == nil {
+		log.Info("Device OAuth client already exists")
+		return
+	}
+
+	// Devices cannot keep a secret, so the device client is public and has none
+	deviceClient := models.OAuthClient{
+		ID:         clientID,
+		Name:       "Device Test Client",
+		UserID:     userID,
+		Scopes:     "openid profile email read orders:write",
+		GrantTypes: auth.DeviceCodeGrantType + " refresh_token",
+	}
+
+	if err := db.Create(&deviceClient).Error; err != nil {
+		log.WithError(err).Error("Failed to create device OAuth client")
+		return
+	}
+
+	log.WithField("client_id", clientID).Info("✓ Device OAuth client created (public, for testing the device authorization grant)")
+}
+
 // setupRouter initializes the Gin router and sets up the routes
 // It returns the configured router
 func setupRouter() *gin.Engine {
 	// Initialize Gin router
 	router := gin.Default()
 
+	// Only X-Forwarded-For headers set by the configured proxies are believed, so clients cannot pick
+	// the IP address that, for example, failed sign-ins are counted against
+	checkPanicErr(router.SetTrustedProxies(configuration.TrustedProxies))
+
 	// Define routes
 	setupRoutes(router)
 
@@ -384,53 +584,167 @@ func setupRouter() *gin.Engine {
 
 // setupRoutes defines the routes for the Gin router
 func setupRoutes(router *gin.Engine) {
-	// Initialize OAuth service
-	oauthService := auth.NewOAuthService(db, configuration.JWTSecret)
-
 	// Health check endpoint
 	router.GET("/health", healthCheckHandler)
 
+	// Public keys for verifying tokens offline
+	router.GET("/.well-known/jwks.json", oauthService.HandleJWKS)
+
 	// Pizza routes
 	v1 := router.Group("/api/v1")
 	{
+		// Initialize ingredient catalog controller
+		ingredientService := services.NewIngredientService(db)
+		ingredientController := controllers.NewIngredientController(ingredientService)
+
+		// Initialize pizza variant controller
+		variantService := services.NewPizzaVariantService(db)
+		variantController := controllers.NewPizzaVariantController(pizzaService, variantService)
+
+		// Initialize order controller
+		orderService := services.NewOrderService(db)
+		orderController := controllers.NewOrderController(orderService)
+
 		publicApi := v1.Group("/public")
 		{
-			publicApi.GET("/pizzas", pizzaController.GetAllPizzas)
-			publicApi.GET("/pizzas/:id", pizzaController.GetPizzaByID)
+			cacheControl := middleware.CacheControl(configuration.PublicCacheControl)
+			publicApi.GET("/pizzas", cacheControl, pizzaController.GetAllPizzas)
+			publicApi.GET("/pizzas/:id", cacheControl, pizzaController.GetPizzaByID)
+			publicApi.GET("/pizzas/:id/variants", variantController.GetVariants)
+			publicApi.GET("/pizzas/:id/variants/:variant_id", variantController.GetVariant)
+			publicApi.GET("/ingredients", ingredientController.GetAllIngredients)
+			publicApi.GET("/ingredients/:id", ingredientController.GetIngredientByID)
 		}
 
 		// Initialize client controller
 		clientService := services.NewClientService(db)
 		clientController := controllers.NewClientController(clientService)
 
+		// Bearer token authentication that also rejects revoked tokens
+		authenticate := middleware.OAuth2Auth(oauthService.KeyRing(), oauthService.Denylist())
+
+		// Retried mutations with an Idempotency-Key replay the first response
+		idempotent := middleware.Idempotency(idempotencyService)
+
+		// Mutations require a write scope for the resource; the legacy "write" scope grants all of them
+		writePizzas := middleware.RequireScope(models.ScopePizzasWrite, models.ScopeLegacyWrite)
+		writeOrders := middleware.RequireScope(models.ScopeOrdersWrite, models.ScopeLegacyWrite)
+		writeIngredients := middleware.RequireScope(models.ScopeIngredientsWrite, models.ScopeLegacyWrite)
+
 		// OAuth2 routes remain separate
 		oauthRoutes := v1.Group("/oauth")
 		{
+			oauthRoutes.GET("/authorize", oauthService.HandleAuthorize)
+			oauthRoutes.POST("/authorize", oauthService.HandleAuthorize)
 			oauthRoutes.POST("/token", oauthService.HandleToken)
+			oauthRoutes.POST("/device_authorization", oauthService.HandleDeviceAuthorization)
+			oauthRoutes.GET("/device", oauthService.HandleDeviceVerification)
+			oauthRoutes.POST("/device", oauthService.HandleDeviceVerification)
+			oauthRoutes.POST("/revoke", oauthService.HandleRevoke)
+			oauthRoutes.POST("/introspect", oauthService.HandleIntrospect)
+
+			// OpenID Connect claims about the signed in user
+			userinfo := []gin.HandlerFunc{authenticate, middleware.RequireScope(models.ScopeOpenID), oauthService.HandleUserInfo}
+			oauthRoutes.GET("/userinfo", userinfo...)
+			oauthRoutes.POST("/userinfo", userinfo...)
 		}
 
 		// Pizza CRUD - requires authentication, ownership enforced in controller
 		pizzaApi := v1.Group("/pizzas")
-		pizzaApi.Use(middleware.OAuth2Auth([]byte(configuration.JWTSecret)))
+		pizzaApi.Use(authenticate)
+		{
+			pizzaApi.GET("", pizzaController.GetAllPizzas)
+			pizzaApi.GET("/export", pizzaController.ExportPizzas)
+		}
+		pizzaWrites := pizzaApi.Group("")
+		pizzaWrites.Use(writePizzas)
+		pizzaWrites.Use(idempotent)
+		{
+			pizzaWrites.POST("", pizzaController.CreatePizza)
+			pizzaWrites.POST("/import", pizzaController.ImportPizzas)
+			pizzaWrites.PUT("/:id", pizzaController.UpdatePizza)
+			pizzaWrites.PATCH("/:id", pizzaController.PatchPizza)
+			pizzaWrites.DELETE("/:id", pizzaController.DeletePizza)
+			pizzaWrites.POST("/:id/restore", pizzaController.RestorePizza)
+			pizzaWrites.DELETE("/:id/purge", pizzaController.PurgePizza)
+			pizzaWrites.POST("/:id/variants", variantController.CreateVariant)
+			pizzaWrites.PUT("/:id/variants/:variant_id", variantController.UpdateVariant)
+			pizzaWrites.DELETE("/:id/variants/:variant_id", variantController.DeleteVariant)
+		}
+
+		// Custom methods on the pizza collection, e.g. POST /api/v1/pizzas:batch
+		pizzaMethods := v1.Group("")
+		pizzaMethods.Use(authenticate)
+		pizzaMethods.Use(writePizzas)
+		pizzaMethods.Use(idempotent)
 		{
-			pizzaApi.POST("", pizzaController.CreatePizza)
-			pizzaApi.PUT("/:id", pizzaController.UpdatePizza)
-			pizzaApi.DELETE("/:id", pizzaController.DeletePizza)
+			pizzaMethods.POST("/pizzas:method", controllers.CustomMethods(map[string]gin.HandlerFunc{
+				"batch": pizzaController.BatchPizzas,
+			}))
 		}
 
-		// OAuth client management - admin only
+		// Orders - requires authentication, customers only see their own orders
+		orderApi := v1.Group("/orders")
+		orderApi.Use(authenticate)
+		{
+			orderApi.GET("", orderController.GetOrders)
+			orderApi.GET("/:id", orderController.GetOrderByID)
+		}
+		orderWrites := orderApi.Group("")
+		orderWrites.Use(writeOrders)
+		orderWrites.Use(idempotent)
+		{
+			orderWrites.POST("", orderController.CreateOrder)
+			orderWrites.POST("/:id/confirm", orderController.ConfirmOrder)
+			orderWrites.POST("/:id/bake", orderController.StartBakingOrder)
+			orderWrites.POST("/:id/ready", orderController.MarkOrderReady)
+			orderWrites.POST("/:id/deliver", orderController.DeliverOrder)
+			orderWrites.POST("/:id/cancel", orderController.CancelOrder)
+		}
+
+		// Ingredient catalog management - admin only
+		ingredientApi := v1.Group("/ingredients")
+		ingredientApi.Use(authenticate)
+		ingredientApi.Use(writeIngredients)
+		ingredientApi.Use(middleware.RequireRole("admin"))
+		ingredientApi.Use(idempotent)
+		{
+			ingredientApi.POST("", ingredientController.CreateIngredient)
+			ingredientApi.PUT("/:id", ingredientController.UpdateIngredient)
+			ingredientApi.DELETE("/:id", ingredientController.DeleteIngredient)
+		}
+
+		// OAuth client management - admin only, and the token needs the clients:admin scope
 		clientApi := v1.Group("/clients")
-		clientApi.Use(middleware.OAuth2Auth([]byte(configuration.JWTSecret)))
+		clientApi.Use(authenticate)
+		clientApi.Use(middleware.RequireScope(models.ScopeClientsAdmin))
 		clientApi.Use(middleware.RequireRole("admin"))
+		clientApi.Use(idempotent)
 		{
 			clientApi.POST("", clientController.CreateClient)
 			clientApi.GET("", clientController.ListClients)
 			clientApi.DELETE("/:id", clientController.DeleteClient)
 		}
+
+		// Signing key rotation - admin only, and the token needs the keys:admin scope
+		keyApi := v1.Group("")
+		keyApi.Use(authenticate)
+		keyApi.Use(middleware.RequireScope(models.ScopeKeysAdmin))
+		keyApi.Use(middleware.RequireRole("admin"))
+		{
+			keyApi.GET("/keys", oauthService.HandleListSigningKeys)
+			keyApi.POST("/keys:method", controllers.CustomMethods(map[string]gin.HandlerFunc{
+				"rotate": oauthService.HandleRotateSigningKey,
+			}))
+		}
 	}
 
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	// Discovery documents listing the OAuth endpoints registered above (RFC 8414, OpenID Connect Discovery)
+	router.GET("/.well-known/oauth-authorization-server", oauthService.HandleMetadata(router.Routes()))
+	router.GET("/.well-known/openid-configuration", oauthService.HandleOpenIDConfiguration(router.Routes()))
 }
 
 // HealthResponse represents the health check response
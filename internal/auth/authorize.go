@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/server"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// s256ChallengeLength is the length of a base64url encoded SHA-256 code challenge (RFC 7636)
+const s256ChallengeLength = 43
+
+// authorizeRequest holds the parameters of an authorization request
+// The login form posts them back as hidden fields.
+type authorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is returned in the ID token when the openid scope is requested
+	Nonce string
+}
+
+// authorizePageData is rendered by authorizePage
+type authorizePageData struct {
+	ClientName string
+	Scopes     []string
+	Request    authorizeRequest
+	Email      string
+	Error      string
+}
+
+// pageStyle is shared by the pages users sign in on
+const pageStyle = `<style>
+body { font-family: sans-serif; max-width: 24rem; margin: 3rem auto; padding: 0 1rem; color: #222; }
+label, input { display: block; width: 100%; box-sizing: border-box; }
+input { margin: 0.25rem 0 1rem; padding: 0.5rem; }
+.error { color: #b00020; }
+button { padding: 0.5rem 1rem; margin-right: 0.5rem; }
+</style>
+`
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in - Pizza API</title>
+` + pageStyle + `</head>
+<body>
+{{if .ClientName}}
+<h1>Sign in to {{.ClientName}}</h1>
+<p>{{.ClientName}} is asking for access to your account with these scopes:</p>
+<ul>{{range .Scopes}}<li><code>{{.}}</code></li>{{end}}</ul>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{.Email}}" autocomplete="username" required>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password">
+<button type="submit" name="action" value="approve">Sign in and allow</button>
+<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</form>
+{{else}}
+<h1>Authorization failed</h1>
+<p class="error">{{.Error}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+// dummyPasswordHash is compared against when no user matches the email, so a failed login takes
+// as long whether or not the account exists
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("no such user"), bcrypt.DefaultCost)
+	return hash
+})
+
+// HandleAuthorize handles the authorization endpoint of the authorization code grant (RFC 6749 section 4.1)
+// GET shows a login and consent page; POST signs the user in and redirects back to the client with a code.
+// @Summary Authorization Endpoint
+// @Description Sign a user in and ask for consent, then redirect to the client's registered redirect_uri with an
+// @Description authorization code to redeem at the token endpoint. PKCE with code_challenge_method=S256 is required.
+// @Tags OAuth2
+// @Accept application/x-www-form-urlencoded
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "Must equal the redirect URI registered for the client"
+// @Param scope query string false "Requested scopes, space-separated; defaults to every scope the client is registered for"
+// @Param state query string false "Opaque value returned to the client unchanged"
+// @Param code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param code_challenge_method query string true "Must be S256"
+// @Param nonce query string false "With the openid scope, returned in the ID token"
+// @Success 200 {string} string "Login and consent page"
+// @Success 302 "Redirect to the client with code and state, or with error"
+// @Failure 400 {string} string "Unknown client or redirect_uri mismatch"
+// @Failure 401 {string} string "Wrong email or password"
+// @Failure 429 {string} string "Too many failed sign-ins for the account or the client IP address"
+// @Router /oauth/authorize [get]
+// @Router /oauth/authorize [post]
+func (o *OAuthService) HandleAuthorize(c *gin.Context) {
+	setPageHeaders(c)
+
+	req := authorizeRequest{
+		ClientID:            c.Request.FormValue("client_id"),
+		RedirectURI:         c.Request.FormValue("redirect_uri"),
+		ResponseType:        c.Request.FormValue("response_type"),
+		Scope:               internalmodels.NormalizeScopes(c.Request.FormValue("scope")),
+		State:               c.Request.FormValue("state"),
+		CodeChallenge:       c.Request.FormValue("code_challenge"),
+		CodeChallengeMethod: c.Request.FormValue("code_challenge_method"),
+		Nonce:               c.Request.FormValue("nonce"),
+	}
+
+	// Until the redirect URI is known to belong to the client, errors are shown instead of redirected
+	client, err := o.registeredClient(c, req.ClientID)
+	if err != nil {
+		renderPage(c, authorizePage, http.StatusBadRequest, authorizePageData{Error: "Unknown client."})
+		return
+	}
+	if !validRedirectURI(client.RedirectURI) || (req.RedirectURI != "" && req.RedirectURI != client.RedirectURI) {
+		renderPage(c, authorizePage, http.StatusBadRequest, authorizePageData{Error: "The redirect_uri is not registered for this client."})
+		return
+	}
+	req.RedirectURI = client.RedirectURI
+
+	if code, description := checkAuthorizeRequest(req, client); code != "" {
+		redirectTo(c, req.RedirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {req.State}})
+		return
+	}
+	scope, ok, err := o.grantableScope(req.Scope, client.Scopes)
+	if err != nil {
+		log.WithError(err).WithField("client_id", client.ID).Error("Failed to check requested scope")
+		redirectTo(c, req.RedirectURI, url.Values{"error": {"server_error"}, "state": {req.State}})
+		return
+	}
+	if !ok {
+		redirectTo(c, req.RedirectURI, url.Values{"error": {"invalid_scope"}, "error_description": {invalidScopeDescription(req.Scope, client.Scopes)}, "state": {req.State}})
+		return
+	}
+	req.Scope = scope
+
+	page := authorizePageData{ClientName: client.Name, Scopes: internalmodels.SplitScopes(scope), Request: req}
+	if page.ClientName == "" {
+		page.ClientName = client.ID
+	}
+	if c.Request.Method != http.MethodPost {
+		renderPage(c, authorizePage, http.StatusOK, page)
+		return
+	}
+
+	if c.PostForm("action") != "approve" {
+		redirectTo(c, req.RedirectURI, url.Values{"error": {"access_denied"}, "error_description": {"The user denied the request"}, "state": {req.State}})
+		return
+	}
+
+	page.Email = strings.TrimSpace(c.PostForm("email"))
+	user, err := o.signIn(c, page.Email, c.PostForm("password"))
+	if err != nil {
+		status, message := signInFailure(c, err)
+		page.Error = message
+		renderPage(c, authorizePage, status, page)
+		return
+	}
+
+	// clientAuthorized and clientScope check the request against the client registration again,
+	// and extractNonce stores the nonce with the code
+	ti, err := o.server.GetAuthorizeToken(c, &server.AuthorizeRequest{
+		ResponseType:        oauth2.Code,
+		ClientID:            client.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		UserID:              fmt.Sprint(user.ID),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: oauth2.CodeChallengeS256,
+		Request:             c.Request,
+	})
+	if err != nil {
+		log.WithError(err).WithField("client_id", client.ID).Error("Failed to issue authorization code")
+		redirectTo(c, req.RedirectURI, url.Values{"error": {"server_error"}, "state": {req.State}})
+		return
+	}
+
+	log.WithFields(log.Fields{"client_id": client.ID, "user_id": user.ID}).Info("User authorized client")
+	redirectTo(c, req.RedirectURI, url.Values{"code": {ti.GetCode()}, "state": {req.State}})
+}
+
+// checkAuthorizeRequest validates an authorization request of a known client and redirect URI
+// It returns the OAuth error code and description to redirect with, or empty strings
+func checkAuthorizeRequest(req authorizeRequest, client *internalmodels.OAuthClient) (string, string) {
+	switch {
+	case req.ResponseType != string(oauth2.Code):
+		return "unsupported_response_type", "response_type must be code"
+	case !client.AllowsGrantType(string(oauth2.AuthorizationCode)):
+		return "unauthorized_client", "Client is not registered for the authorization_code grant"
+	case req.CodeChallengeMethod != string(oauth2.CodeChallengeS256) || len(req.CodeChallenge) != s256ChallengeLength:
+		return "invalid_request", "PKCE is required: send a code_challenge with code_challenge_method=S256"
+	}
+	return "", ""
+}
+
+// errInvalidCredentials is returned by authenticateUser for an unknown email or a wrong password
+var errInvalidCredentials = errors.New("invalid email or password")
+
+// authenticateUser checks the email and password of a user
+func (o *OAuthService) authenticateUser(email, password string) (*internalmodels.User, error) {
+	var user internalmodels.User
+	err := o.db.Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.CheckPassword(password) {
+		return nil, errInvalidCredentials
+	}
+	return &user, nil
+}
+
+// setPageHeaders keeps a sign-in page out of caches and frames, which would let another site
+// trick users into approving
+func setPageHeaders(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+}
+
+func renderPage(c *gin.Context, page *template.Template, status int, data interface{}) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(c.Writer, data); err != nil {
+		log.WithError(err).WithField("page", page.Name()).Error("Failed to render page")
+	}
+}
+
+// validRedirectURI reports whether a registered redirect URI is an absolute URI without a fragment
+func validRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	return err == nil && u.Scheme != "" && u.Fragment == ""
+}
+
+// redirectTo redirects to the client's redirect URI with the parameters added to its query
+func redirectTo(c *gin.Context, redirectURI string, params url.Values) {
+	u, _ := url.Parse(redirectURI) // Checked by validRedirectURI
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, u.String())
+}
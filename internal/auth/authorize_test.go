@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/middleware"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testRedirectURI  = "https://app.example/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	user := &models.User{Email: "alice@example.com", Name: "Alice", Role: "user"}
+	require.NoError(t, user.SetPassword("correct horse battery"))
+	require.NoError(t, db.Create(user).Error)
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte("web_secret"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID:          "web",
+		Secret:      string(hashedSecret),
+		Name:        "Pizza Web",
+		Scopes:      "read orders:write",
+		GrantTypes:  "authorization_code refresh_token",
+		RedirectURI: testRedirectURI,
+	}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "machine", Secret: string(hashedSecret), Scopes: "read", GrantTypes: "client_credentials", RedirectURI: testRedirectURI,
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/oauth/authorize", oauthService.HandleAuthorize)
+	router.POST("/oauth/authorize", oauthService.HandleAuthorize)
+	router.POST("/oauth/token", oauthService.HandleToken)
+
+	authorizeParams := func(overrides map[string]string) url.Values {
+		params := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {"web"},
+			"redirect_uri":          {testRedirectURI},
+			"scope":                 {"read"},
+			"state":                 {"xyz"},
+			"code_challenge":        {codeChallenge(testCodeVerifier)},
+			"code_challenge_method": {"S256"},
+		}
+		for key, value := range overrides {
+			params.Set(key, value)
+		}
+		return params
+	}
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/oauth/authorize?"+params.Encode(), nil))
+		return w
+	}
+	post := func(path string, params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	redirectQuery := func(w *httptest.ResponseRecorder) url.Values {
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, testRedirectURI, location.Scheme+"://"+location.Host+location.Path)
+		return location.Query()
+	}
+	login := func(password string) url.Values {
+		params := authorizeParams(map[string]string{"email": "Alice@example.com", "password": password, "action": "approve"})
+		return redirectQuery(post("/oauth/authorize", params))
+	}
+	redeem := func(code, verifier string) *httptest.ResponseRecorder {
+		return post("/oauth/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"web"},
+			"client_secret": {"web_secret"},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"code_verifier": {verifier},
+		})
+	}
+
+	// The login and consent page names the client and the scopes, and cannot be framed
+	w := get(authorizeParams(nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Pizza Web")
+	assert.Contains(t, w.Body.String(), "<code>read</code>")
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+
+	// Unknown clients and unregistered redirect URIs are never redirected to
+	for _, overrides := range []map[string]string{{"client_id": "nobody"}, {"redirect_uri": "https://evil.example/callback"}} {
+		w = get(authorizeParams(overrides))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+	}
+
+	// Other invalid requests are reported to the client
+	testCases := []struct {
+		overrides map[string]string
+		error     string
+	}{
+		{map[string]string{"code_challenge": ""}, "invalid_request"},
+		{map[string]string{"code_challenge_method": "plain", "code_challenge": testCodeVerifier}, "invalid_request"},
+		{map[string]string{"response_type": "token"}, "unsupported_response_type"},
+		{map[string]string{"scope": "read clients:admin"}, "invalid_scope"},
+		{map[string]string{"client_id": "machine"}, "unauthorized_client"},
+	}
+	for _, tt := range testCases {
+		query := redirectQuery(get(authorizeParams(tt.overrides)))
+		assert.Equal(t, tt.error, query.Get("error"), tt.overrides)
+		assert.Equal(t, "xyz", query.Get("state"))
+	}
+
+	w = post("/oauth/authorize", authorizeParams(map[string]string{"email": "alice@example.com", "password": "wrong password", "action": "approve"}))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid email or password")
+	assert.Equal(t, "access_denied", redirectQuery(post("/oauth/authorize", authorizeParams(map[string]string{"action": "deny"}))).Get("error"))
+
+	// The code is redeemed once, with the code_verifier, for a token of the signed in user
+	query := login("correct horse battery")
+	assert.Equal(t, "xyz", query.Get("state"))
+	code := query.Get("code")
+	require.NotEmpty(t, code)
+
+	w = redeem(code, testCodeVerifier)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var token map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	assert.Equal(t, "read", token["scope"])
+	assert.NotEmpty(t, token["refresh_token"])
+	claims, err := middleware.ParseAndValidateJWT(token["access_token"].(string), oauthService.KeyRing())
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(user.ID), claims["uid"])
+	assert.Equal(t, "user", claims["role"])
+	assert.Equal(t, "web", claims["aud"])
+
+	w = redeem(code, testCodeVerifier)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_grant")
+
+	// A wrong code_verifier burns the code
+	code = login("correct horse battery").Get("code")
+	w = redeem(code, "a-different-code-verifier-of-sufficient-length-00")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_grant")
+	w = redeem(code, testCodeVerifier)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
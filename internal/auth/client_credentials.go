@@ -1,43 +1,71 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
 	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	oauth2errors "github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
-// HandleToken handles the token endpoint for both client credentials and authorization code grants
+// HandleToken handles the token endpoint for the client credentials, authorization code and device code grants
 // @Summary Token Endpoint
-// @Description Obtain an access token using client credentials or authorization code grant
+// @Description Obtain an access token using client credentials, an authorization code or a device code, or exchange a refresh token for a new token pair.
+// @Description While the user has not approved a device code the response is authorization_pending, or slow_down when polled faster than the interval.
+// @Description Refresh tokens are single-use: presenting one twice revokes every token rotated from the same grant.
 // @Tags OAuth2
 // @Accept application/x-www-form-urlencoded
 // @Produce json
-// @Param grant_type formData string true "Grant type: client_credentials or authorization_code"
+// @Param grant_type formData string true "Grant type: client_credentials, authorization_code, refresh_token or urn:ietf:params:oauth:grant-type:device_code"
 // @Param client_id formData string true "Client ID"
-// @Param client_secret formData string true "Client Secret"
+// @Param client_secret formData string false "Client Secret (not sent by public clients for the device_code and refresh_token grants)"
 // @Param code formData string false "Authorization code (required for authorization_code grant)"
 // @Param redirect_uri formData string false "Redirect URI (required for authorization_code grant)"
+// @Param code_verifier formData string false "PKCE code verifier (required for authorization_code grant)"
+// @Param device_code formData string false "Device code (required for the device_code grant)"
+// @Param refresh_token formData string false "Refresh token (required for refresh_token grant)"
+// @Param scope formData string false "Requested scopes, space-separated; defaults to every scope the client is registered for, and a refresh may only narrow the original scope"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
 // @Router /oauth/token [post]
 func (o *OAuthService) HandleToken(c *gin.Context) {
-	grantType := c.PostForm("grant_type")
-
-	if grantType != "client_credentials" {
+	handler, ok := o.grantHandlers()[c.PostForm("grant_type")]
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
 		return
 	}
+	handler(c)
+}
 
-	o.handleClientCredentials(c)
+// grantHandlers maps each grant type accepted at the token endpoint to its handler
+// The discovery document lists these grant types, so a new grant only needs to be added here.
+func (o *OAuthService) grantHandlers() map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"authorization_code": o.handleServerGrant,
+		"client_credentials": o.handleServerGrant,
+		"refresh_token":      o.handleRefreshToken,
+		DeviceCodeGrantType:  o.handleDeviceCode,
+	}
 }
 
-func (o *OAuthService) handleClientCredentials(c *gin.Context) {
+// handleServerGrant issues tokens for the client_credentials and authorization_code grants
+func (o *OAuthService) handleServerGrant(c *gin.Context) {
 	// Let the OAuth2 library handle the entire flow
 	// It will:
 	// 1. Get the client from the store
 	// 2. Verify the client secret using VerifyPassword
-	// 3. Generate the token
+	// 3. For authorization codes, redeem the code once and check the PKCE code_verifier
+	// 4. Generate the token
 	gt, tgr, err := o.server.ValidationTokenRequest(c.Request)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -47,14 +75,278 @@ func (o *OAuthService) handleClientCredentials(c *gin.Context) {
 		return
 	}
 
+	// clientAuthorized and clientScope check the request against the client registration
 	ti, err := o.server.GetAccessToken(c, gt, tgr)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":             "server_error",
-			"error_description": err.Error(),
+		switch {
+		case errors.Is(err, oauth2errors.ErrInvalidClient):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":             "invalid_client",
+				"error_description": "Client authentication failed",
+			})
+		case errors.Is(err, oauth2errors.ErrUnauthorizedClient):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "unauthorized_client",
+				"error_description": "Client is not registered for the " + gt.String() + " grant",
+			})
+		case errors.Is(err, oauth2errors.ErrInvalidGrant), errors.Is(err, oauth2errors.ErrMissingCodeVerifier):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_grant",
+				"error_description": "Authorization code is invalid, expired, already used, or does not match the redirect_uri or code_verifier",
+			})
+		case errors.Is(err, oauth2errors.ErrInvalidScope):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_scope",
+				"error_description": "Requested scope exceeds the scopes the client is registered for",
+			})
+		default:
+			log.WithError(err).WithField("client_id", tgr.ClientID).Error("Failed to issue token")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		}
+		return
+	}
+
+	o.respondWithToken(c, ti)
+}
+
+// handleRefreshToken exchanges a refresh token for a new access token and refresh token (RFC 6749 section 6)
+// The client must be the one the refresh token was issued to, and authenticate unless it is public
+func (o *OAuthService) handleRefreshToken(c *gin.Context) {
+	client, ok := o.identifyClient(c)
+	if !ok {
+		return
+	}
+
+	refresh := c.PostForm("refresh_token")
+	requestedScope := internalmodels.NormalizeScopes(c.PostForm("scope"))
+	if refresh == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "refresh_token is required",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, o.server.GetTokenData(ti))
+	ti, err := o.tokenStore.RotateRefresh(c, refresh, func(current oauth2.TokenInfo) (oauth2.TokenInfo, error) {
+		if current.GetClientID() != client.GetID() {
+			return nil, oauth2errors.ErrInvalidGrant
+		}
+		if requestedScope != "" && !scopeWithin(requestedScope, current.GetScope()) {
+			return nil, oauth2errors.ErrInvalidScope
+		}
+		return o.issueRefreshedToken(c, client, current, requestedScope)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRefreshTokenReused):
+			log.WithField("client_id", client.GetID()).Warn("Refresh token reused; revoked its token family")
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_grant",
+				"error_description": "Refresh token was already used",
+			})
+		case errors.Is(err, oauth2errors.ErrInvalidRefreshToken), errors.Is(err, oauth2errors.ErrInvalidGrant):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_grant",
+				"error_description": "Refresh token is invalid, expired or was issued to another client",
+			})
+		case errors.Is(err, oauth2errors.ErrInvalidScope):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_scope",
+				"error_description": "Requested scope exceeds the scope originally granted",
+			})
+		default:
+			log.WithError(err).WithField("client_id", client.GetID()).Error("Failed to refresh token")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		}
+		return
+	}
+
+	o.respondWithToken(c, ti)
+}
+
+// respondWithToken answers the token request with the issued token and, for OpenID Connect, an ID token
+func (o *OAuthService) respondWithToken(c *gin.Context, ti oauth2.TokenInfo) {
+	response, err := o.tokenResponse(c, ti)
+	if err != nil {
+		log.WithError(err).WithField("client_id", ti.GetClientID()).Error("Failed to issue ID token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// issueRefreshedToken mints the access and refresh tokens that replace the current ones
+func (o *OAuthService) issueRefreshedToken(c *gin.Context, client oauth2.ClientInfo, current oauth2.TokenInfo, scope string) (oauth2.TokenInfo, error) {
+	if scope == "" {
+		scope = current.GetScope()
+	}
+	return o.newToken(c, client, current.GetUserID(), current.GetRedirectURI(), scope)
+}
+
+// newToken mints an access token and refresh token for the user of a client, without storing them
+func (o *OAuthService) newToken(c *gin.Context, client oauth2.ClientInfo, userID, redirectURI, scope string) (oauth2.TokenInfo, error) {
+	now := time.Now()
+	next := models.NewToken()
+	next.SetClientID(client.GetID())
+	next.SetUserID(userID)
+	next.SetRedirectURI(redirectURI)
+	next.SetScope(scope)
+	next.SetAccessCreateAt(now)
+	next.SetAccessExpiresIn(o.config.AccessTokenTTL)
+	next.SetRefreshCreateAt(now)
+	next.SetRefreshExpiresIn(o.config.RefreshTokenTTL)
+
+	access, refresh, err := o.generator.Token(c, &oauth2.GenerateBasic{
+		Client:    client,
+		UserID:    userID,
+		CreateAt:  now,
+		TokenInfo: next,
+		Request:   c.Request,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	next.SetAccess(access)
+	next.SetRefresh(refresh)
+	return next, nil
+}
+
+// authenticateClient verifies the client_id and client_secret of a confidential client
+// It responds with invalid_client and returns false when authentication fails
+func (o *OAuthService) authenticateClient(c *gin.Context) (oauth2.ClientInfo, bool) {
+	client, err := o.clientFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":             "invalid_client",
+			"error_description": "Client authentication failed",
+		})
+		return nil, false
+	}
+	return client, true
+}
+
+// identifyClient authenticates a confidential client like authenticateClient, and identifies a public
+// client, which is registered without a secret because it runs on the user's device, by its client_id
+// alone (RFC 6749 section 2.1). Only grants whose codes and tokens are bound to the client may use it.
+func (o *OAuthService) identifyClient(c *gin.Context) (oauth2.ClientInfo, bool) {
+	if c.Request.ParseForm() == nil && c.Request.Form.Get("client_secret") == "" {
+		if clientID, _, err := o.server.ClientInfoHandler(c.Request); err == nil {
+			if client, err := o.clientStore.GetByID(c, clientID); err == nil && client.IsPublic() {
+				return client, true
+			}
+		}
+	}
+	return o.authenticateClient(c)
+}
+
+// clientFromRequest loads the client identified by the request and checks its secret
+func (o *OAuthService) clientFromRequest(c *gin.Context) (oauth2.ClientInfo, error) {
+	if err := c.Request.ParseForm(); err != nil {
+		return nil, err
+	}
+	clientID, clientSecret, err := o.server.ClientInfoHandler(c.Request)
+	if err != nil {
+		return nil, err
+	}
+	client, err := o.clientStore.GetByID(c, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyClientSecret(client, clientSecret) {
+		return nil, oauth2errors.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// verifyClientSecret checks the secret presented by a confidential client
+func verifyClientSecret(client oauth2.ClientInfo, secret string) bool {
+	verifier, ok := client.(oauth2.ClientPasswordVerifier)
+	return ok && secret != "" && verifier.VerifyPassword(secret)
+}
+
+// clientAuthorized reports whether the client is registered for the grant type
+func (o *OAuthService) clientAuthorized(clientID string, grant oauth2.GrantType) (bool, error) {
+	client, err := o.registeredClient(context.Background(), clientID)
+	if err != nil {
+		return false, err
+	}
+	return client.AllowsGrantType(string(grant)), nil
+}
+
+// clientScope checks the requested scope against the scopes the client is registered for
+// An omitted scope defaults to all of them, and the granted scope is always space-separated
+func (o *OAuthService) clientScope(tgr *oauth2.TokenGenerateRequest) (bool, error) {
+	ctx := context.Background()
+	if tgr.Request != nil {
+		ctx = tgr.Request.Context()
+	}
+	client, err := o.registeredClient(ctx, tgr.ClientID)
+	if err != nil {
+		return false, err
+	}
+	scope, ok, err := o.grantableScope(tgr.Scope, client.Scopes)
+	if err != nil || !ok {
+		return false, err
+	}
+	tgr.Scope = scope
+	return true, nil
+}
+
+// grantableScope returns the scope to grant a client for the requested scope, space-separated
+// An omitted scope defaults to every scope the client is registered for. While ID tokens cannot be
+// issued, see openIDAvailable, openid is left out of that default and refused when requested.
+func (o *OAuthService) grantableScope(requested, registered string) (string, bool, error) {
+	openID, err := o.openIDAvailable()
+	if err != nil {
+		return "", false, err
+	}
+	if requested == "" {
+		var scopes []string
+		for _, scope := range internalmodels.SplitScopes(registered) {
+			if openID || scope != internalmodels.ScopeOpenID {
+				scopes = append(scopes, scope)
+			}
+		}
+		return strings.Join(scopes, " "), true, nil
+	}
+	if !scopeWithin(requested, registered) || (!openID && scopeWithin(internalmodels.ScopeOpenID, requested)) {
+		return "", false, nil
+	}
+	return internalmodels.NormalizeScopes(requested), true, nil
+}
+
+// invalidScopeDescription explains why grantableScope refused the requested scope
+func invalidScopeDescription(requested, registered string) string {
+	if scopeWithin(requested, registered) {
+		return "The openid scope is unavailable: ID tokens require an asymmetric signing key"
+	}
+	return "Requested scope exceeds the scopes the client is registered for"
+}
+
+// registeredClient loads the registration of a client, reporting unknown clients as invalid_client
+func (o *OAuthService) registeredClient(ctx context.Context, clientID string) (*internalmodels.OAuthClient, error) {
+	var client internalmodels.OAuthClient
+	err := o.db.WithContext(ctx).Where("id = ?", clientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, oauth2errors.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// scopeWithin reports whether every scope in requested is part of granted
+// Scopes may be separated by spaces or commas
+func scopeWithin(requested, granted string) bool {
+	allowed := make(map[string]bool)
+	for _, scope := range internalmodels.SplitScopes(granted) {
+		allowed[scope] = true
+	}
+	for _, scope := range internalmodels.SplitScopes(requested) {
+		if !allowed[scope] {
+			return false
+		}
+	}
+	return true
 }
@@ -3,6 +3,7 @@ package auth
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -18,7 +19,7 @@ func TestClientCredentialsFlow(t *testing.T) {
 	db := setupTestDB(t)
 
 	// Provide JWT secret parameter
-	oauthService := NewOAuthService(db, "test-jwt-secret-key-32-characters")
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
 	require.NotNil(t, oauthService)
 
 	// Create a test user first (required for token generation)
@@ -37,7 +38,7 @@ func TestClientCredentialsFlow(t *testing.T) {
 		ID:         "test_client_id",
 		Secret:     string(hashedSecret), // bcrypt hash stored in database
 		Domain:     "http://localhost:8080",
-		Scopes:     "read,write",
+		Scopes:     "read write",
 		UserID:     testUser.ID, // Associate client with user
 		GrantTypes: "client_credentials",
 	}
@@ -83,7 +84,7 @@ func TestClientCredentialsFlow(t *testing.T) {
 
 func TestClientCredentialsInvalidSecret(t *testing.T) {
 	db := setupTestDB(t)
-	oauthService := NewOAuthService(db, "test-jwt-secret-key-32-characters")
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
 	require.NotNil(t, oauthService)
 
 	// Create a test user first (required for token generation)
@@ -101,7 +102,7 @@ func TestClientCredentialsInvalidSecret(t *testing.T) {
 		ID:         "test_client_id",
 		Secret:     string(hashedSecret),
 		Domain:     "http://localhost:8080",
-		Scopes:     "read,write",
+		Scopes:     "read write",
 		UserID:     testUser.ID, // Associate client with user
 		GrantTypes: "client_credentials",
 	}
@@ -129,3 +130,299 @@ func TestClientCredentialsInvalidSecret(t *testing.T) {
 	// Should return error for invalid credentials
 	assert.True(t, w.Code >= 400)
 }
+
+func TestClientCredentialsScopeValidation(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	testUser := &models.User{Email: "scopes@example.com", Name: "Scope User", Role: "user"}
+	require.NoError(t, db.Create(testUser).Error)
+	hashedSecret, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID:         "scoped_client",
+		Secret:     string(hashedSecret),
+		Scopes:     "read pizzas:write",
+		UserID:     testUser.ID,
+		GrantTypes: "client_credentials",
+	}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID:         "code_only_client",
+		Secret:     string(hashedSecret),
+		Scopes:     "read",
+		UserID:     testUser.ID,
+		GrantTypes: "authorization_code",
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/oauth/token", oauthService.HandleToken)
+
+	requestToken := func(clientID, scope string) (int, map[string]interface{}) {
+		form := "grant_type=client_credentials&client_id=" + clientID + "&client_secret=secret"
+		if scope != "" {
+			form += "&scope=" + scope
+		}
+		req := httptest.NewRequest("POST", "/oauth/token", bytes.NewBufferString(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	// An omitted scope defaults to everything the client is registered for
+	code, response := requestToken("scoped_client", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "read pizzas:write", response["scope"])
+
+	// Comma-separated requests are accepted and granted space-separated
+	code, response = requestToken("scoped_client", "pizzas:write,read")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "pizzas:write read", response["scope"])
+
+	code, response = requestToken("scoped_client", "read+clients:admin")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_scope", response["error"])
+
+	code, response = requestToken("code_only_client", "read")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "unauthorized_client", response["error"])
+
+	code, response = requestToken("unknown_client", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "invalid_client", response["error"])
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	testUser := &models.User{Email: "refresh@example.com", Name: "Refresh User", Role: "user"}
+	require.NoError(t, db.Create(testUser).Error)
+	for _, id := range []string{"refresh_client", "other_client"} {
+		hashedSecret, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		require.NoError(t, db.Create(&models.OAuthClient{
+			ID:         id,
+			Secret:     string(hashedSecret),
+			Scopes:     "read write",
+			UserID:     testUser.ID,
+			GrantTypes: "client_credentials refresh_token",
+		}).Error)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/oauth/token", oauthService.HandleToken)
+
+	requestToken := func(form string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/oauth/token", bytes.NewBufferString(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+	refreshWith := func(clientID, refresh, scope string) (int, map[string]interface{}) {
+		return requestToken("grant_type=refresh_token&client_id=" + clientID + "&client_secret=secret&refresh_token=" + refresh + "&scope=" + scope)
+	}
+
+	code, issued := requestToken("grant_type=client_credentials&client_id=refresh_client&client_secret=secret&scope=read+write")
+	require.Equal(t, http.StatusOK, code)
+	first, ok := issued["refresh_token"].(string)
+	require.True(t, ok, "client credentials response should include a refresh token")
+
+	// Refresh tokens are bound to the client they were issued to, and can only narrow the scope
+	code, response := refreshWith("other_client", first, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_grant", response["error"])
+	code, response = refreshWith("refresh_client", first, "admin")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_scope", response["error"])
+
+	code, rotated := refreshWith("refresh_client", first, "read")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "read", rotated["scope"])
+	assert.NotEqual(t, issued["access_token"], rotated["access_token"])
+	second := rotated["refresh_token"].(string)
+	assert.NotEqual(t, first, second)
+
+	// Replaying the first refresh token revokes the whole family, including the second one
+	code, response = refreshWith("refresh_client", first, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_grant", response["error"])
+	code, response = refreshWith("refresh_client", second, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid_grant", response["error"])
+}
+
+func TestTokenEndpointHidesInternalErrors(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	testUser := &models.User{Email: "errors@example.com", Name: "Errors User", Role: "user"}
+	require.NoError(t, db.Create(testUser).Error)
+	hashedSecret, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID:         "errors_client",
+		Secret:     string(hashedSecret),
+		Scopes:     "read",
+		UserID:     testUser.ID,
+		GrantTypes: "client_credentials refresh_token",
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/oauth/token", oauthService.HandleToken)
+
+	// Storing or rotating tokens fails; the database error must not reach the client
+	require.NoError(t, db.Migrator().DropTable(&models.OAuthToken{}))
+	for _, form := range []string{
+		"grant_type=client_credentials&client_id=errors_client&client_secret=secret",
+		"grant_type=refresh_token&client_id=errors_client&client_secret=secret&refresh_token=some-refresh-token",
+	} {
+		req := httptest.NewRequest("POST", "/oauth/token", bytes.NewBufferString(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusInternalServerError, w.Code, form)
+		assert.JSONEq(t, `{"error": "server_error"}`, w.Body.String(), form)
+	}
+}
+
+func TestTokenRevocation(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	testUser := &models.User{Email: "revoke@example.com", Name: "Revoke User", Role: "user"}
+	require.NoError(t, db.Create(testUser).Error)
+	for _, id := range []string{"revoke_client", "other_client"} {
+		hashedSecret, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		require.NoError(t, db.Create(&models.OAuthClient{
+			ID:         id,
+			Secret:     string(hashedSecret),
+			Scopes:     "read write",
+			UserID:     testUser.ID,
+			GrantTypes: "client_credentials refresh_token",
+		}).Error)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/oauth/token", oauthService.HandleToken)
+	router.POST("/oauth/revoke", oauthService.HandleRevoke)
+
+	post := func(path, form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	issue := func() (string, string, string) {
+		w := post("/oauth/token", "grant_type=client_credentials&client_id=revoke_client&client_secret=secret")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		access := response["access_token"].(string)
+		claims, err := oauthService.parseIssuedToken(access)
+		require.NoError(t, err)
+		return access, response["refresh_token"].(string), claims["jti"].(string)
+	}
+
+	access, _, jti := issue()
+	assert.False(t, oauthService.Denylist().IsRevoked(jti))
+
+	// Only the client the token was issued to may revoke it
+	w := post("/oauth/revoke", "client_id=other_client&client_secret=secret&token="+access)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = post("/oauth/revoke", "client_id=revoke_client&client_secret=wrong&token="+access)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, oauthService.Denylist().IsRevoked(jti))
+
+	w = post("/oauth/revoke", "client_id=revoke_client&client_secret=secret&token_type_hint=access_token&token="+access)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, oauthService.Denylist().IsRevoked(jti))
+
+	// Revoking a refresh token also revokes the access tokens issued with it
+	access, refresh, jti := issue()
+	w = post("/oauth/revoke", "client_id=revoke_client&client_secret=secret&token="+refresh)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, oauthService.Denylist().IsRevoked(jti))
+	w = post("/oauth/token", "grant_type=refresh_token&client_id=revoke_client&client_secret=secret&refresh_token="+refresh)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Unknown and already revoked tokens are not an error
+	w = post("/oauth/revoke", "client_id=revoke_client&client_secret=secret&token=not-a-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = post("/oauth/revoke", "client_id=revoke_client&client_secret=secret&token="+access)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	testUser := &models.User{Email: "introspect@example.com", Name: "Introspect User", Role: "admin"}
+	require.NoError(t, db.Create(testUser).Error)
+	hashedSecret, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID:         "introspect_client",
+		Secret:     string(hashedSecret),
+		Scopes:     "read write",
+		UserID:     testUser.ID,
+		GrantTypes: "client_credentials refresh_token",
+	}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{ID: "public_client", UserID: testUser.ID}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/oauth/token", oauthService.HandleToken)
+	router.POST("/oauth/revoke", oauthService.HandleRevoke)
+	router.POST("/oauth/introspect", oauthService.HandleIntrospect)
+
+	post := func(path, form string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		if w.Body.Len() > 0 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w.Code, response
+	}
+	introspect := func(token string) map[string]interface{} {
+		code, response := post("/oauth/introspect", "client_id=introspect_client&client_secret=secret&token="+token)
+		require.Equal(t, http.StatusOK, code)
+		return response
+	}
+
+	code, issued := post("/oauth/token", "grant_type=client_credentials&client_id=introspect_client&client_secret=secret&scope=read")
+	require.Equal(t, http.StatusOK, code)
+	access := issued["access_token"].(string)
+
+	// Only authenticated confidential clients may introspect
+	code, response := post("/oauth/introspect", "client_id=public_client&token="+access)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "invalid_client", response["error"])
+	code, _ = post("/oauth/introspect", "client_id=introspect_client&client_secret=wrong&token="+access)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	response = introspect(access)
+	assert.Equal(t, true, response["active"])
+	assert.Equal(t, "read", response["scope"])
+	assert.Equal(t, "introspect_client", response["client_id"])
+	assert.Equal(t, fmt.Sprint(testUser.ID), response["sub"])
+	assert.Equal(t, "admin", response["role"])
+	assert.NotZero(t, response["exp"])
+	assert.NotZero(t, response["iat"])
+
+	// Refresh tokens, garbage and revoked tokens are inactive and reveal nothing else
+	assert.Equal(t, map[string]interface{}{"active": false}, introspect(issued["refresh_token"].(string)))
+	assert.Equal(t, map[string]interface{}{"active": false}, introspect("not-a-token"))
+	code, _ = post("/oauth/revoke", "client_id=introspect_client&client_secret=secret&token="+access)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"active": false}, introspect(access))
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultDenylistSyncInterval bounds how long a revocation made on another replica takes to apply
+const DefaultDenylistSyncInterval = 10 * time.Second
+
+// Denylist records revoked access tokens by their jti claim until they expire
+// Revocations are persisted so every replica applies them, and cached in memory so checking
+// a token on each request does not hit the database. The cache is reloaded from the database
+// at most once per sync interval; revocations made by this replica apply immediately.
+type Denylist struct {
+	db           *gorm.DB
+	syncInterval time.Duration
+
+	mu       sync.RWMutex
+	revoked  map[string]time.Time
+	syncedAt time.Time
+}
+
+// NewDenylist creates a denylist backed by the oauth_revoked_tokens table
+func NewDenylist(db *gorm.DB, syncInterval time.Duration) *Denylist {
+	if syncInterval <= 0 {
+		syncInterval = DefaultDenylistSyncInterval
+	}
+	return &Denylist{
+		db:           db,
+		syncInterval: syncInterval,
+		revoked:      make(map[string]time.Time),
+	}
+}
+
+// Revoke denylists the token with the given jti until it expires
+func (d *Denylist) Revoke(jti string, expiresAt time.Time) error {
+	if jti == "" || !expiresAt.After(time.Now()) {
+		// Tokens without a jti cannot be told apart, and expired tokens are rejected anyway
+		return nil
+	}
+
+	err := d.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.revoked[jti] = expiresAt
+	d.mu.Unlock()
+	return nil
+}
+
+// RevokeAccessToken denylists a JWT access token issued by this server
+// The signature is not checked, so callers must only pass tokens they obtained from storage
+func (d *Denylist) RevokeAccessToken(access string) error {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(access, claims); err != nil {
+		return nil
+	}
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil
+	}
+	return d.Revoke(jti, exp.Time)
+}
+
+// IsRevoked reports whether the token with the given jti was revoked
+// If the database cannot be reached the last loaded revocations are used
+func (d *Denylist) IsRevoked(jti string) bool {
+	if jti == "" {
+		return false
+	}
+
+	d.mu.RLock()
+	stale := time.Since(d.syncedAt) > d.syncInterval
+	d.mu.RUnlock()
+	if stale {
+		if err := d.sync(); err != nil {
+			log.WithError(err).Error("Failed to load revoked tokens, using cached denylist")
+		}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	expiresAt, revoked := d.revoked[jti]
+	return revoked && expiresAt.After(time.Now())
+}
+
+// PurgeExpired deletes revocations of tokens that have expired and returns how many were removed
+func (d *Denylist) PurgeExpired() (int64, error) {
+	result := d.db.Where("expires_at <= ?", time.Now()).Delete(&models.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
+
+// sync replaces the cache with the unexpired revocations stored in the database
+func (d *Denylist) sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Since(d.syncedAt) <= d.syncInterval {
+		// Another request reloaded the cache while this one waited for the lock
+		return nil
+	}
+
+	var rows []models.RevokedToken
+	if err := d.db.Where("expires_at > ?", time.Now()).Find(&rows).Error; err != nil {
+		// Retry on the next interval rather than on every request while the database is down
+		d.syncedAt = time.Now()
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		revoked[row.JTI] = row.ExpiresAt
+	}
+	d.revoked = revoked
+	d.syncedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenylistSharedAcrossReplicas(t *testing.T) {
+	db := setupTestDB(t)
+	local := NewDenylist(db, time.Hour)
+	remote := NewDenylist(db, time.Millisecond)
+
+	assert.False(t, remote.IsRevoked("abc"))
+	require.NoError(t, local.Revoke("abc", time.Now().Add(time.Hour)))
+	assert.True(t, local.IsRevoked("abc"))
+
+	// Other replicas pick the revocation up from the database on their next sync
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, remote.IsRevoked("abc"))
+	assert.False(t, remote.IsRevoked("def"))
+	assert.False(t, remote.IsRevoked(""))
+
+	// Revoking twice is harmless, and expired tokens do not need to be denylisted
+	require.NoError(t, remote.Revoke("abc", time.Now().Add(time.Hour)))
+	require.NoError(t, local.Revoke("old", time.Now().Add(-time.Minute)))
+	assert.False(t, local.IsRevoked("old"))
+}
+
+func TestDenylistPurgeExpired(t *testing.T) {
+	db := setupTestDB(t)
+	denylist := NewDenylist(db, time.Millisecond)
+
+	require.NoError(t, denylist.Revoke("short", time.Now().Add(50*time.Millisecond)))
+	require.NoError(t, denylist.Revoke("long", time.Now().Add(time.Hour)))
+	time.Sleep(60 * time.Millisecond)
+
+	assert.False(t, denylist.IsRevoked("short"))
+	purged, err := denylist.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.True(t, denylist.IsRevoked("long"))
+}
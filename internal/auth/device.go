@@ -0,0 +1,456 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// DeviceCodeGrantType is the grant type a device redeems its device code with (RFC 8628 section 3.4)
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	// deviceCodeTTL is how long the user has to enter the user code and approve the device
+	deviceCodeTTL = 10 * time.Minute
+	// devicePollInterval is how long a device waits between polls of the token endpoint
+	devicePollInterval = 5 * time.Second
+	// deviceSlowDownStep is added to the interval each time a device polls too fast
+	deviceSlowDownStep = 5 * time.Second
+	// userCodeAlphabet has no vowels, so user codes cannot spell words, and no easily confused characters
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// DeviceAuthorizationResponse is returned by the device authorization endpoint
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// devicePageData is rendered by devicePage
+type devicePageData struct {
+	UserCode   string
+	ClientName string
+	Scopes     []string
+	Email      string
+	Error      string
+	// Message replaces the form once the request was approved or denied
+	Message string
+}
+
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Connect a device - Pizza API</title>
+` + pageStyle + `</head>
+<body>
+<h1>Connect a device</h1>
+{{if .Message}}
+<p>{{.Message}}</p>
+{{else}}
+{{if .ClientName}}
+<p>{{.ClientName}} is asking for access to your account with these scopes:</p>
+<ul>{{range .Scopes}}<li><code>{{.}}</code></li>{{end}}</ul>
+{{else}}
+<p>Enter the code shown on your device and sign in to connect it.</p>
+{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post">
+<label for="user_code">Code</label>
+<input id="user_code" name="user_code" value="{{.UserCode}}" autocomplete="off" autocapitalize="characters" required>
+<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{.Email}}" autocomplete="username" required>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit" name="action" value="approve">Sign in and allow</button>
+<button type="submit" name="action" value="deny">Sign in and deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// HandleDeviceAuthorization handles the device authorization endpoint (RFC 8628 section 3.1)
+// A device without a browser gets a device code to poll the token endpoint with, and a user code
+// the user enters on the verification page, which is registered next to this endpoint at "device".
+// Devices cannot keep a secret, so public clients identify themselves with their client_id alone.
+// @Summary Device Authorization Endpoint
+// @Description Start the device authorization grant. Show the user_code and verification_uri to the user, then poll the
+// @Description token endpoint with grant_type=urn:ietf:params:oauth:grant-type:device_code every interval seconds.
+// @Tags OAuth2
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param client_id formData string true "Client ID"
+// @Param client_secret formData string false "Client Secret (not sent by public clients)"
+// @Param scope formData string false "Requested scopes, space-separated; defaults to every scope the client is registered for"
+// @Success 200 {object} DeviceAuthorizationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /oauth/device_authorization [post]
+func (o *OAuthService) HandleDeviceAuthorization(c *gin.Context) {
+	client, ok := o.identifyClient(c)
+	if !ok {
+		return
+	}
+	registration, err := o.registeredClient(c, client.GetID())
+	if err != nil {
+		log.WithError(err).Error("Failed to load client registration")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	if !registration.AllowsGrantType(DeviceCodeGrantType) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "unauthorized_client",
+			"error_description": "Client is not registered for the device_code grant",
+		})
+		return
+	}
+	requested := internalmodels.NormalizeScopes(c.PostForm("scope"))
+	scope, ok, err := o.grantableScope(requested, registration.Scopes)
+	if err != nil {
+		log.WithError(err).Error("Failed to check requested scope")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_scope",
+			"error_description": invalidScopeDescription(requested, registration.Scopes),
+		})
+		return
+	}
+
+	deviceCode, err := randomID()
+	if err != nil {
+		log.WithError(err).Error("Failed to generate device code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	authorization := internalmodels.DeviceAuthorization{
+		DeviceCodeHash: tokenHash(deviceCode),
+		ClientID:       registration.ID,
+		Scope:          scope,
+		Status:         internalmodels.DeviceAuthorizationPending,
+		Interval:       int(devicePollInterval / time.Second),
+		ExpiresAt:      time.Now().Add(deviceCodeTTL),
+	}
+	if err := o.createDeviceAuthorization(c, &authorization); err != nil {
+		log.WithError(err).Error("Failed to store device authorization")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	userCode := formatUserCode(authorization.UserCode)
+	verificationURI := o.issuer(c) + path.Join(path.Dir(c.FullPath()), "device")
+	c.JSON(http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               int(deviceCodeTTL / time.Second),
+		Interval:                authorization.Interval,
+	})
+}
+
+// createDeviceAuthorization stores the authorization with a new user code
+// User codes are short, so a collision with a pending code is retried with another one
+func (o *OAuthService) createDeviceAuthorization(c *gin.Context, authorization *internalmodels.DeviceAuthorization) error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if authorization.UserCode, err = newUserCode(); err != nil {
+			return err
+		}
+		if err = o.db.WithContext(c).Create(authorization).Error; err == nil {
+			return nil
+		}
+		var taken int64
+		query := o.db.WithContext(c).Model(&internalmodels.DeviceAuthorization{}).Where("user_code = ?", authorization.UserCode)
+		if query.Count(&taken).Error != nil || taken == 0 {
+			return err
+		}
+	}
+	return err
+}
+
+// HandleDeviceVerification handles the verification page of the device authorization grant
+// GET shows a form for the user code and the user's credentials; POST approves or denies the device.
+// Denying takes signing in too, so nobody who merely saw a user code can cancel another user's sign-in.
+// @Summary Device Verification Page
+// @Description Enter the user code shown on a device, sign in and allow or deny the device access.
+// @Tags OAuth2
+// @Accept application/x-www-form-urlencoded
+// @Produce html
+// @Param user_code query string false "User code shown on the device, to fill in the form"
+// @Success 200 {string} string "Verification page, or the result of approving or denying"
+// @Failure 400 {string} string "Unknown or expired user code"
+// @Failure 401 {string} string "Wrong email or password"
+// @Failure 429 {string} string "Too many failed sign-ins for the account or the client IP address"
+// @Router /oauth/device [get]
+// @Router /oauth/device [post]
+func (o *OAuthService) HandleDeviceVerification(c *gin.Context) {
+	setPageHeaders(c)
+
+	page := devicePageData{UserCode: strings.TrimSpace(c.Request.FormValue("user_code"))}
+	authorization, err := o.pendingDeviceAuthorization(c, page.UserCode)
+	if err != nil {
+		log.WithError(err).Error("Failed to load device authorization")
+		page.Error = "Something went wrong, please try again."
+		renderPage(c, devicePage, http.StatusInternalServerError, page)
+		return
+	}
+	if authorization != nil {
+		page.UserCode = formatUserCode(authorization.UserCode)
+		page.ClientName, page.Scopes = o.deviceClient(c, authorization)
+	}
+
+	if c.Request.Method != http.MethodPost {
+		renderPage(c, devicePage, http.StatusOK, page)
+		return
+	}
+	if authorization == nil {
+		page.Error = "The code is invalid or has expired."
+		renderPage(c, devicePage, http.StatusBadRequest, page)
+		return
+	}
+
+	page.Email = strings.TrimSpace(c.PostForm("email"))
+	user, err := o.signIn(c, page.Email, c.PostForm("password"))
+	if err != nil {
+		status, message := signInFailure(c, err)
+		page.Error = message
+		renderPage(c, devicePage, status, page)
+		return
+	}
+
+	userID := fmt.Sprint(user.ID)
+	if c.PostForm("action") != "approve" {
+		if err := o.completeDeviceAuthorization(c, authorization, internalmodels.DeviceAuthorizationDenied, userID); err != nil {
+			log.WithError(err).Error("Failed to deny device authorization")
+		}
+		log.WithFields(log.Fields{"client_id": authorization.ClientID, "user_id": userID}).Info("User denied device")
+		renderPage(c, devicePage, http.StatusOK, devicePageData{Message: "Access denied. You can close this window."})
+		return
+	}
+
+	if err := o.completeDeviceAuthorization(c, authorization, internalmodels.DeviceAuthorizationApproved, userID); err != nil {
+		log.WithError(err).Error("Failed to approve device authorization")
+		page.Error = "The code is invalid or has expired."
+		renderPage(c, devicePage, http.StatusBadRequest, page)
+		return
+	}
+
+	log.WithFields(log.Fields{"client_id": authorization.ClientID, "user_id": userID}).Info("User authorized device")
+	renderPage(c, devicePage, http.StatusOK, devicePageData{Message: "Your device is connected. You can close this window and return to it."})
+}
+
+// pendingDeviceAuthorization returns the unexpired request of a user code awaiting approval
+// The user code may be typed in either case and with or without its dash. Unknown codes return nil.
+func (o *OAuthService) pendingDeviceAuthorization(c *gin.Context, userCode string) (*internalmodels.DeviceAuthorization, error) {
+	userCode = normalizeUserCode(userCode)
+	if len(userCode) != userCodeLength {
+		return nil, nil
+	}
+	var authorization internalmodels.DeviceAuthorization
+	err := o.db.WithContext(c).
+		Where("user_code = ? AND status = ? AND expires_at > ?", userCode, internalmodels.DeviceAuthorizationPending, time.Now()).
+		First(&authorization).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// deviceClient returns the name of the client asking for access and the scopes it asks for
+func (o *OAuthService) deviceClient(c *gin.Context, authorization *internalmodels.DeviceAuthorization) (string, []string) {
+	name := authorization.ClientID
+	if client, err := o.registeredClient(c, authorization.ClientID); err == nil && client.Name != "" {
+		name = client.Name
+	}
+	return name, internalmodels.SplitScopes(authorization.Scope)
+}
+
+// completeDeviceAuthorization records the user's decision on a pending request
+// Only the first decision counts, should the page be submitted twice
+func (o *OAuthService) completeDeviceAuthorization(c *gin.Context, authorization *internalmodels.DeviceAuthorization, status internalmodels.DeviceAuthorizationStatus, userID string) error {
+	result := o.db.WithContext(c).Model(&internalmodels.DeviceAuthorization{}).
+		Where("device_code_hash = ? AND status = ?", authorization.DeviceCodeHash, internalmodels.DeviceAuthorizationPending).
+		Updates(map[string]interface{}{"status": status, "user_id": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// handleDeviceCode redeems a device code at the token endpoint (RFC 8628 section 3.4)
+// Until the user decides the device is told authorization_pending, and slow_down when it polls
+// more often than its interval, which then grows by deviceSlowDownStep.
+func (o *OAuthService) handleDeviceCode(c *gin.Context) {
+	client, ok := o.identifyClient(c)
+	if !ok {
+		return
+	}
+	authorized, err := o.clientAuthorized(client.GetID(), oauth2.GrantType(DeviceCodeGrantType))
+	if err != nil {
+		log.WithError(err).Error("Failed to load client registration")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	if !authorized {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "unauthorized_client",
+			"error_description": "Client is not registered for the device_code grant",
+		})
+		return
+	}
+	deviceCode := c.PostForm("device_code")
+	if deviceCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "device_code is required",
+		})
+		return
+	}
+
+	var authorization internalmodels.DeviceAuthorization
+	err = o.db.WithContext(c).Where("device_code_hash = ?", tokenHash(deviceCode)).First(&authorization).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && authorization.ClientID != client.GetID()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_grant",
+			"error_description": "Device code is invalid, already used, or was issued to another client",
+		})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to load device authorization")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	now := time.Now()
+	if !authorization.ExpiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "expired_token",
+			"error_description": "Device code has expired, start a new device authorization",
+		})
+		return
+	}
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	tooFast := authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < interval
+	updates := map[string]interface{}{"last_polled_at": now}
+	if tooFast {
+		updates["interval"] = authorization.Interval + int(deviceSlowDownStep/time.Second)
+	}
+	if err := o.db.WithContext(c).Model(&authorization).Updates(updates).Error; err != nil {
+		log.WithError(err).Error("Failed to record device poll")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	if tooFast {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "slow_down",
+			"error_description": "Polling too fast, wait 5 more seconds between requests",
+		})
+		return
+	}
+
+	switch authorization.Status {
+	case internalmodels.DeviceAuthorizationPending:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "authorization_pending",
+			"error_description": "The user has not approved the device yet",
+		})
+		return
+	case internalmodels.DeviceAuthorizationDenied:
+		o.db.WithContext(c).Delete(&authorization)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "access_denied",
+			"error_description": "The user denied the request",
+		})
+		return
+	}
+
+	// Device codes are single-use: when two polls redeem the same code only the one that deletes it succeeds
+	result := o.db.WithContext(c).
+		Where("device_code_hash = ? AND status = ?", authorization.DeviceCodeHash, internalmodels.DeviceAuthorizationApproved).
+		Delete(&internalmodels.DeviceAuthorization{})
+	if result.Error != nil {
+		log.WithError(result.Error).Error("Failed to redeem device code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_grant",
+			"error_description": "Device code is invalid, already used, or was issued to another client",
+		})
+		return
+	}
+
+	ti, err := o.newToken(c, client, authorization.UserID, "", authorization.Scope)
+	if err == nil {
+		err = o.tokenStore.Create(c, ti)
+	}
+	if err != nil {
+		log.WithError(err).WithField("client_id", client.GetID()).Error("Failed to issue device token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	o.respondWithToken(c, ti)
+}
+
+// newUserCode returns a random user code of userCodeLength characters from userCodeAlphabet
+func newUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode uppercases a typed user code and drops the dash and spaces
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
+
+// formatUserCode splits a user code in two halves with a dash, as it is shown to the user
+func formatUserCode(userCode string) string {
+	half := len(userCode) / 2
+	return userCode[:half] + "-" + userCode[half:]
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/middleware"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDeviceAuthorizationFlow(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	user := &models.User{Email: "alice@example.com", Name: "Alice", Role: "user"}
+	require.NoError(t, user.SetPassword("correct horse battery"))
+	require.NoError(t, db.Create(user).Error)
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte("tv_secret"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "tv", Secret: string(hashedSecret), Name: "Pizza TV", Scopes: "read orders:write", GrantTypes: DeviceCodeGrantType + " refresh_token",
+	}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "machine", Secret: string(hashedSecret), Scopes: "read", GrantTypes: "client_credentials",
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	oauthRoutes := router.Group("/api/v1/oauth")
+	oauthRoutes.POST("/device_authorization", oauthService.HandleDeviceAuthorization)
+	oauthRoutes.GET("/device", oauthService.HandleDeviceVerification)
+	oauthRoutes.POST("/device", oauthService.HandleDeviceVerification)
+	oauthRoutes.POST("/token", oauthService.HandleToken)
+
+	post := func(path string, params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	authorize := func(clientID, scope string) *httptest.ResponseRecorder {
+		return post("/api/v1/oauth/device_authorization", url.Values{"client_id": {clientID}, "client_secret": {"tv_secret"}, "scope": {scope}})
+	}
+	start := func() DeviceAuthorizationResponse {
+		w := authorize("tv", "read")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response DeviceAuthorizationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	poll := func(clientID, deviceCode string) (int, map[string]interface{}) {
+		w := post("/api/v1/oauth/token", url.Values{
+			"grant_type":    {DeviceCodeGrantType},
+			"device_code":   {deviceCode},
+			"client_id":     {clientID},
+			"client_secret": {"tv_secret"},
+		})
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+	// waitInterval moves the last poll of every device back, as if the device had waited its interval
+	waitInterval := func() {
+		require.NoError(t, db.Model(&models.DeviceAuthorization{}).Where("1 = 1").Update("last_polled_at", time.Now().Add(-time.Minute)).Error)
+	}
+	verify := func(userCode, password, action string) *httptest.ResponseRecorder {
+		return post("/api/v1/oauth/device", url.Values{"user_code": {userCode}, "email": {"alice@example.com"}, "password": {password}, "action": {action}})
+	}
+
+	// Only clients registered for the grant may start it, with their own scopes
+	assert.Contains(t, authorize("machine", "").Body.String(), "unauthorized_client")
+	assert.Contains(t, authorize("tv", "read clients:admin").Body.String(), "invalid_scope")
+
+	device := start()
+	assert.Regexp(t, `^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`, device.UserCode)
+	assert.Equal(t, "http://example.com/api/v1/oauth/device", device.VerificationURI)
+	assert.Equal(t, device.VerificationURI+"?user_code="+device.UserCode, device.VerificationURIComplete)
+	assert.Equal(t, 600, device.ExpiresIn)
+	assert.Equal(t, 5, device.Interval)
+
+	// The device waits for the user, and backs off when it polls too fast
+	status, body := poll("tv", device.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "authorization_pending", body["error"])
+	status, body = poll("tv", device.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "slow_down", body["error"])
+	var stored models.DeviceAuthorization
+	require.NoError(t, db.First(&stored, "device_code_hash = ?", tokenHash(device.DeviceCode)).Error)
+	assert.Equal(t, 10, stored.Interval)
+	waitInterval()
+	_, body = poll("tv", device.DeviceCode)
+	assert.Equal(t, "authorization_pending", body["error"])
+	waitInterval()
+	_, body = poll("machine", device.DeviceCode)
+	assert.Equal(t, "unauthorized_client", body["error"])
+
+	// The verification page names the client and the scopes, and the user approves it by signing in
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", device.VerificationURIComplete, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Pizza TV")
+	assert.Contains(t, w.Body.String(), "<code>read</code>")
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+
+	assert.Equal(t, http.StatusBadRequest, verify("BCDF-GHJK", "correct horse battery", "approve").Code)
+	assert.Equal(t, http.StatusUnauthorized, verify(device.UserCode, "wrong password", "approve").Code)
+	typed := strings.ToLower(strings.ReplaceAll(device.UserCode, "-", ""))
+	w = verify(typed, "correct horse battery", "approve")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Your device is connected")
+	assert.Equal(t, http.StatusBadRequest, verify(device.UserCode, "correct horse battery", "deny").Code, "a decision is final")
+
+	// The device code is redeemed once for a token of the user
+	waitInterval()
+	status, body = poll("tv", device.DeviceCode)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "read", body["scope"])
+	assert.NotEmpty(t, body["refresh_token"])
+	claims, err := middleware.ParseAndValidateJWT(body["access_token"].(string), oauthService.KeyRing())
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(user.ID), claims["uid"])
+	assert.Equal(t, "user", claims["role"])
+	assert.Equal(t, "tv", claims["aud"])
+
+	_, body = poll("tv", device.DeviceCode)
+	assert.Equal(t, "invalid_grant", body["error"])
+
+	// Denying takes signing in, and then the device is told so
+	device = start()
+	assert.Equal(t, http.StatusUnauthorized, post("/api/v1/oauth/device", url.Values{"user_code": {device.UserCode}, "action": {"deny"}}).Code)
+	assert.Equal(t, http.StatusUnauthorized, verify(device.UserCode, "wrong password", "deny").Code)
+	waitInterval()
+	_, body = poll("tv", device.DeviceCode)
+	assert.Equal(t, "authorization_pending", body["error"])
+	w = verify(device.UserCode, "correct horse battery", "deny")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Access denied")
+	waitInterval()
+	_, body = poll("tv", device.DeviceCode)
+	assert.Equal(t, "access_denied", body["error"])
+
+	// An expired device code cannot be approved or redeemed
+	device = start()
+	require.NoError(t, db.Model(&models.DeviceAuthorization{}).
+		Where("device_code_hash = ?", tokenHash(device.DeviceCode)).
+		Update("expires_at", time.Now().Add(-time.Second)).Error)
+	assert.Equal(t, http.StatusBadRequest, verify(device.UserCode, "correct horse battery", "approve").Code)
+	_, body = poll("tv", device.DeviceCode)
+	assert.Equal(t, "expired_token", body["error"])
+
+	// Failed sign-ins on the verification page count towards the same limit as on the authorization page
+	device = start()
+	for i := 0; i < maxLoginFailuresPerUser; i++ {
+		verify(device.UserCode, "wrong password", "approve")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, verify(device.UserCode, "correct horse battery", "approve").Code)
+
+	purged, err := oauthService.PurgeExpiredTokens()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+}
+
+func TestDeviceAuthorizationWithPublicClient(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	user := &models.User{Email: "alice@example.com", Name: "Alice", Role: "user"}
+	require.NoError(t, user.SetPassword("correct horse battery"))
+	require.NoError(t, db.Create(user).Error)
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte("tv_secret"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "cli", Name: "Pizza CLI", Scopes: "read", GrantTypes: DeviceCodeGrantType + " refresh_token client_credentials",
+	}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "tv", Secret: string(hashedSecret), Scopes: "read", GrantTypes: DeviceCodeGrantType + " refresh_token",
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	oauthRoutes := router.Group("/api/v1/oauth")
+	oauthRoutes.POST("/device_authorization", oauthService.HandleDeviceAuthorization)
+	oauthRoutes.POST("/device", oauthService.HandleDeviceVerification)
+	oauthRoutes.POST("/token", oauthService.HandleToken)
+
+	post := func(path string, params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	// A confidential client must still authenticate
+	assert.Equal(t, http.StatusUnauthorized, post("/api/v1/oauth/device_authorization", url.Values{"client_id": {"tv"}}).Code)
+
+	// A public client runs the whole grant, and refreshes its tokens, with its client_id alone
+	w := post("/api/v1/oauth/device_authorization", url.Values{"client_id": {"cli"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var device DeviceAuthorizationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &device))
+
+	w = post("/api/v1/oauth/device", url.Values{
+		"user_code": {device.UserCode}, "email": {"alice@example.com"}, "password": {"correct horse battery"}, "action": {"approve"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = post("/api/v1/oauth/token", url.Values{"grant_type": {DeviceCodeGrantType}, "device_code": {device.DeviceCode}, "client_id": {"cli"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	token := decode(w)
+	claims, err := middleware.ParseAndValidateJWT(token["access_token"].(string), oauthService.KeyRing())
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(user.ID), claims["uid"])
+	assert.Equal(t, "cli", claims["aud"])
+
+	w = post("/api/v1/oauth/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token["refresh_token"].(string)}, "client_id": {"cli"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotEmpty(t, decode(w)["access_token"])
+
+	// Another client cannot use the public client's tokens by naming itself
+	w = post("/api/v1/oauth/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token["refresh_token"].(string)}, "client_id": {"tv"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Without a secret, a public client cannot obtain tokens of its own even when registered for it
+	w = post("/api/v1/oauth/token", url.Values{"grant_type": {"client_credentials"}, "client_id": {"cli"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+}
@@ -2,12 +2,23 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
 
 	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
 	"github.com/go-oauth2/oauth2/v4"
+	oauth2errors "github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
 	"gorm.io/gorm"
 )
 
+// ErrRefreshTokenReused is returned when a refresh token is presented again after it was exchanged
+var ErrRefreshTokenReused = errors.New("refresh_token_reused")
+
 type GormClientStore struct {
 	db *gorm.DB
 }
@@ -25,3 +36,264 @@ func (s *GormClientStore) GetByID(ctx context.Context, id string) (oauth2.Client
 	// Return our custom OAuthClient which implements ClientPasswordVerifier
 	return &client, nil
 }
+
+// GormTokenStore implements oauth2.TokenStore on top of the application database
+// so issued tokens survive restarts and are visible to every replica
+type GormTokenStore struct {
+	db *gorm.DB
+	// denylist, when set, receives the access tokens of revoked token families
+	denylist *Denylist
+}
+
+// NewGormTokenStore creates a token store backed by the oauth_tokens table
+func NewGormTokenStore(db *gorm.DB, denylist *Denylist) *GormTokenStore {
+	return &GormTokenStore{db: db, denylist: denylist}
+}
+
+// Create stores new token information, indexed by its code, access token and refresh token
+func (s *GormTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	familyID, err := randomID()
+	if err != nil {
+		return err
+	}
+	record := internalmodels.OAuthToken{
+		CodeHash:    tokenHash(info.GetCode()),
+		AccessHash:  tokenHash(info.GetAccess()),
+		RefreshHash: tokenHash(info.GetRefresh()),
+		Data:        data,
+		ExpiresAt:   tokenExpiry(info),
+		FamilyID:    familyID,
+	}
+	return s.db.WithContext(ctx).Create(&record).Error
+}
+
+// RotateRefresh exchanges a refresh token for the token information returned by issue,
+// which is stored in the same token family. Each refresh token can be exchanged once:
+// presenting one that was already exchanged revokes the whole family and returns ErrRefreshTokenReused.
+// Unknown and expired refresh tokens return oauth2errors.ErrInvalidRefreshToken.
+func (s *GormTokenStore) RotateRefresh(ctx context.Context, refresh string, issue func(current oauth2.TokenInfo) (oauth2.TokenInfo, error)) (oauth2.TokenInfo, error) {
+	if refresh == "" {
+		return nil, oauth2errors.ErrInvalidRefreshToken
+	}
+
+	record, err := s.findByRefresh(ctx, refresh)
+	if err != nil {
+		return nil, err
+	}
+	if record.RotatedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, record.FamilyID)
+	}
+
+	current := models.NewToken()
+	if err := json.Unmarshal(record.Data, current); err != nil {
+		return nil, err
+	}
+	if current.GetRefreshExpiresIn() > 0 && current.GetRefreshCreateAt().Add(current.GetRefreshExpiresIn()).Before(time.Now()) {
+		return nil, oauth2errors.ErrInvalidRefreshToken
+	}
+
+	next, err := issue(current)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only one of several concurrent exchanges of the same refresh token can win
+		result := tx.Model(&internalmodels.OAuthToken{}).
+			Where("id = ? AND rotated_at IS NULL", record.ID).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		return tx.Create(&internalmodels.OAuthToken{
+			CodeHash:    tokenHash(next.GetCode()),
+			AccessHash:  tokenHash(next.GetAccess()),
+			RefreshHash: tokenHash(next.GetRefresh()),
+			Data:        data,
+			ExpiresAt:   tokenExpiry(next),
+			FamilyID:    record.FamilyID,
+		}).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, s.revokeReusedFamily(ctx, record.FamilyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// RevokeFamily deletes every token obtained from the same original grant
+// and denylists the access tokens that have not expired yet
+func (s *GormTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	if s.denylist != nil {
+		var records []internalmodels.OAuthToken
+		if err := s.db.WithContext(ctx).Where("family_id = ?", familyID).Find(&records).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			info := models.NewToken()
+			if err := json.Unmarshal(record.Data, info); err != nil {
+				return err
+			}
+			if err := s.denylist.RevokeAccessToken(info.GetAccess()); err != nil {
+				return err
+			}
+		}
+	}
+	return s.db.WithContext(ctx).Where("family_id = ?", familyID).Delete(&internalmodels.OAuthToken{}).Error
+}
+
+// findByRefresh returns the stored entry of a refresh token, including one that was already exchanged
+func (s *GormTokenStore) findByRefresh(ctx context.Context, refresh string) (internalmodels.OAuthToken, error) {
+	var record internalmodels.OAuthToken
+	err := s.db.WithContext(ctx).
+		Where("refresh_hash = ? AND expires_at > ?", tokenHash(refresh), time.Now()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, oauth2errors.ErrInvalidRefreshToken
+	}
+	return record, err
+}
+
+// revokeReusedFamily revokes a family whose refresh token was presented twice, which means it leaked
+func (s *GormTokenStore) revokeReusedFamily(ctx context.Context, familyID string) error {
+	if err := s.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// RemoveByCode deletes the token information of an authorization code
+// Codes are single-use: when two requests redeem the same code only the one that deletes it succeeds
+func (s *GormTokenStore) RemoveByCode(ctx context.Context, code string) error {
+	result := s.db.WithContext(ctx).Where("code_hash = ?", tokenHash(code)).Delete(&internalmodels.OAuthToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return oauth2errors.ErrInvalidAuthorizeCode
+	}
+	return nil
+}
+
+// RemoveByAccess deletes the token information of an access token
+func (s *GormTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	return s.remove(ctx, "access_hash", access)
+}
+
+// RemoveByRefresh deletes the token information of a refresh token
+func (s *GormTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	return s.remove(ctx, "refresh_hash", refresh)
+}
+
+// GetByCode returns the token information of an authorization code, or nil if it is unknown or expired
+func (s *GormTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "code_hash", code)
+}
+
+// GetByAccess returns the token information of an access token, or nil if it is unknown or expired
+func (s *GormTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "access_hash", access)
+}
+
+// GetByRefresh returns the token information of a refresh token, or nil if it is unknown or expired
+func (s *GormTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "refresh_hash", refresh)
+}
+
+// PurgeExpired deletes token information whose code and tokens have all expired
+// and returns how many entries were removed
+func (s *GormTokenStore) PurgeExpired() (int64, error) {
+	result := s.db.Where("expires_at <= ?", time.Now()).Delete(&internalmodels.OAuthToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *GormTokenStore) remove(ctx context.Context, column, value string) error {
+	if value == "" {
+		return nil
+	}
+	return s.db.WithContext(ctx).Where(column+" = ?", tokenHash(value)).Delete(&internalmodels.OAuthToken{}).Error
+}
+
+func (s *GormTokenStore) get(ctx context.Context, column, value string) (oauth2.TokenInfo, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	// Entries whose refresh token was exchanged are only kept to detect reuse
+	var record internalmodels.OAuthToken
+	err := s.db.WithContext(ctx).
+		Where(column+" = ? AND expires_at > ? AND rotated_at IS NULL", tokenHash(value), time.Now()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The oauth2 manager treats a nil TokenInfo as an invalid or expired token
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := models.NewToken()
+	if err := json.Unmarshal(record.Data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// randomID returns 128 random bits, hex encoded
+func randomID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// tokenHash returns the hex SHA-256 digest used to index a code or token, or "" for an empty value
+func tokenHash(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// noExpiry stands in for tokens issued without a lifetime, which the oauth2 manager never expires
+var noExpiry = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// tokenExpiry returns when the last of the code, access token and refresh token expires
+func tokenExpiry(info oauth2.TokenInfo) time.Time {
+	if info.GetCode() != "" {
+		return expiryOf(info.GetCodeCreateAt(), info.GetCodeExpiresIn())
+	}
+
+	expiresAt := expiryOf(info.GetAccessCreateAt(), info.GetAccessExpiresIn())
+	if info.GetRefresh() != "" {
+		refreshExpiresAt := expiryOf(info.GetRefreshCreateAt(), info.GetRefreshExpiresIn())
+		if refreshExpiresAt.After(expiresAt) {
+			expiresAt = refreshExpiresAt
+		}
+	}
+	return expiresAt
+}
+
+func expiryOf(createdAt time.Time, expiresIn time.Duration) time.Time {
+	if expiresIn <= 0 {
+		return noExpiry
+	}
+	return createdAt.Add(expiresIn)
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGormTokenStoreLookups(t *testing.T) {
+	db := setupTestDB(t)
+	store := NewGormTokenStore(db, nil)
+	ctx := context.Background()
+
+	info := models.NewToken()
+	info.SetClientID("test_client")
+	info.SetUserID("1")
+	info.SetScope("read")
+	info.SetAccess("access-token")
+	info.SetAccessCreateAt(time.Now())
+	info.SetAccessExpiresIn(time.Hour)
+	info.SetRefresh("refresh-token")
+	info.SetRefreshCreateAt(time.Now())
+	info.SetRefreshExpiresIn(24 * time.Hour)
+	require.NoError(t, store.Create(ctx, info))
+
+	byAccess, err := store.GetByAccess(ctx, "access-token")
+	require.NoError(t, err)
+	require.NotNil(t, byAccess)
+	assert.Equal(t, "test_client", byAccess.GetClientID())
+	assert.Equal(t, "refresh-token", byAccess.GetRefresh())
+	assert.Equal(t, time.Hour, byAccess.GetAccessExpiresIn())
+
+	byRefresh, err := store.GetByRefresh(ctx, "refresh-token")
+	require.NoError(t, err)
+	require.NotNil(t, byRefresh)
+	assert.Equal(t, "access-token", byRefresh.GetAccess())
+
+	// Unknown and empty values are reported as missing, not as errors
+	missing, err := store.GetByAccess(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	missing, err = store.GetByCode(ctx, "")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	require.NoError(t, store.RemoveByRefresh(ctx, "refresh-token"))
+	missing, err = store.GetByAccess(ctx, "access-token")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	code := models.NewToken()
+	code.SetCode("auth-code")
+	code.SetCodeCreateAt(time.Now())
+	code.SetCodeExpiresIn(10 * time.Minute)
+	require.NoError(t, store.Create(ctx, code))
+	byCode, err := store.GetByCode(ctx, "auth-code")
+	require.NoError(t, err)
+	require.NotNil(t, byCode)
+	require.NoError(t, store.RemoveByCode(ctx, "auth-code"))
+	missing, err = store.GetByCode(ctx, "auth-code")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestGormTokenStorePurgeExpired(t *testing.T) {
+	db := setupTestDB(t)
+	store := NewGormTokenStore(db, nil)
+	ctx := context.Background()
+
+	issue := func(access, refresh string, issuedAt time.Time) {
+		info := models.NewToken()
+		info.SetAccess(access)
+		info.SetAccessCreateAt(issuedAt)
+		info.SetAccessExpiresIn(time.Hour)
+		if refresh != "" {
+			info.SetRefresh(refresh)
+			info.SetRefreshCreateAt(issuedAt)
+			info.SetRefreshExpiresIn(24 * time.Hour)
+		}
+		require.NoError(t, store.Create(ctx, info))
+	}
+	issue("expired", "", time.Now().Add(-2*time.Hour))
+	// The access token expired but its refresh token can still be used
+	issue("refreshable", "refresh", time.Now().Add(-2*time.Hour))
+	issue("current", "", time.Now())
+
+	expired, err := store.GetByAccess(ctx, "expired")
+	require.NoError(t, err)
+	assert.Nil(t, expired)
+
+	purged, err := store.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	var remaining int64
+	require.NoError(t, db.Model(&internalmodels.OAuthToken{}).Count(&remaining).Error)
+	assert.Equal(t, int64(2), remaining)
+	refreshable, err := store.GetByRefresh(ctx, "refresh")
+	require.NoError(t, err)
+	assert.NotNil(t, refreshable)
+}
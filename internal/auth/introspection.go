@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// IntrospectionResponse describes an access token (RFC 7662 section 2.2)
+// Inactive tokens are answered with only active=false
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// HandleIntrospect handles the token introspection endpoint (RFC 7662)
+// @Summary Introspect an access token
+// @Description Report whether an access token is active and return its claims.
+// @Description Tokens are validated exactly as the API validates Bearer tokens; expired, revoked, malformed
+// @Description and refresh tokens are answered with {"active": false}. Only confidential clients may call this endpoint.
+// @Tags OAuth2
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "The access token to introspect"
+// @Param token_type_hint formData string false "access_token"
+// @Param client_id formData string true "Client ID"
+// @Param client_secret formData string true "Client Secret"
+// @Success 200 {object} IntrospectionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/oauth/introspect [post]
+func (o *OAuthService) HandleIntrospect(c *gin.Context) {
+	// authenticateClient requires a client secret, so public clients are always rejected
+	if _, ok := o.authenticateClient(c); !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "token is required",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, o.introspect(token))
+}
+
+// introspect validates an access token with the same rules as middleware.OAuth2Auth
+func (o *OAuthService) introspect(token string) IntrospectionResponse {
+	inactive := IntrospectionResponse{Active: false}
+
+	claims, err := middleware.ParseAndValidateJWT(token, o.keyRing)
+	if err != nil {
+		return inactive
+	}
+	jti, _ := claims["jti"].(string)
+	if o.denylist.IsRevoked(jti) {
+		return inactive
+	}
+
+	// Refresh tokens carry neither a user nor a role and are never accepted by the API
+	sub, _ := claims["uid"].(string)
+	role, _ := claims["role"].(string)
+	if sub == "" || role == "" {
+		return inactive
+	}
+
+	response := IntrospectionResponse{
+		Active:    true,
+		Sub:       sub,
+		Jti:       jti,
+		TokenType: "Bearer",
+		Role:      role,
+	}
+	response.Scope, _ = claims["scope"].(string)
+	response.ClientID, _ = claims["aud"].(string)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		response.Exp = exp.Unix()
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		response.Iat = iat.Unix()
+	}
+	return response
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleJWKS publishes the public keys that verify tokens (RFC 7517)
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens offline; select the key by the token's kid header.
+// @Description Retired keys stay listed until the tokens they signed expire. HS512 keys are never listed.
+// @Tags OAuth2
+// @Produce json
+// @Success 200 {object} JWKSet
+// @Router /.well-known/jwks.json [get]
+func (o *OAuthService) HandleJWKS(c *gin.Context) {
+	set := o.keyRing.JWKS()
+
+	// Verifiers may cache the keys briefly; a new kid is their cue to fetch the set again
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -13,26 +13,32 @@ import (
 
 // CustomJWTAccessGenerate generates JWT access tokens with custom claims including UserID and Role
 type CustomJWTAccessGenerate struct {
-	SignedKey    []byte
-	SignedMethod jwt.SigningMethod
-	DB           *gorm.DB // Database connection to fetch user information
+	Keys *KeyRing // Its active key signs the tokens and names itself in their kid header
+	DB   *gorm.DB // Database connection to fetch user information
 }
 
 // NewCustomJWTAccessGenerate creates a new custom JWT access token generator
-func NewCustomJWTAccessGenerate(key []byte, method jwt.SigningMethod, db *gorm.DB) *CustomJWTAccessGenerate {
+func NewCustomJWTAccessGenerate(keys *KeyRing, db *gorm.DB) *CustomJWTAccessGenerate {
 	return &CustomJWTAccessGenerate{
-		SignedKey:    key,
-		SignedMethod: method,
-		DB:           db,
+		Keys: keys,
+		DB:   db,
 	}
 }
 
 // Token generates a JWT access token with custom claims
 // This method is called by the OAuth2 library to generate access tokens
 func (g *CustomJWTAccessGenerate) Token(ctx context.Context, data *oauth2.GenerateBasic, isGenRefresh bool) (string, string, error) {
+	// The jti identifies the token so it can be revoked before it expires
+	jti, err := randomID()
+	if err != nil {
+		return "", "", err
+	}
+
 	// Create base claims with standard fields
 	claims := jwt.MapClaims{
+		"jti": jti,
 		"aud": data.Client.GetID(),
+		"iat": data.TokenInfo.GetAccessCreateAt().Unix(),
 		"exp": data.TokenInfo.GetAccessCreateAt().Add(data.TokenInfo.GetAccessExpiresIn()).Unix(),
 	}
 
@@ -64,8 +70,11 @@ func (g *CustomJWTAccessGenerate) Token(ctx context.Context, data *oauth2.Genera
 	}
 
 	// Generate the access token
-	token := jwt.NewWithClaims(g.SignedMethod, claims)
-	access, err := token.SignedString(g.SignedKey)
+	key, err := g.Keys.Active()
+	if err != nil {
+		return "", "", err
+	}
+	access, err := key.Sign(claims)
 	if err != nil {
 		return "", "", err
 	}
@@ -73,12 +82,17 @@ func (g *CustomJWTAccessGenerate) Token(ctx context.Context, data *oauth2.Genera
 	// Generate refresh token if requested
 	refresh := ""
 	if isGenRefresh {
+		// A random jti makes every refresh token unique, even when issued in the same second
+		jti, err = randomID()
+		if err != nil {
+			return "", "", err
+		}
 		refreshClaims := jwt.MapClaims{
-			"id":  data.TokenInfo.GetAccess(),
+			"jti": jti,
+			"aud": data.Client.GetID(),
 			"exp": data.TokenInfo.GetRefreshCreateAt().Add(data.TokenInfo.GetRefreshExpiresIn()).Unix(),
 		}
-		t := jwt.NewWithClaims(g.SignedMethod, refreshClaims)
-		refresh, err = t.SignedString(g.SignedKey)
+		refresh, err = key.Sign(refreshClaims)
 		if err != nil {
 			return "", "", err
 		}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// SigningKeyInfo describes a key of the signing key ring without its private half
+type SigningKeyInfo struct {
+	KID       string `json:"kid"`
+	Algorithm string `json:"alg"`
+	// Status is "active" for the key that signs new tokens and "retired" for the others
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	// ExpiresAt is when a retired key is removed and stops verifying tokens
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// SigningKeyList is the response of the signing key endpoints
+type SigningKeyList struct {
+	Keys []SigningKeyInfo `json:"keys"`
+}
+
+// RotateSigningKeyRequest is the optional body of POST /api/v1/keys:rotate
+type RotateSigningKeyRequest struct {
+	// Algorithm of the new key; defaults to the algorithm of the active key
+	Algorithm string `json:"algorithm" example:"ES256"`
+	// RetireAfter is how long the retired keys keep verifying tokens, as a Go duration
+	RetireAfter string `json:"retire_after" example:"2h"`
+}
+
+// HandleListSigningKeys lists the keys of the signing key ring
+// @Summary List signing keys
+// @Description The active key signs new tokens; retired keys verify the tokens they signed until expires_at.
+// @Tags Signing Keys
+// @Produce json
+// @Success 200 {object} SigningKeyList
+// @Failure 500 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/keys [get]
+func (o *OAuthService) HandleListSigningKeys(c *gin.Context) {
+	list, err := o.signingKeyList()
+	if err != nil {
+		log.WithError(err).Error("Failed to list signing keys")
+		c.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to list signing keys"))
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// HandleRotateSigningKey replaces the active signing key with a new one
+// @Summary Rotate the signing key
+// @Description Generates a new active key on every replica and retires the previous keys. Tokens they signed
+// @Description stay valid until retire_after has passed, which defaults to and may not be shorter than the access
+// @Description token lifetime plus the key ring sync interval. Refresh tokens keep working after their key is removed.
+// @Tags Signing Keys
+// @Accept json
+// @Produce json
+// @Param rotation body RotateSigningKeyRequest false "New key algorithm and retirement period"
+// @Success 201 {object} SigningKeyList
+// @Failure 400 {object} models.APIError
+// @Failure 500 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/keys:rotate [post]
+func (o *OAuthService) HandleRotateSigningKey(c *gin.Context) {
+	var req RotateSigningKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, err.Error()))
+		return
+	}
+
+	minRetireAfter := o.config.AccessTokenTTL + o.keyRing.syncInterval
+	retireAfter := minRetireAfter
+	if req.RetireAfter != "" {
+		var err error
+		retireAfter, err = time.ParseDuration(req.RetireAfter)
+		if err != nil || retireAfter < minRetireAfter {
+			c.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrValidationFailed,
+				fmt.Sprintf("retire_after must be a duration of at least %s", minRetireAfter)))
+			return
+		}
+	}
+
+	if req.Algorithm == "" {
+		active, err := o.keyRing.Active()
+		if err != nil {
+			log.WithError(err).Error("Failed to load the active signing key")
+			c.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to rotate signing key"))
+			return
+		}
+		req.Algorithm = active.Method.Alg()
+	}
+
+	key, err := o.keyRing.Rotate(req.Algorithm, retireAfter)
+	if errors.Is(err, ErrUnsupportedAlgorithm) {
+		c.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrValidationFailed, err.Error(),
+			map[string]interface{}{"supported_algorithms": SigningAlgorithms}))
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to rotate signing key")
+		c.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to rotate signing key"))
+		return
+	}
+	log.WithFields(log.Fields{
+		"alg":          key.Method.Alg(),
+		"kid":          key.ID,
+		"retire_after": retireAfter,
+		"user_id":      c.GetUint("userID"),
+	}).Info("Rotated signing key")
+
+	list, err := o.signingKeyList()
+	if err != nil {
+		log.WithError(err).Error("Failed to list signing keys")
+		c.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to list signing keys"))
+		return
+	}
+	c.JSON(http.StatusCreated, list)
+}
+
+func (o *OAuthService) signingKeyList() (SigningKeyList, error) {
+	records, err := o.keyRing.Records()
+	if err != nil {
+		return SigningKeyList{}, err
+	}
+	list := SigningKeyList{Keys: make([]SigningKeyInfo, 0, len(records))}
+	for _, record := range records {
+		status := "retired"
+		if record.RetiredAt == nil {
+			status = "active"
+		}
+		list.Keys = append(list.Keys, SigningKeyInfo{
+			KID:       record.KID,
+			Algorithm: record.Algorithm,
+			Status:    status,
+			CreatedAt: record.CreatedAt,
+			RetiredAt: record.RetiredAt,
+			ExpiresAt: record.ExpiresAt,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultKeyRingSyncInterval bounds how long a rotation made on another replica takes to apply
+	DefaultKeyRingSyncInterval = 10 * time.Second
+	// keyRingRefreshInterval limits the reloads triggered by tokens naming an unknown kid
+	keyRingRefreshInterval = time.Second
+)
+
+// ErrNoActiveSigningKey is returned when the key ring could not be loaded and holds no key to sign with
+var ErrNoActiveSigningKey = errors.New("no active signing key")
+
+// KeyRing holds the key that signs new tokens and the retired keys that still verify tokens
+// they signed, selected by the kid header. The ring is stored in the oauth_signing_keys table so
+// every replica signs and verifies with the same keys, and cached in memory like the Denylist.
+// Private keys are encrypted at rest with a key derived from the JWT secret.
+type KeyRing struct {
+	db           *gorm.DB
+	aead         cipher.AEAD
+	initial      *SigningKey
+	legacyKID    string
+	syncInterval time.Duration
+
+	mu       sync.RWMutex
+	active   *SigningKey
+	keys     map[string]ringKey
+	syncedAt time.Time
+}
+
+// ringKey is a cached key of the ring with the time it is removed, if it has been retired
+type ringKey struct {
+	*SigningKey
+	expiresAt *time.Time
+}
+
+// NewKeyRing creates a key ring backed by the oauth_signing_keys table
+// The initial key is stored as the active key while the ring has none, so the first replica to
+// start seeds the ring from its configuration. Afterwards keys only change by rotating them.
+func NewKeyRing(db *gorm.DB, secret string, initial *SigningKey, syncInterval time.Duration) *KeyRing {
+	if syncInterval <= 0 {
+		syncInterval = DefaultKeyRingSyncInterval
+	}
+	sum := sha256.Sum256([]byte("signing-key-ring\x00" + secret))
+	block, _ := aes.NewCipher(sum[:]) // Cannot fail: a SHA-256 digest is a valid AES-256 key
+	aead, _ := cipher.NewGCM(block)
+	return &KeyRing{
+		db:           db,
+		aead:         aead,
+		initial:      initial,
+		legacyKID:    NewHMACSigningKey([]byte(secret)).ID,
+		syncInterval: syncInterval,
+		keys:         make(map[string]ringKey),
+	}
+}
+
+// Active returns the key that signs new tokens
+func (r *KeyRing) Active() (*SigningKey, error) {
+	r.syncIfOlder(r.syncInterval)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.active == nil {
+		return nil, ErrNoActiveSigningKey
+	}
+	return r.active, nil
+}
+
+// VerificationKey returns the method and key that verify tokens signed with kid
+// Tokens without a kid were signed with JWT_SECRET before kid headers were added, and are
+// accepted as long as that secret's key is in the ring. An unknown kid reloads the ring, since
+// another replica may have just rotated to it.
+func (r *KeyRing) VerificationKey(kid string) (jwt.SigningMethod, interface{}, error) {
+	if kid == "" {
+		kid = r.legacyKID
+	}
+
+	r.syncIfOlder(r.syncInterval)
+	key, ok := r.lookup(kid)
+	if !ok {
+		r.syncIfOlder(keyRingRefreshInterval)
+		if key, ok = r.lookup(kid); !ok {
+			return nil, nil, ErrUnknownKeyID
+		}
+	}
+	return key.VerificationKey(key.ID)
+}
+
+// JWKS returns the public keys of every asymmetric key in the ring, the active key first
+func (r *KeyRing) JWKS() JWKSet {
+	r.syncIfOlder(r.syncInterval)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := JWKSet{Keys: []JWK{}}
+	if r.active != nil {
+		if jwk, ok := r.active.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	for kid, key := range r.keys {
+		if r.active != nil && kid == r.active.ID {
+			continue
+		}
+		if jwk, ok := key.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Records returns the stored keys that have not been removed, newest first
+func (r *KeyRing) Records() ([]models.SigningKeyRecord, error) {
+	r.syncIfOlder(r.syncInterval)
+	return r.records()
+}
+
+func (r *KeyRing) records() ([]models.SigningKeyRecord, error) {
+	var records []models.SigningKeyRecord
+	err := r.db.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC, kid DESC").
+		Find(&records).Error
+	return records, err
+}
+
+// Rotate makes a new key of the algorithm the active key and retires every other key
+// Retired keys keep verifying the tokens they signed for retireAfter, then they are removed.
+func (r *KeyRing) Rotate(algorithm string, retireAfter time.Duration) (*SigningKey, error) {
+	// Seed the ring first, so the configured key is retired rather than dropped
+	r.syncIfOlder(r.syncInterval)
+
+	key, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	record, err := r.seal(key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.SigningKeyRecord{}).
+			Where("retired_at IS NULL").
+			Updates(map[string]interface{}{"retired_at": now, "expires_at": now.Add(retireAfter)}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.sync(0); err != nil {
+		log.WithError(err).Error("Failed to reload signing keys after rotation")
+	}
+	return key, nil
+}
+
+// PurgeExpired deletes retired keys whose tokens have expired and returns how many were removed
+func (r *KeyRing) PurgeExpired() (int64, error) {
+	result := r.db.Where("expires_at <= ?", time.Now()).Delete(&models.SigningKeyRecord{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *KeyRing) lookup(kid string) (ringKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[kid]
+	if !ok || (key.expiresAt != nil && !key.expiresAt.After(time.Now())) {
+		return ringKey{}, false
+	}
+	return key, true
+}
+
+// syncIfOlder reloads the ring when it was last loaded more than maxAge ago
+// If the database cannot be reached the last loaded keys are used
+func (r *KeyRing) syncIfOlder(maxAge time.Duration) {
+	r.mu.RLock()
+	stale := time.Since(r.syncedAt) > maxAge
+	r.mu.RUnlock()
+	if stale {
+		if err := r.sync(maxAge); err != nil {
+			log.WithError(err).Error("Failed to load signing keys, using cached key ring")
+		}
+	}
+}
+
+// sync replaces the cache with the keys stored in the database, seeding the initial key if
+// the ring has no active key. The newest key that is not retired is the active key.
+func (r *KeyRing) sync(maxAge time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.syncedAt) <= maxAge {
+		// Another request reloaded the cache while this one waited for the lock
+		return nil
+	}
+	// Retry on the next interval rather than on every request while the database is down
+	r.syncedAt = time.Now()
+
+	records, err := r.records()
+	if err != nil {
+		return err
+	}
+	if !hasActiveRecord(records) && r.initial != nil {
+		record, err := r.seal(r.initial)
+		if err != nil {
+			return err
+		}
+		// Replicas starting together seed the same key; the first insert wins
+		if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{"alg": r.initial.Method.Alg(), "kid": r.initial.ID}).Info("Seeded signing key ring")
+		if records, err = r.records(); err != nil {
+			return err
+		}
+	}
+
+	var active *SigningKey
+	keys := make(map[string]ringKey, len(records))
+	for _, record := range records {
+		key, err := r.open(record)
+		if err != nil {
+			// One unreadable key must not take down the others
+			log.WithError(err).WithField("kid", record.KID).Error("Failed to load signing key")
+			continue
+		}
+		keys[record.KID] = ringKey{SigningKey: key, expiresAt: record.ExpiresAt}
+		if active == nil && record.RetiredAt == nil {
+			active = key
+		}
+	}
+	r.keys = keys
+	if active != nil {
+		r.active = active
+	}
+	return nil
+}
+
+func hasActiveRecord(records []models.SigningKeyRecord) bool {
+	for _, record := range records {
+		if record.RetiredAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// seal encrypts the private key for storage, bound to its kid
+func (r *KeyRing) seal(key *SigningKey) (models.SigningKeyRecord, error) {
+	plaintext, err := marshalPrivateKey(key)
+	if err != nil {
+		return models.SigningKeyRecord{}, err
+	}
+	nonce := make([]byte, r.aead.NonceSize(), r.aead.NonceSize()+len(plaintext)+r.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return models.SigningKeyRecord{}, err
+	}
+	return models.SigningKeyRecord{
+		KID:        key.ID,
+		Algorithm:  key.Method.Alg(),
+		PrivateKey: r.aead.Seal(nonce, nonce, plaintext, []byte(key.ID)),
+	}, nil
+}
+
+// open decrypts a stored key, reusing the cached key when it was loaded before
+func (r *KeyRing) open(record models.SigningKeyRecord) (*SigningKey, error) {
+	if cached, ok := r.keys[record.KID]; ok {
+		return cached.SigningKey, nil
+	}
+
+	size := r.aead.NonceSize()
+	if len(record.PrivateKey) < size {
+		return nil, errors.New("sealed key is truncated")
+	}
+	plaintext, err := r.aead.Open(nil, record.PrivateKey[:size], record.PrivateKey[size:], []byte(record.KID))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt key, was JWT_SECRET changed? %w", err)
+	}
+	key, err := unmarshalPrivateKey(record.Algorithm, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if key.ID != record.KID {
+		return nil, fmt.Errorf("stored key has kid %q", key.ID)
+	}
+	return key, nil
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/middleware"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeyRingSecret = "test-jwt-secret-key-32-characters"
+
+func TestKeyRingRotationAcrossReplicas(t *testing.T) {
+	db := setupTestDB(t)
+	initial := NewHMACSigningKey([]byte(testKeyRingSecret))
+	local := NewKeyRing(db, testKeyRingSecret, initial, time.Hour)
+	remote := NewKeyRing(db, testKeyRingSecret, initial, time.Hour)
+	claims := jwt.MapClaims{"uid": "1", "exp": time.Now().Add(time.Minute).Unix()}
+
+	// The first replica seeds the ring with the configured key, the others load it
+	active, err := local.Active()
+	require.NoError(t, err)
+	assert.Equal(t, initial.ID, active.ID)
+	oldToken, err := active.Sign(claims)
+	require.NoError(t, err)
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(testKeyRingSecret))
+	require.NoError(t, err)
+	for _, token := range []string{oldToken, legacyToken} {
+		_, err = middleware.ParseAndValidateJWT(token, remote)
+		assert.NoError(t, err)
+	}
+
+	rotated, err := local.Rotate("ES256", 50*time.Millisecond)
+	require.NoError(t, err)
+	active, err = local.Active()
+	require.NoError(t, err)
+	assert.Equal(t, rotated.ID, active.ID)
+	newToken, err := rotated.Sign(claims)
+	require.NoError(t, err)
+
+	// Tokens of the old key stay valid during the retirement period
+	_, err = middleware.ParseAndValidateJWT(oldToken, local)
+	assert.NoError(t, err)
+
+	// A kid the replica does not know reloads the ring, without waiting for the sync interval
+	remote.syncedAt = time.Now().Add(-keyRingRefreshInterval)
+	_, err = middleware.ParseAndValidateJWT(newToken, remote)
+	require.NoError(t, err)
+	active, err = remote.Active()
+	require.NoError(t, err)
+	assert.Equal(t, rotated.ID, active.ID)
+	jwks := remote.JWKS()
+	require.Len(t, jwks.Keys, 1, "the retired HS512 key is never published")
+	assert.Equal(t, rotated.ID, jwks.Keys[0].Kid)
+
+	// Once retired keys expire their tokens are rejected and the keys can be purged
+	time.Sleep(60 * time.Millisecond)
+	for _, token := range []string{oldToken, legacyToken} {
+		_, err = middleware.ParseAndValidateJWT(token, local)
+		assert.ErrorIs(t, err, ErrUnknownKeyID)
+	}
+	purged, err := local.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, err = middleware.ParseAndValidateJWT(newToken, local)
+	assert.NoError(t, err)
+}
+
+func TestKeyRingStorage(t *testing.T) {
+	db := setupTestDB(t)
+	ring := NewKeyRing(db, testKeyRingSecret, NewHMACSigningKey([]byte(testKeyRingSecret)), time.Hour)
+
+	for _, algorithm := range SigningAlgorithms {
+		key, err := ring.Rotate(algorithm, time.Hour)
+		require.NoError(t, err, algorithm)
+		assert.Equal(t, algorithm, key.Method.Alg())
+	}
+	_, err := ring.Rotate("none", time.Hour)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	// Private keys are only stored encrypted
+	var record models.SigningKeyRecord
+	require.NoError(t, db.First(&record, "kid = ?", NewHMACSigningKey([]byte(testKeyRingSecret)).ID).Error)
+	assert.NotContains(t, string(record.PrivateKey), testKeyRingSecret)
+
+	// Every replica restores the same keys, and a later configured key does not replace them
+	restarted := NewKeyRing(db, testKeyRingSecret, NewHMACSigningKey([]byte("another-configured-secret")), time.Hour)
+	expected, err := ring.Active()
+	require.NoError(t, err)
+	active, err := restarted.Active()
+	require.NoError(t, err)
+	assert.Equal(t, expected.ID, active.ID)
+	assert.Len(t, restarted.JWKS().Keys, len(SigningAlgorithms)-1)
+
+	// Without the secret that sealed them the keys cannot be used
+	_, err = NewKeyRing(db, "a-different-jwt-secret-key-value", nil, time.Hour).Active()
+	assert.ErrorIs(t, err, ErrNoActiveSigningKey)
+}
+
+func TestRotateSigningKeyEndpoint(t *testing.T) {
+	oauthService := NewOAuthService(setupTestDB(t), Config{JWTSecret: testKeyRingSecret, AccessTokenTTL: time.Minute})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/keys", oauthService.HandleListSigningKeys)
+	router.POST("/keys:rotate", oauthService.HandleRotateSigningKey)
+
+	request := func(method, path, body string) (int, SigningKeyList) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		var list SigningKeyList
+		if w.Code < http.StatusBadRequest {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		}
+		return w.Code, list
+	}
+
+	code, list := request("GET", "/keys", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, list.Keys, 1)
+	assert.Equal(t, "active", list.Keys[0].Status)
+	initialKID := list.Keys[0].KID
+
+	// Without a body the new key keeps the algorithm and the old key outlives the access tokens it signed
+	code, list = request("POST", "/keys:rotate", "")
+	require.Equal(t, http.StatusCreated, code)
+	require.Len(t, list.Keys, 2)
+	assert.Equal(t, "active", list.Keys[0].Status)
+	assert.Equal(t, "HS512", list.Keys[0].Algorithm)
+	assert.Equal(t, initialKID, list.Keys[1].KID)
+	assert.Equal(t, "retired", list.Keys[1].Status)
+	require.NotNil(t, list.Keys[1].ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Minute+DefaultKeyRingSyncInterval), *list.Keys[1].ExpiresAt, 5*time.Second)
+
+	code, list = request("POST", "/keys:rotate", `{"algorithm":"EdDSA","retire_after":"24h"}`)
+	require.Equal(t, http.StatusCreated, code)
+	require.Len(t, list.Keys, 3)
+	assert.Equal(t, "EdDSA", list.Keys[0].Algorithm)
+
+	for _, body := range []string{`{"algorithm":"none"}`, `{"retire_after":"1s"}`, `{"retire_after":"soon"}`, `{`} {
+		code, _ = request("POST", "/keys:rotate", body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+}
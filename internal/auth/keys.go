@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing tokens
+const minRSAKeyBits = 2048
+
+// hmacSecretBytes is the size of generated HS512 secrets, matching the hash output
+const hmacSecretBytes = 64
+
+// SigningAlgorithms lists the algorithms GenerateSigningKey can create keys for
+var SigningAlgorithms = []string{"HS512", "RS256", "ES256", "ES384", "ES512", "EdDSA"}
+
+var (
+	// ErrUnknownKeyID is returned when a token names a kid that is not a verification key
+	ErrUnknownKeyID = errors.New("unknown signing key")
+	// ErrUnsupportedAlgorithm is returned when asked for a key of an algorithm not in SigningAlgorithms
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// SigningKey signs tokens and identifies itself with the kid header of every token it signs
+// Asymmetric keys publish their public half in the JWKS so other services can verify tokens offline.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private signs tokens: the HMAC secret or the private key
+	private interface{}
+	// public verifies tokens: the HMAC secret or the public key
+	public interface{}
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACSigningKey creates an HS512 key from the shared secret
+// Only holders of the secret can verify its tokens, so it is never published.
+func NewHMACSigningKey(secret []byte) *SigningKey {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("kid"))
+	return &SigningKey{
+		ID:      "hs512-" + hex.EncodeToString(mac.Sum(nil)[:8]),
+		Method:  jwt.SigningMethodHS512,
+		private: secret,
+		public:  secret,
+	}
+}
+
+// LoadSigningKey reads a PEM encoded RSA, ECDSA or Ed25519 private key
+// The algorithm follows from the key: RS256, ES256/ES384/ES512 by curve, or EdDSA.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseSigningKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParseSigningKey parses a PEM encoded private key in PKCS #8, PKCS #1 (RSA) or SEC 1 (EC) form
+func ParseSigningKey(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q, expected a private key", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricSigningKey(parsed)
+}
+
+// GenerateSigningKey creates a new random key for the algorithm
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var private interface{}
+	var err error
+	switch algorithm {
+	case "HS512":
+		secret := make([]byte, hmacSecretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return NewHMACSigningKey(secret), nil
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricSigningKey(private)
+}
+
+// marshalPrivateKey encodes the key for storage: the HMAC secret, or the PKCS #8 private key
+func marshalPrivateKey(key *SigningKey) ([]byte, error) {
+	if secret, ok := key.private.([]byte); ok {
+		return secret, nil
+	}
+	return x509.MarshalPKCS8PrivateKey(key.private)
+}
+
+// unmarshalPrivateKey decodes a key stored by marshalPrivateKey
+func unmarshalPrivateKey(algorithm string, data []byte) (*SigningKey, error) {
+	if algorithm == jwt.SigningMethodHS512.Alg() {
+		return NewHMACSigningKey(data), nil
+	}
+	private, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := newAsymmetricSigningKey(private)
+	if err != nil {
+		return nil, err
+	}
+	if key.Method.Alg() != algorithm {
+		return nil, fmt.Errorf("stored %s key is a %s key", algorithm, key.Method.Alg())
+	}
+	return key, nil
+}
+
+func newAsymmetricSigningKey(private interface{}) (*SigningKey, error) {
+	key := &SigningKey{private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key has %d bits, at least %d are required", k.N.BitLen(), minRSAKeyBits)
+		}
+		key.Method, key.public = jwt.SigningMethodRS256, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+		key.public = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Method, key.public = jwt.SigningMethodEdDSA, k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+
+	jwk, _ := key.JWK()
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = thumbprint
+	return key, nil
+}
+
+// Sign signs the claims and sets the kid header
+func (k *SigningKey) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.Method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.private)
+}
+
+// VerificationKey returns the method and key that verify tokens signed with kid
+// HMAC tokens issued before kid headers were added have no kid and are still accepted
+func (k *SigningKey) VerificationKey(kid string) (jwt.SigningMethod, interface{}, error) {
+	if kid == k.ID || (kid == "" && k.IsSymmetric()) {
+		return k.Method, k.public, nil
+	}
+	return nil, nil, ErrUnknownKeyID
+}
+
+// IsSymmetric reports whether the key is a shared HMAC secret
+func (k *SigningKey) IsSymmetric() bool {
+	_, ok := k.private.([]byte)
+	return ok
+}
+
+// JWK returns the public key as a JWK; symmetric keys have none and report false
+func (k *SigningKey) JWK() (JWK, bool) {
+	jwk := JWK{Use: "sig", Alg: k.Method.Alg(), Kid: k.ID}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64URL(public.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = base64URL(public.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64URL(public.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64URL(public)
+	}
+	return jwk, jwk.Kty != ""
+}
+
+// jwkThumbprint computes the RFC 7638 SHA-256 thumbprint of a public key, used as its kid
+// json.Marshal sorts map keys, which yields the required lexicographic member order
+func jwkThumbprint(jwk JWK) (string, error) {
+	members := map[string]string{"kty": jwk.Kty}
+	switch jwk.Kty {
+	case "RSA":
+		members["e"], members["n"] = jwk.E, jwk.N
+	case "EC":
+		members["crv"], members["x"], members["y"] = jwk.Crv, jwk.X, jwk.Y
+	case "OKP":
+		members["crv"], members["x"] = jwk.Crv, jwk.X
+	default:
+		return "", fmt.Errorf("cannot compute thumbprint of key type %q", jwk.Kty)
+	}
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return base64URL(sum[:]), nil
+}
+
+func base64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM stores a private key the way operators provide it, and returns the file path
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "signing-key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func pkcs8(t *testing.T, key crypto.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return der
+}
+
+// publicKeyFromJWK rebuilds the public key a downstream service would get from the JWKS
+func publicKeyFromJWK(t *testing.T, jwk JWK) interface{} {
+	decode := func(value string) []byte {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		require.NoError(t, err)
+		return data
+	}
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "EC":
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(decode(jwk.X)), Y: new(big.Int).SetBytes(decode(jwk.Y))}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("unexpected key type %q", jwk.Kty)
+	return nil
+}
+
+func TestAsymmetricSigningKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		blockType string
+		der       []byte
+		alg       string
+	}{
+		{name: "RSA PKCS #8", blockType: "PRIVATE KEY", der: pkcs8(t, rsaKey), alg: "RS256"},
+		{name: "RSA PKCS #1", blockType: "RSA PRIVATE KEY", der: x509.MarshalPKCS1PrivateKey(rsaKey), alg: "RS256"},
+		{name: "EC SEC 1", blockType: "EC PRIVATE KEY", der: ecDER, alg: "ES256"},
+		{name: "Ed25519", blockType: "PRIVATE KEY", der: pkcs8(t, edKey), alg: "EdDSA"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadSigningKey(writePEM(t, tt.blockType, tt.der))
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, key.Method.Alg())
+			assert.False(t, key.IsSymmetric())
+
+			signed, err := key.Sign(jwt.MapClaims{"uid": "1", "exp": time.Now().Add(time.Minute).Unix()})
+			require.NoError(t, err)
+			claims, err := middleware.ParseAndValidateJWT(signed, key)
+			require.NoError(t, err)
+			assert.Equal(t, "1", claims["uid"])
+
+			// A verifier holding only the published JWK can check the token
+			jwk, ok := key.JWK()
+			require.True(t, ok)
+			assert.Equal(t, key.ID, jwk.Kid)
+			assert.Equal(t, tt.alg, jwk.Alg)
+			parsed, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+				assert.Equal(t, jwk.Kid, token.Header["kid"])
+				return publicKeyFromJWK(t, jwk), nil
+			}, jwt.WithValidMethods([]string{jwk.Alg}))
+			require.NoError(t, err)
+			assert.True(t, parsed.Valid)
+		})
+	}
+}
+
+func TestSigningKeyRejectsForeignTokens(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(t, ecKey)}))
+	require.NoError(t, err)
+	claims := jwt.MapClaims{"uid": "1", "exp": time.Now().Add(time.Minute).Unix()}
+
+	// An HMAC token claiming the asymmetric key's kid must not be accepted (algorithm confusion)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = key.ID
+	signed, err := forged.SignedString([]byte("attacker-secret"))
+	require.NoError(t, err)
+	_, err = middleware.ParseAndValidateJWT(signed, key)
+	assert.Error(t, err)
+
+	// Tokens of another key, or without a kid, are rejected
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(t, other)}))
+	require.NoError(t, err)
+	signed, err = otherKey.Sign(claims)
+	require.NoError(t, err)
+	_, err = middleware.ParseAndValidateJWT(signed, key)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+	unnamed, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(ecKey)
+	require.NoError(t, err)
+	_, err = middleware.ParseAndValidateJWT(unnamed, key)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	// HMAC tokens issued before kid headers existed are still accepted with the same secret
+	hmacKey := NewHMACSigningKey([]byte("test-jwt-secret-key-32-characters"))
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte("test-jwt-secret-key-32-characters"))
+	require.NoError(t, err)
+	_, err = middleware.ParseAndValidateJWT(legacy, hmacKey)
+	assert.NoError(t, err)
+	_, ok := hmacKey.JWK()
+	assert.False(t, ok, "the shared secret must never be published")
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)}))
+	assert.Error(t, err)
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1
+	thumbprint, err := jwkThumbprint(JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W" +
+			"-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt" +
+			"-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+}
+
+func TestJWKSEndpoint(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(t, edKey)}))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	fetch := func(oauthService *OAuthService) JWKSet {
+		router := gin.New()
+		router.GET("/.well-known/jwks.json", oauthService.HandleJWKS)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var set JWKSet
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+		return set
+	}
+
+	set := fetch(NewOAuthService(setupTestDB(t), Config{JWTSecret: "test-jwt-secret-key-32-characters", SigningKey: key}))
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, key.ID, set.Keys[0].Kid)
+	assert.Equal(t, "OKP", set.Keys[0].Kty)
+
+	set = fetch(NewOAuthService(setupTestDB(t), Config{JWTSecret: "test-jwt-secret-key-32-characters"}))
+	assert.Empty(t, set.Keys)
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Failed sign-ins allowed within loginFailureWindow, per account and per client IP address
+// An address gets more attempts than an account, as users behind one NAT share it.
+const (
+	loginFailureWindow        = 15 * time.Minute
+	maxLoginFailuresPerUser   = 5
+	maxLoginFailuresPerClient = 20
+)
+
+// errTooManyLoginFailures is returned by signIn while the account or the client IP address is throttled
+var errTooManyLoginFailures = errors.New("too many failed sign-in attempts")
+
+// signIn checks the email and password a user entered on a sign-in page
+// Once the account or the client IP address has too many recent failures, sign-in is refused
+// without checking the password until the oldest failures leave loginFailureWindow.
+func (o *OAuthService) signIn(c *gin.Context, email, password string) (*internalmodels.User, error) {
+	account := loginSubject("account", strings.ToLower(email))
+	address := loginSubject("address", c.ClientIP())
+
+	throttled, err := o.loginThrottled(c, account, address)
+	if err != nil {
+		return nil, err
+	}
+	if throttled {
+		return nil, errTooManyLoginFailures
+	}
+
+	user, err := o.authenticateUser(email, password)
+	switch {
+	case errors.Is(err, errInvalidCredentials):
+		o.recordLoginFailure(c, account, address)
+	case err == nil:
+		// Signing in clears the failures of the account, but not of the address others may share
+		if err := o.db.WithContext(c).Where("subject_hash = ?", account).Delete(&internalmodels.LoginFailure{}).Error; err != nil {
+			log.WithError(err).Error("Failed to clear login failures")
+		}
+	}
+	return user, err
+}
+
+// loginThrottled reports whether the account or the address reached its limit of recent failures
+func (o *OAuthService) loginThrottled(c *gin.Context, account, address string) (bool, error) {
+	since := time.Now().Add(-loginFailureWindow)
+	for subject, limit := range map[string]int64{account: maxLoginFailuresPerUser, address: maxLoginFailuresPerClient} {
+		var failures int64
+		err := o.db.WithContext(c).Model(&internalmodels.LoginFailure{}).
+			Where("subject_hash = ? AND created_at > ?", subject, since).
+			Count(&failures).Error
+		if err != nil {
+			return false, fmt.Errorf("failed to count login failures: %w", err)
+		}
+		if failures >= limit {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordLoginFailure counts a failed sign-in against each subject
+func (o *OAuthService) recordLoginFailure(c *gin.Context, subjects ...string) {
+	failures := make([]internalmodels.LoginFailure, 0, len(subjects))
+	for _, subject := range subjects {
+		failures = append(failures, internalmodels.LoginFailure{SubjectHash: subject})
+	}
+	if err := o.db.WithContext(c).Create(&failures).Error; err != nil {
+		log.WithError(err).Error("Failed to record login failure")
+	}
+}
+
+// loginSubject identifies what failures are counted against, without storing it
+func loginSubject(kind, value string) string {
+	return tokenHash("login-" + kind + "\x00" + value)
+}
+
+// signInFailure returns the status and message a sign-in page shows for an error of signIn
+func signInFailure(c *gin.Context, err error) (int, string) {
+	switch {
+	case errors.Is(err, errInvalidCredentials):
+		return http.StatusUnauthorized, "Invalid email or password."
+	case errors.Is(err, errTooManyLoginFailures):
+		c.Header("Retry-After", fmt.Sprint(int(loginFailureWindow.Seconds())))
+		return http.StatusTooManyRequests, "Too many failed sign-in attempts. Please try again later."
+	default:
+		log.WithError(err).Error("Failed to authenticate user")
+		return http.StatusInternalServerError, "Something went wrong, please try again."
+	}
+}
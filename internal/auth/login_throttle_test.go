@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignInThrottling(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user := &models.User{Email: email, Role: "user"}
+		require.NoError(t, user.SetPassword("correct horse battery"))
+		require.NoError(t, db.Create(user).Error)
+	}
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "web", Secret: "x", Scopes: "read", GrantTypes: "authorization_code", RedirectURI: testRedirectURI,
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/oauth/authorize", oauthService.HandleAuthorize)
+
+	signIn := func(address, email, password string) *httptest.ResponseRecorder {
+		params := url.Values{
+			"response_type": {"code"}, "client_id": {"web"}, "scope": {"read"},
+			"code_challenge": {codeChallenge(testCodeVerifier)}, "code_challenge_method": {"S256"},
+			"email": {email}, "password": {password}, "action": {"approve"},
+		}
+		req := httptest.NewRequest("POST", "/oauth/authorize", strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = address + ":40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// An account is locked after maxLoginFailuresPerUser failures, from whichever addresses they came,
+	// and then even the right password is refused
+	for i := 0; i < maxLoginFailuresPerUser; i++ {
+		assert.Equal(t, http.StatusUnauthorized, signIn(fmt.Sprintf("192.0.2.%d", i), "alice@example.com", "wrong password").Code)
+	}
+	w := signIn("192.0.2.100", "Alice@Example.com", "correct horse battery")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "Too many failed sign-in attempts")
+	assert.Equal(t, fmt.Sprint(int(loginFailureWindow.Seconds())), w.Header().Get("Retry-After"))
+
+	// Other accounts are not affected
+	assert.Equal(t, http.StatusFound, signIn("192.0.2.0", "bob@example.com", "correct horse battery").Code)
+
+	// An address is locked after maxLoginFailuresPerClient failures, whichever accounts they were for
+	for i := 0; i < maxLoginFailuresPerClient; i++ {
+		assert.Equal(t, http.StatusUnauthorized, signIn("198.51.100.1", fmt.Sprintf("user%d@example.com", i), "guess").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, signIn("198.51.100.1", "bob@example.com", "correct horse battery").Code)
+	assert.Equal(t, http.StatusFound, signIn("198.51.100.2", "bob@example.com", "correct horse battery").Code)
+
+	// Failures count for loginFailureWindow, and signing in clears those of the account
+	require.NoError(t, db.Model(&models.LoginFailure{}).Where("1 = 1").
+		Update("created_at", time.Now().Add(-loginFailureWindow-time.Second)).Error)
+	assert.Equal(t, http.StatusUnauthorized, signIn("192.0.2.1", "alice@example.com", "wrong password").Code)
+	assert.Equal(t, http.StatusFound, signIn("192.0.2.1", "alice@example.com", "correct horse battery").Code)
+	var remaining int64
+	require.NoError(t, db.Model(&models.LoginFailure{}).Where("subject_hash = ?", loginSubject("account", "alice@example.com")).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+
+	// Every expired failure is purged, except those of the account signing in cleared
+	purged, err := oauthService.PurgeExpiredTokens()
+	require.NoError(t, err)
+	assert.Equal(t, int64(maxLoginFailuresPerUser+2*maxLoginFailuresPerClient), purged)
+}
+
+func TestSignInThrottlingIgnoresForwardedFor(t *testing.T) {
+	db := setupTestDB(t)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	user := &models.User{Email: "alice@example.com", Role: "user"}
+	require.NoError(t, user.SetPassword("correct horse battery"))
+	require.NoError(t, db.Create(user).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "web", Secret: "x", Scopes: "read", GrantTypes: "authorization_code", RedirectURI: testRedirectURI,
+	}).Error)
+
+	// As setupRouter does, X-Forwarded-For is only believed from the proxies of TRUSTED_PROXIES
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies([]string{"10.0.0.1"}))
+	router.POST("/oauth/authorize", oauthService.HandleAuthorize)
+
+	signIn := func(address, forwardedFor, email, password string) *httptest.ResponseRecorder {
+		params := url.Values{
+			"response_type": {"code"}, "client_id": {"web"}, "scope": {"read"},
+			"code_challenge": {codeChallenge(testCodeVerifier)}, "code_challenge_method": {"S256"},
+			"email": {email}, "password": {password}, "action": {"approve"},
+		}
+		req := httptest.NewRequest("POST", "/oauth/authorize", strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = address + ":40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A client claiming a new address on every attempt is still counted by the address it connects from
+	for i := 0; i < maxLoginFailuresPerClient; i++ {
+		assert.Equal(t, http.StatusUnauthorized, signIn("198.51.100.1", fmt.Sprintf("203.0.113.%d", i), fmt.Sprintf("user%d@example.com", i), "guess").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, signIn("198.51.100.1", "203.0.113.200", "alice@example.com", "correct horse battery").Code)
+
+	// Behind a trusted proxy, the address it forwards for is the one counted
+	for i := 0; i < maxLoginFailuresPerClient; i++ {
+		assert.Equal(t, http.StatusUnauthorized, signIn("10.0.0.1", "192.0.2.1", fmt.Sprintf("user%d@example.com", i), "guess").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, signIn("10.0.0.1", "192.0.2.1", "alice@example.com", "correct horse battery").Code)
+	assert.Equal(t, http.StatusFound, signIn("10.0.0.1", "192.0.2.2", "alice@example.com", "correct horse battery").Code)
+}
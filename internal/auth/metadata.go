@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// clientAuthMethods lists how clients authenticate: client_id and client_secret in the form body
+var clientAuthMethods = []string{"client_secret_post"}
+
+// tokenEndpointAuthMethods adds that public clients send only their client_id, for the grants that accept them
+var tokenEndpointAuthMethods = append([]string{"none"}, clientAuthMethods...)
+
+// AuthorizationServerMetadata is the discovery document of the authorization server (RFC 8414)
+type AuthorizationServerMetadata struct {
+	Issuer                                    string   `json:"issuer"`
+	AuthorizationEndpoint                     string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                             string   `json:"token_endpoint,omitempty"`
+	JWKSURI                                   string   `json:"jwks_uri,omitempty"`
+	ScopesSupported                           []string `json:"scopes_supported"`
+	ResponseTypesSupported                    []string `json:"response_types_supported"`
+	GrantTypesSupported                       []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported         []string `json:"token_endpoint_auth_methods_supported"`
+	RevocationEndpoint                        string   `json:"revocation_endpoint,omitempty"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	IntrospectionEndpoint                     string   `json:"introspection_endpoint,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported             []string `json:"code_challenge_methods_supported,omitempty"`
+	DeviceAuthorizationEndpoint               string   `json:"device_authorization_endpoint,omitempty"`
+}
+
+// HandleMetadata serves the discovery document for the routes registered on the router
+// Endpoints are found by their OAuthService handler, so the document follows the routes as they
+// change. Call it after every OAuth route has been registered.
+// @Summary Authorization server metadata
+// @Description OAuth 2.0 Authorization Server Metadata (RFC 8414): the endpoints, grant types, client
+// @Description authentication methods and the scopes registered on clients.
+// @Tags OAuth2
+// @Produce json
+// @Success 200 {object} AuthorizationServerMetadata
+// @Failure 500 {object} map[string]string
+// @Router /.well-known/oauth-authorization-server [get]
+func (o *OAuthService) HandleMetadata(routes gin.RoutesInfo) gin.HandlerFunc {
+	endpoints := serviceEndpoints(routes)
+
+	return func(c *gin.Context) {
+		metadata, err := o.serverMetadata(c, endpoints)
+		if err != nil {
+			log.WithError(err).Error("Failed to load client scopes")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		c.Header("Cache-Control", o.discoveryCacheControl())
+		c.JSON(http.StatusOK, metadata)
+	}
+}
+
+// serverMetadata builds the discovery document from the paths of the OAuthService handlers
+func (o *OAuthService) serverMetadata(c *gin.Context, endpoints map[string]string) (AuthorizationServerMetadata, error) {
+	scopes, err := o.registeredScopes()
+	if err != nil {
+		return AuthorizationServerMetadata{}, err
+	}
+	openID, err := o.openIDAvailable()
+	if err != nil {
+		return AuthorizationServerMetadata{}, err
+	}
+	if !openID {
+		scopes = slices.DeleteFunc(scopes, func(scope string) bool { return scope == internalmodels.ScopeOpenID })
+	}
+
+	issuer := o.issuer(c)
+	endpoint := func(handler string) string {
+		if path, ok := endpoints[handler]; ok {
+			return issuer + path
+		}
+		return ""
+	}
+
+	metadata := AuthorizationServerMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             endpoint("HandleAuthorize"),
+		TokenEndpoint:                     endpoint("HandleToken"),
+		JWKSURI:                           endpoint("HandleJWKS"),
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{},
+		GrantTypesSupported:               o.grantTypes(),
+		TokenEndpointAuthMethodsSupported: tokenEndpointAuthMethods,
+		RevocationEndpoint:                endpoint("HandleRevoke"),
+		IntrospectionEndpoint:             endpoint("HandleIntrospect"),
+		DeviceAuthorizationEndpoint:       endpoint("HandleDeviceAuthorization"),
+	}
+	if metadata.AuthorizationEndpoint != "" {
+		metadata.ResponseTypesSupported = []string{"code"}
+		metadata.CodeChallengeMethodsSupported = []string{"S256"}
+	}
+	if metadata.RevocationEndpoint != "" {
+		metadata.RevocationEndpointAuthMethodsSupported = clientAuthMethods
+	}
+	if metadata.IntrospectionEndpoint != "" {
+		metadata.IntrospectionEndpointAuthMethodsSupported = clientAuthMethods
+	}
+	return metadata, nil
+}
+
+// serviceEndpoints maps the name of each OAuthService handler to the path of its route
+func serviceEndpoints(routes gin.RoutesInfo) map[string]string {
+	const receiver = ".(*OAuthService)."
+	endpoints := make(map[string]string)
+	for _, route := range routes {
+		// Method values are named like "…/internal/auth.(*OAuthService).HandleToken-fm"
+		name := strings.TrimSuffix(route.Handler, "-fm")
+		i := strings.LastIndex(name, receiver)
+		if i < 0 {
+			continue
+		}
+		endpoints[name[i+len(receiver):]] = route.Path
+	}
+	return endpoints
+}
+
+// issuer returns the configured issuer, or the base URL the request was made to
+func (o *OAuthService) issuer(c *gin.Context) string {
+	if o.config.Issuer != "" {
+		return o.config.Issuer
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// discoveryCacheControl returns the Cache-Control of the discovery documents
+// Clients may cache them briefly, as they do the JWKS, but a document built from the Host header
+// of the request must not be stored by shared caches and served to other clients.
+func (o *OAuthService) discoveryCacheControl() string {
+	if o.config.Issuer == "" {
+		return "no-store"
+	}
+	return "public, max-age=300"
+}
+
+// grantTypes returns the grant types accepted at the token endpoint, sorted
+func (o *OAuthService) grantTypes() []string {
+	grants := make([]string, 0, len(o.grantHandlers()))
+	for grant := range o.grantHandlers() {
+		grants = append(grants, grant)
+	}
+	sort.Strings(grants)
+	return grants
+}
+
+// registeredScopes returns every scope some client is registered for, sorted
+func (o *OAuthService) registeredScopes() ([]string, error) {
+	var registrations []string
+	if err := o.db.Model(&internalmodels.OAuthClient{}).Pluck("scopes", &registrations).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	scopes := []string{}
+	for _, registration := range registrations {
+		for _, scope := range internalmodels.SplitScopes(registration) {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizationServerMetadata(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&models.OAuthClient{ID: "admin", Secret: "x", Scopes: "read pizzas:write clients:admin"}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{ID: "user", Secret: "x", Scopes: "openid read orders:write"}).Error)
+
+	gin.SetMode(gin.TestMode)
+	fetch := func(oauthService *OAuthService) (AuthorizationServerMetadata, string) {
+		router := gin.New()
+		router.GET("/.well-known/jwks.json", oauthService.HandleJWKS)
+		oauthRoutes := router.Group("/api/v1/oauth")
+		oauthRoutes.POST("/token", oauthService.HandleToken)
+		oauthRoutes.POST("/revoke", oauthService.HandleRevoke)
+		router.GET("/.well-known/oauth-authorization-server", oauthService.HandleMetadata(router.Routes()))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/oauth-authorization-server", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var metadata AuthorizationServerMetadata
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+		return metadata, w.Header().Get("Cache-Control")
+	}
+
+	// Endpoints come from the registered routes, on the host the request was made to
+	metadata, cacheControl := fetch(NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"}))
+	assert.Equal(t, "http://example.com", metadata.Issuer)
+	assert.Equal(t, "no-store", cacheControl, "a document built from the Host header is not cached")
+	assert.Equal(t, "http://example.com/api/v1/oauth/token", metadata.TokenEndpoint)
+	assert.Equal(t, "http://example.com/api/v1/oauth/revoke", metadata.RevocationEndpoint)
+	assert.Equal(t, "http://example.com/.well-known/jwks.json", metadata.JWKSURI)
+	assert.Empty(t, metadata.IntrospectionEndpoint, "unregistered endpoints are left out")
+	assert.Empty(t, metadata.IntrospectionEndpointAuthMethodsSupported)
+	assert.Equal(t, []string{"authorization_code", "client_credentials", "refresh_token", DeviceCodeGrantType}, metadata.GrantTypesSupported)
+	assert.Equal(t, []string{"none", "client_secret_post"}, metadata.TokenEndpointAuthMethodsSupported)
+	assert.Equal(t, []string{"clients:admin", "orders:write", "pizzas:write", "read"}, metadata.ScopesSupported,
+		"openid is left out while the active key is HS512")
+
+	metadata, cacheControl = fetch(NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters", Issuer: "https://pizza.example"}))
+	assert.Equal(t, "https://pizza.example", metadata.Issuer)
+	assert.Equal(t, "public, max-age=300", cacheControl)
+	assert.Equal(t, "https://pizza.example/api/v1/oauth/token", metadata.TokenEndpoint)
+}
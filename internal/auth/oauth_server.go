@@ -1,27 +1,93 @@
 package auth
 
 import (
+	"time"
+
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/go-oauth2/oauth2/v4"
 	"github.com/go-oauth2/oauth2/v4/manage"
 	"github.com/go-oauth2/oauth2/v4/server"
-	"github.com/go-oauth2/oauth2/v4/store"
-	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
+// Default token lifetimes, used when Config leaves them unset
+const (
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Config holds the settings of the OAuth2 authorization server
+type Config struct {
+	// Issuer is the public base URL of the server; when empty it is taken from the Host header of
+	// each request, which only a development server can trust
+	Issuer string
+	// JWTSecret encrypts the stored signing keys, so it must stay the same across restarts
+	JWTSecret string
+	// SigningKey seeds the key ring when it has no active key; when nil the ring is seeded
+	// with an HS512 key using JWTSecret. Later changes only take effect by rotating the ring.
+	SigningKey *SigningKey
+	// AccessTokenTTL is the lifetime of access tokens
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is the lifetime of each refresh token; every refresh issues a new one
+	RefreshTokenTTL time.Duration
+	// DenylistSyncInterval bounds how long revocations made on other replicas take to apply
+	DenylistSyncInterval time.Duration
+	// KeyRingSyncInterval bounds how long key rotations made on other replicas take to apply
+	KeyRingSyncInterval time.Duration
+}
+
 type OAuthService struct {
-	server *server.Server
-	db     *gorm.DB
+	server      *server.Server
+	db          *gorm.DB
+	tokenStore  *GormTokenStore
+	clientStore *GormClientStore
+	generator   *CustomJWTAccessGenerate
+	denylist    *Denylist
+	keyRing     *KeyRing
+	config      Config
 }
 
-func NewOAuthService(db *gorm.DB, jwtSecret string) *OAuthService {
+func NewOAuthService(db *gorm.DB, config Config) *OAuthService {
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	if config.SigningKey == nil {
+		config.SigningKey = NewHMACSigningKey([]byte(config.JWTSecret))
+	}
+
 	manager := manage.NewDefaultManager()
 
+	// Tokens are signed with the active key of the ring shared by every replica
+	keyRing := NewKeyRing(db, config.JWTSecret, config.SigningKey, config.KeyRingSyncInterval)
+
 	// Use our custom JWT generator that includes the UserID and Role claims
 	// Pass the database connection so it can fetch user information
-	manager.MapAccessGenerate(NewCustomJWTAccessGenerate([]byte(jwtSecret), jwt.SigningMethodHS512, db))
+	generator := NewCustomJWTAccessGenerate(keyRing, db)
+	manager.MapAccessGenerate(generator)
 
-	// Use in-memory token store (required by OAuth2 library even with stateless JWTs)
-	tokenStore, _ := store.NewMemoryTokenStore()
+	// Client credentials tokens come with a refresh token that can be rotated at the token endpoint
+	manager.SetClientTokenCfg(&manage.Config{
+		AccessTokenExp:    config.AccessTokenTTL,
+		RefreshTokenExp:   config.RefreshTokenTTL,
+		IsGenerateRefresh: true,
+	})
+
+	// Users authorizing a client get the same token lifetimes; the redirect URI of a code is matched
+	// exactly against the client registration in HandleAuthorize, not against the client's domain
+	manager.SetAuthorizeCodeTokenCfg(&manage.Config{
+		AccessTokenExp:    config.AccessTokenTTL,
+		RefreshTokenExp:   config.RefreshTokenTTL,
+		IsGenerateRefresh: true,
+	})
+	manager.SetValidateURIHandler(func(baseURI, redirectURI string) error { return nil })
+	manager.SetExtractExtensionHandler(extractNonce)
+
+	// Persist issued tokens in the database so they survive restarts and are shared by all replicas
+	denylist := NewDenylist(db, config.DenylistSyncInterval)
+	tokenStore := NewGormTokenStore(db, denylist)
 	manager.MapTokenStorage(tokenStore)
 
 	// Configure client store
@@ -32,16 +98,65 @@ func NewOAuthService(db *gorm.DB, jwtSecret string) *OAuthService {
 	srv.SetAllowGetAccessRequest(true)
 	srv.SetClientInfoHandler(server.ClientFormHandler)
 
+	// Authorization codes can only be redeemed with the PKCE code_verifier (RFC 7636)
+	srv.Config.ForcePKCE = true
+	srv.Config.AllowedCodeChallengeMethods = []oauth2.CodeChallengeMethod{oauth2.CodeChallengeS256}
+
 	// The OAuth2 v4.5.4 library automatically detects that our OAuthClient
 	// implements ClientPasswordVerifier and uses the VerifyPassword method
 	// No additional configuration needed!
 
-	return &OAuthService{
-		server: srv,
-		db:     db,
+	o := &OAuthService{
+		server:      srv,
+		db:          db,
+		tokenStore:  tokenStore,
+		clientStore: clientStore,
+		generator:   generator,
+		denylist:    denylist,
+		keyRing:     keyRing,
+		config:      config,
 	}
+
+	// Tokens are only issued for the grant types and scopes the client is registered for
+	srv.SetClientAuthorizedHandler(o.clientAuthorized)
+	srv.SetClientScopeHandler(o.clientScope)
+
+	return o
 }
 
 func (o *OAuthService) GetServer() *server.Server {
 	return o.server
 }
+
+// KeyRing returns the keys that sign and verify tokens, which resource servers use to verify them
+func (o *OAuthService) KeyRing() *KeyRing {
+	return o.keyRing
+}
+
+// Denylist returns the revoked access tokens, which resource servers must reject
+func (o *OAuthService) Denylist() *Denylist {
+	return o.denylist
+}
+
+// PurgeExpiredTokens deletes stored token information, revocations, retired signing keys, device
+// authorizations and login failures that have fully expired and returns how many entries were removed
+func (o *OAuthService) PurgeExpiredTokens() (int64, error) {
+	tokens, err := o.tokenStore.PurgeExpired()
+	if err != nil {
+		return tokens, err
+	}
+	revocations, err := o.denylist.PurgeExpired()
+	if err != nil {
+		return tokens + revocations, err
+	}
+	keys, err := o.keyRing.PurgeExpired()
+	if err != nil {
+		return tokens + revocations + keys, err
+	}
+	devices := o.db.Where("expires_at <= ?", time.Now()).Delete(&internalmodels.DeviceAuthorization{})
+	if devices.Error != nil {
+		return tokens + revocations + keys, devices.Error
+	}
+	failures := o.db.Where("created_at <= ?", time.Now().Add(-loginFailureWindow)).Delete(&internalmodels.LoginFailure{})
+	return tokens + revocations + keys + devices.RowsAffected + failures.RowsAffected, failures.Error
+}
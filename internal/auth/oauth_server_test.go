@@ -17,7 +17,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
-	err = db.AutoMigrate(&models.User{}, &models.OAuthClient{})
+	err = db.AutoMigrate(&models.User{}, &models.OAuthClient{}, &models.OAuthToken{}, &models.RevokedToken{}, &models.SigningKeyRecord{}, &models.DeviceAuthorization{}, &models.LoginFailure{})
 	require.NoError(t, err)
 
 	return db
@@ -27,7 +27,7 @@ func TestOAuthServerInitialization(t *testing.T) {
 	db := setupTestDB(t)
 
 	// Fix: NewOAuthService requires jwtSecret parameter
-	oauthService := NewOAuthService(db, "test-jwt-secret-key-32-characters")
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
 	assert.NotNil(t, oauthService)
 	assert.NotNil(t, oauthService.GetServer())
 }
@@ -36,7 +36,7 @@ func TestJWTTokenGeneration(t *testing.T) {
 	db := setupTestDB(t)
 
 	// Fix: Provide JWT secret parameter
-	oauthService := NewOAuthService(db, "test-jwt-secret-key-32-characters")
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
 	require.NotNil(t, oauthService)
 
 	// Create a test user first (required for token generation)
@@ -57,7 +57,7 @@ func TestJWTTokenGeneration(t *testing.T) {
 		ID:         "test_client",
 		Secret:     string(hashedSecret), // Store bcrypt hash
 		Domain:     "http://localhost",
-		Scopes:     "read,write",
+		Scopes:     "read write",
 		UserID:     testUser.ID, // Associate with user
 		GrantTypes: "client_credentials",
 	}
@@ -70,7 +70,7 @@ func TestJWTTokenGeneration(t *testing.T) {
 		ClientID:     "test_client",
 		ClientSecret: "test_secret",
 		UserID:       "", // Will be populated from client's UserID
-		Scope:        "read,write",
+		Scope:        "read write",
 	}
 
 	// Generate access token through the OAuth server
@@ -93,7 +93,7 @@ func TestClientStoreIntegration(t *testing.T) {
 		ID:     "integration_test_client",
 		Secret: "integration_test_secret",
 		Domain: "http://localhost:8080",
-		Scopes: "read,write",
+		Scopes: "read write",
 	}
 	err := db.Create(client).Error
 	require.NoError(t, err)
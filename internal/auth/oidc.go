@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	internalmodels "github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// oidcScopes are the OpenID Connect scopes: openid asks for an ID token, profile and email for claims
+var oidcScopes = []string{internalmodels.ScopeOpenID, internalmodels.ScopeProfile, internalmodels.ScopeEmail}
+
+// OpenIDProviderMetadata is the OpenID Connect discovery document (OpenID Connect Discovery 1.0)
+// It extends the authorization server metadata with the OpenID Connect fields.
+type OpenIDProviderMetadata struct {
+	AuthorizationServerMetadata
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// HandleOpenIDConfiguration serves the OpenID Connect discovery document for the routes registered on the router
+// Like HandleMetadata, call it after every OAuth route has been registered.
+// @Summary OpenID Provider configuration
+// @Description OpenID Connect Discovery 1.0: the authorization server metadata plus the userinfo endpoint,
+// @Description the ID token signing algorithm and the claims ID tokens and userinfo responses carry.
+// @Tags OAuth2
+// @Produce json
+// @Success 200 {object} OpenIDProviderMetadata
+// @Failure 404 {object} map[string]string "The active signing key is symmetric, so ID tokens cannot be issued"
+// @Failure 500 {object} map[string]string
+// @Router /.well-known/openid-configuration [get]
+func (o *OAuthService) HandleOpenIDConfiguration(routes gin.RoutesInfo) gin.HandlerFunc {
+	endpoints := serviceEndpoints(routes)
+
+	return func(c *gin.Context) {
+		metadata, err := o.serverMetadata(c, endpoints)
+		if err != nil {
+			log.WithError(err).Error("Failed to load client scopes")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		key, err := o.keyRing.Active()
+		if err != nil {
+			log.WithError(err).Error("Failed to load the active signing key")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if key.IsSymmetric() {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":             "not_found",
+				"error_description": "OpenID Connect is unavailable: ID tokens require an asymmetric signing key",
+			})
+			return
+		}
+
+		// The OpenID Connect scopes are always supported, whether or not a client registered them yet
+		metadata.ScopesSupported = mergeScopes(metadata.ScopesSupported, oidcScopes)
+		configuration := OpenIDProviderMetadata{
+			AuthorizationServerMetadata:      metadata,
+			SubjectTypesSupported:            []string{"public"},
+			IDTokenSigningAlgValuesSupported: []string{key.Method.Alg()},
+			ClaimsSupported:                  []string{"sub", "iss", "aud", "exp", "iat", "nonce", "email", "name"},
+		}
+		if path, ok := endpoints["HandleUserInfo"]; ok {
+			configuration.UserinfoEndpoint = metadata.Issuer + path
+		}
+
+		c.Header("Cache-Control", o.discoveryCacheControl())
+		c.JSON(http.StatusOK, configuration)
+	}
+}
+
+// openIDAvailable reports whether ID tokens can be issued
+// Clients verify ID tokens against the JWKS, which only publishes asymmetric keys. Verifying an
+// HMAC signed ID token would take the secret that signs every access token, so with an HMAC
+// active key the openid scope is refused and there is no OpenID Connect discovery document.
+func (o *OAuthService) openIDAvailable() (bool, error) {
+	key, err := o.keyRing.Active()
+	if err != nil {
+		return false, err
+	}
+	return !key.IsSymmetric(), nil
+}
+
+// HandleUserInfo returns the claims about the user an access token was issued for (OpenID Connect Core 5.3)
+// It must run after OAuth2Auth and RequireScope(openid). The profile and email scopes of the token
+// select the claims, as they do for the ID token.
+// @Summary UserInfo Endpoint
+// @Description Claims about the signed in user: sub, plus name with the profile scope and email with the email scope.
+// @Tags OAuth2
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /oauth/userinfo [get]
+// @Router /oauth/userinfo [post]
+func (o *OAuthService) HandleUserInfo(c *gin.Context) {
+	var user internalmodels.User
+	err := o.db.WithContext(c).First(&user, c.GetUint("userID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token", error_description="The user no longer exists"`)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":             "invalid_token",
+			"error_description": "The user no longer exists",
+		})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to load user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, userClaims(&user, c.GetString("scopes")))
+}
+
+// tokenResponse returns the token endpoint response for the token, with an ID token when one was asked for
+func (o *OAuthService) tokenResponse(c *gin.Context, ti oauth2.TokenInfo) (gin.H, error) {
+	response := gin.H(o.server.GetTokenData(ti))
+	idToken, err := o.idToken(c, ti)
+	if err != nil {
+		return nil, err
+	}
+	if idToken != "" {
+		response["id_token"] = idToken
+	}
+	return response, nil
+}
+
+// idToken signs an ID token for the user of a token granted the openid scope (OpenID Connect Core 2)
+// Client credentials tokens have no user, so they never get one. The nonce of the authorization
+// request is returned in the ID token issued for its code. A token granted openid before the key
+// ring was rotated to an HMAC key gets no ID token when it is refreshed.
+func (o *OAuthService) idToken(c *gin.Context, ti oauth2.TokenInfo) (string, error) {
+	if ti.GetUserID() == "" || !scopeWithin(internalmodels.ScopeOpenID, ti.GetScope()) {
+		return "", nil
+	}
+	key, err := o.keyRing.Active()
+	if err != nil || key.IsSymmetric() {
+		return "", err
+	}
+
+	var user internalmodels.User
+	if err := o.db.WithContext(c).Where("id = ?", ti.GetUserID()).First(&user).Error; err != nil {
+		return "", fmt.Errorf("failed to load user %s: %w", ti.GetUserID(), err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims(userClaims(&user, ti.GetScope()))
+	claims["iss"] = o.issuer(c)
+	claims["aud"] = ti.GetClientID()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(o.config.AccessTokenTTL).Unix()
+	if extendable, ok := ti.(oauth2.ExtendableTokenInfo); ok {
+		if nonce := extendable.GetExtension().Get("nonce"); nonce != "" {
+			claims["nonce"] = nonce
+		}
+	}
+
+	return key.Sign(claims)
+}
+
+// userClaims returns the standard claims of the user that the scopes grant access to
+func userClaims(user *internalmodels.User, scope string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": fmt.Sprint(user.ID)}
+	if scopeWithin(internalmodels.ScopeProfile, scope) {
+		claims["name"] = user.Name
+	}
+	if scopeWithin(internalmodels.ScopeEmail, scope) {
+		claims["email"] = user.Email
+	}
+	return claims
+}
+
+// extractNonce keeps the nonce of an authorization request with its code, for the ID token
+// Only authorization requests carry a code challenge, so token requests cannot set a nonce.
+func extractNonce(tgr *oauth2.TokenGenerateRequest, ti oauth2.ExtendableTokenInfo) {
+	if tgr.CodeChallenge == "" || tgr.Request == nil {
+		return
+	}
+	if nonce := tgr.Request.FormValue("nonce"); nonce != "" {
+		ti.SetExtension(url.Values{"nonce": {nonce}})
+	}
+}
+
+// mergeScopes adds the extra scopes that are missing to the scopes, sorted
+func mergeScopes(scopes, extra []string) []string {
+	merged := append([]string{}, scopes...)
+	for _, scope := range extra {
+		if !scopeWithin(scope, strings.Join(scopes, " ")) {
+			merged = append(merged, scope)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
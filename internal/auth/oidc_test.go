@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/middleware"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOpenIDConnect(t *testing.T) {
+	db := setupTestDB(t)
+	signingKey, err := GenerateSigningKey("ES256")
+	require.NoError(t, err)
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters", SigningKey: signingKey})
+
+	user := &models.User{Email: "alice@example.com", Name: "Alice Liddell", Role: "user"}
+	require.NoError(t, user.SetPassword("correct horse battery"))
+	require.NoError(t, db.Create(user).Error)
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte("web_secret"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "web", Secret: string(hashedSecret), Scopes: "openid profile email read",
+		GrantTypes: "authorization_code refresh_token", RedirectURI: testRedirectURI,
+	}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "machine", Secret: string(hashedSecret), UserID: user.ID, Scopes: "openid read", GrantTypes: "client_credentials",
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", oauthService.HandleJWKS)
+	oauthRoutes := router.Group("/api/v1/oauth")
+	oauthRoutes.POST("/authorize", oauthService.HandleAuthorize)
+	oauthRoutes.POST("/token", oauthService.HandleToken)
+	oauthRoutes.GET("/userinfo", middleware.OAuth2Auth(oauthService.KeyRing(), oauthService.Denylist()),
+		middleware.RequireScope(models.ScopeOpenID), oauthService.HandleUserInfo)
+	router.GET("/.well-known/openid-configuration", oauthService.HandleOpenIDConfiguration(router.Routes()))
+
+	post := func(path string, params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	token := func(params url.Values) map[string]interface{} {
+		params.Set("client_secret", "web_secret")
+		w := post("/api/v1/oauth/token", params)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+	// signIn runs the authorization code flow for the scope and returns the token response
+	signIn := func(scope, nonce string) map[string]interface{} {
+		w := post("/api/v1/oauth/authorize", url.Values{
+			"response_type": {"code"}, "client_id": {"web"}, "scope": {scope}, "nonce": {nonce},
+			"code_challenge": {codeChallenge(testCodeVerifier)}, "code_challenge_method": {"S256"},
+			"email": {"alice@example.com"}, "password": {"correct horse battery"}, "action": {"approve"},
+		})
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		return token(url.Values{
+			"grant_type": {"authorization_code"}, "client_id": {"web"}, "code": {location.Query().Get("code")},
+			"redirect_uri": {testRedirectURI}, "code_verifier": {testCodeVerifier},
+		})
+	}
+	idClaims := func(response map[string]interface{}) map[string]interface{} {
+		idToken, ok := response["id_token"].(string)
+		require.True(t, ok, "response has an id_token")
+		claims, err := middleware.ParseAndValidateJWT(idToken, oauthService.KeyRing())
+		require.NoError(t, err)
+		return claims
+	}
+	userinfo := func(accessToken interface{}) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/oauth/userinfo", nil)
+		req.Header.Set("Authorization", fmt.Sprint("Bearer ", accessToken))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The ID token identifies the user to the client, with the claims of the requested scopes
+	response := signIn("openid email", "n-0S6_WzA2Mj")
+	claims := idClaims(response)
+	assert.Equal(t, fmt.Sprint(user.ID), claims["sub"])
+	assert.Equal(t, "http://example.com", claims["iss"])
+	assert.Equal(t, "web", claims["aud"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.NotContains(t, claims, "name")
+
+	w := userinfo(response["access_token"])
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, fmt.Sprintf(`{"sub": "%d", "email": "alice@example.com"}`, user.ID), w.Body.String())
+
+	// Refreshing keeps the user's ID token coming, without the nonce of the original request
+	refreshed := token(url.Values{"grant_type": {"refresh_token"}, "client_id": {"web"}, "refresh_token": {response["refresh_token"].(string)}})
+	claims = idClaims(refreshed)
+	assert.Equal(t, fmt.Sprint(user.ID), claims["sub"])
+	assert.NotContains(t, claims, "nonce")
+
+	response = signIn("openid profile", "")
+	claims = idClaims(response)
+	assert.Equal(t, "Alice Liddell", claims["name"])
+	assert.NotContains(t, claims, "email")
+	assert.NotContains(t, claims, "nonce")
+
+	// Without the openid scope there is no ID token, and no userinfo
+	response = signIn("read", "")
+	assert.NotContains(t, response, "id_token")
+	assert.Equal(t, http.StatusForbidden, userinfo(response["access_token"]).Code)
+
+	// Client credentials tokens have no signed in user
+	response = token(url.Values{"grant_type": {"client_credentials"}, "client_id": {"machine"}, "scope": {"openid read"}})
+	assert.NotContains(t, response, "id_token")
+
+	// The discovery document adds the OpenID Connect fields to the authorization server metadata
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/openid-configuration", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var configuration OpenIDProviderMetadata
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &configuration))
+	assert.Equal(t, "http://example.com", configuration.Issuer)
+	assert.Equal(t, "http://example.com/api/v1/oauth/authorize", configuration.AuthorizationEndpoint)
+	assert.Equal(t, "http://example.com/api/v1/oauth/token", configuration.TokenEndpoint)
+	assert.Equal(t, "http://example.com/api/v1/oauth/userinfo", configuration.UserinfoEndpoint)
+	assert.Equal(t, "http://example.com/.well-known/jwks.json", configuration.JWKSURI)
+	assert.Equal(t, []string{"code"}, configuration.ResponseTypesSupported)
+	assert.Equal(t, []string{"public"}, configuration.SubjectTypesSupported)
+	assert.Equal(t, []string{"ES256"}, configuration.IDTokenSigningAlgValuesSupported)
+	assert.Equal(t, []string{"email", "openid", "profile", "read"}, configuration.ScopesSupported)
+	assert.Contains(t, configuration.ClaimsSupported, "sub")
+}
+
+func TestOpenIDConnectRequiresAsymmetricKey(t *testing.T) {
+	db := setupTestDB(t)
+	// Without a signing key the ring is seeded with an HS512 key, which clients cannot verify ID tokens with
+	oauthService := NewOAuthService(db, Config{JWTSecret: "test-jwt-secret-key-32-characters"})
+
+	user := &models.User{Email: "alice@example.com", Name: "Alice Liddell", Role: "user"}
+	require.NoError(t, user.SetPassword("correct horse battery"))
+	require.NoError(t, db.Create(user).Error)
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte("web_secret"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.OAuthClient{
+		ID: "web", Secret: string(hashedSecret), Scopes: "openid profile read",
+		GrantTypes: "authorization_code client_credentials " + DeviceCodeGrantType, RedirectURI: testRedirectURI,
+	}).Error)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	oauthRoutes := router.Group("/api/v1/oauth")
+	oauthRoutes.POST("/authorize", oauthService.HandleAuthorize)
+	oauthRoutes.POST("/token", oauthService.HandleToken)
+	oauthRoutes.POST("/device_authorization", oauthService.HandleDeviceAuthorization)
+	router.GET("/.well-known/openid-configuration", oauthService.HandleOpenIDConfiguration(router.Routes()))
+
+	post := func(path string, params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(params.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	authorize := func(scope string) url.Values {
+		w := post("/api/v1/oauth/authorize", url.Values{
+			"response_type": {"code"}, "client_id": {"web"}, "scope": {scope},
+			"code_challenge": {codeChallenge(testCodeVerifier)}, "code_challenge_method": {"S256"},
+			"email": {"alice@example.com"}, "password": {"correct horse battery"}, "action": {"approve"},
+		})
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		location, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		return location.Query()
+	}
+
+	// Asking for openid is refused by every grant
+	query := authorize("openid profile")
+	assert.Equal(t, "invalid_scope", query.Get("error"))
+	assert.Contains(t, query.Get("error_description"), "asymmetric signing key")
+	w := post("/api/v1/oauth/device_authorization", url.Values{"client_id": {"web"}, "client_secret": {"web_secret"}, "scope": {"openid"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_scope")
+	w = post("/api/v1/oauth/token", url.Values{"grant_type": {"client_credentials"}, "client_id": {"web"}, "client_secret": {"web_secret"}, "scope": {"openid read"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_scope")
+
+	// Omitting the scope grants every other scope the client is registered for, without an ID token
+	w = post("/api/v1/oauth/token", url.Values{
+		"grant_type": {"authorization_code"}, "client_id": {"web"}, "client_secret": {"web_secret"},
+		"code": {authorize("").Get("code")}, "redirect_uri": {testRedirectURI}, "code_verifier": {testCodeVerifier},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var token map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+	assert.Equal(t, "profile read", token["scope"])
+	assert.NotContains(t, token, "id_token")
+
+	// and the server does not claim to be an OpenID Provider
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/openid-configuration", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "HS512")
+}
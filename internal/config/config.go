@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -30,14 +33,31 @@ func init() {
 // Config used for the application configuration, loading the input from environment variables
 type Config struct {
 	// Server Configuration
-	Port int    `json:"port"`
-	Host string `json:"host"`
+	Environment string `json:"environment"` // APP_ENV: development, staging or production
+	Port        int    `json:"port"`
+	Host        string `json:"host"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies whose X-Forwarded-For header
+	// is believed; with none, the client IP address is always the address of the connection
+	TrustedProxies []string `json:"trusted_proxies"`
 
 	// Logging configuration
 	LogLevel string `json:"log_level"`
 
 	// Security Configuration
-	JWTSecret string `json:"jwt_secret"`
+	JWTSecret         string        `json:"jwt_secret"`
+	JWTSigningKeyFile string        `json:"jwt_signing_key_file"` // PEM private key for RS256/ES256/EdDSA; HS512 with JWTSecret when empty
+	AccessTokenTTL    time.Duration `json:"access_token_ttl"`     // Lifetime of OAuth access tokens
+	RefreshTokenTTL   time.Duration `json:"refresh_token_ttl"`    // Lifetime of each rotated OAuth refresh token
+	OAuthIssuer       string        `json:"oauth_issuer"`         // Public base URL of the authorization server; required outside development
+
+	// Pricing Configuration
+	DefaultCurrency string `json:"default_currency"` // ISO 4217 code for prices submitted without a currency
+
+	// HTTP Caching Configuration
+	PublicCacheControl string `json:"public_cache_control"` // Cache-Control directives of the public pizza endpoints
+
+	// Idempotency Configuration
+	IdempotencyKeyTTL time.Duration `json:"idempotency_key_ttl"` // How long responses to Idempotency-Key requests are replayed
 
 	// Database Configuration
 	DBDriver   string `json:"db_driver"` // postgres or sqlite
@@ -56,8 +76,8 @@ type Config struct {
 
 // String returns a string representation of Config with sensitive data masked
 func (c *Config) String() string {
-	return fmt.Sprintf("Config{Port: %d, Host: %s, LogLevel: %s, JWTSecret: [REDACTED], DBDriver: %s, DBHost: %s, DBPort: %s, DBUser: %s, DBPassword: [REDACTED], DBName: %s, DBSSLMode: %s, DBPath: %s, BootstrapClientID: %s, BootstrapClientSecret: [REDACTED]}",
-		c.Port, c.Host, c.LogLevel, c.DBDriver, c.DBHost, c.DBPort, c.DBUser, c.DBName, c.DBSSLMode, c.DBPath, c.BootstrapClientID)
+	return fmt.Sprintf("Config{Environment: %s, Port: %d, Host: %s, TrustedProxies: %v, LogLevel: %s, JWTSecret: [REDACTED], JWTSigningKeyFile: %s, AccessTokenTTL: %s, RefreshTokenTTL: %s, OAuthIssuer: %s, DefaultCurrency: %s, PublicCacheControl: %s, IdempotencyKeyTTL: %s, DBDriver: %s, DBHost: %s, DBPort: %s, DBUser: %s, DBPassword: [REDACTED], DBName: %s, DBSSLMode: %s, DBPath: %s, BootstrapClientID: %s, BootstrapClientSecret: [REDACTED]}",
+		c.Environment, c.Port, c.Host, c.TrustedProxies, c.LogLevel, c.JWTSigningKeyFile, c.AccessTokenTTL, c.RefreshTokenTTL, c.OAuthIssuer, c.DefaultCurrency, c.PublicCacheControl, c.IdempotencyKeyTTL, c.DBDriver, c.DBHost, c.DBPort, c.DBUser, c.DBName, c.DBSSLMode, c.DBPath, c.BootstrapClientID)
 }
 
 // LoadConfig read the proper configuration from environment variables and returns a Config struct
@@ -69,11 +89,42 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	accessTokenTTL, err := time.ParseDuration(GetEnvWithDefault("ACCESS_TOKEN_TTL", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACCESS_TOKEN_TTL: %w", err)
+	}
+
+	refreshTokenTTL, err := time.ParseDuration(GetEnvWithDefault("REFRESH_TOKEN_TTL", "168h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REFRESH_TOKEN_TTL: %w", err)
+	}
+
+	idempotencyKeyTTL, err := time.ParseDuration(GetEnvWithDefault("IDEMPOTENCY_KEY_TTL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_KEY_TTL: %w", err)
+	}
+
 	config := &Config{
-		Port:      port,
-		Host:      GetEnvWithDefault("APP_HOST", "localhost"),
-		LogLevel:  GetEnvWithDefault("LOG_LEVEL", "info"),
-		JWTSecret: GetEnvWithDefault("JWT_SECRET", "secret"),
+		Environment: GetEnvWithDefault("APP_ENV", "development"),
+		Port:        port,
+		Host:        GetEnvWithDefault("APP_HOST", "localhost"),
+		LogLevel:    GetEnvWithDefault("LOG_LEVEL", "info"),
+		JWTSecret:   GetEnvWithDefault("JWT_SECRET", "secret"),
+
+		TrustedProxies: splitList(os.Getenv("TRUSTED_PROXIES")),
+
+		JWTSigningKeyFile: os.Getenv("JWT_SIGNING_KEY_FILE"),
+
+		AccessTokenTTL:  accessTokenTTL,
+		RefreshTokenTTL: refreshTokenTTL,
+		OAuthIssuer:     strings.TrimSuffix(os.Getenv("OAUTH_ISSUER"), "/"),
+
+		DefaultCurrency: GetEnvWithDefault("DEFAULT_CURRENCY", "USD"),
+
+		// Clients may reuse responses but must revalidate them, which is cheap thanks to ETags
+		PublicCacheControl: GetEnvWithDefault("PUBLIC_CACHE_CONTROL", "public, no-cache"),
+
+		IdempotencyKeyTTL: idempotencyKeyTTL,
 
 		// Database Configuration
 		DBDriver:   GetEnvWithDefault("DB_DRIVER", "sqlite"),
@@ -89,10 +140,33 @@ func LoadConfig() (*Config, error) {
 		BootstrapClientID:     GetEnvWithDefault("BOOTSTRAP_CLIENT_ID", "admin-client"),
 		BootstrapClientSecret: GetEnvWithDefault("BOOTSTRAP_CLIENT_SECRET", ""),
 	}
+
+	// Without a configured issuer, the discovery documents, ID tokens and device verification URIs
+	// name whatever host the request was sent to, which only a development server can trust
+	if config.OAuthIssuer == "" && config.Environment != "development" {
+		return nil, fmt.Errorf("OAUTH_ISSUER is required when APP_ENV is %s", config.Environment)
+	}
+	if config.OAuthIssuer != "" {
+		issuer, err := url.Parse(config.OAuthIssuer)
+		if err != nil || issuer.Scheme == "" || issuer.Host == "" {
+			return nil, fmt.Errorf("invalid OAUTH_ISSUER %q: must be an absolute URL", config.OAuthIssuer)
+		}
+	}
 	log.Infof("Configuration loaded: %s", config.String())
 	return config, nil
 }
 
+// splitList splits a comma-separated environment variable, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Helper to get environment with default values
 func GetEnvWithDefault(key, defaultValue string) string {
 	log.Tracef("Getting environment variable: %s", key)
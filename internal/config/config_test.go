@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestGetEnvWithDefault(t *testing.T) {
@@ -114,6 +115,60 @@ func TestLoadConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("should fail with invalid token lifetime", func(t *testing.T) {
+		cleanupTestEnv()
+		os.Setenv("REFRESH_TOKEN_TTL", "one week")
+		defer os.Unsetenv("REFRESH_TOKEN_TTL")
+
+		config, err := LoadConfig()
+
+		if err == nil {
+			t.Error("LoadConfig() should return error when REFRESH_TOKEN_TTL is invalid")
+		}
+		if config != nil {
+			t.Error("Config should be nil when error occurs")
+		}
+	})
+
+	t.Run("should require the OAuth issuer outside development", func(t *testing.T) {
+		cleanupTestEnv()
+		os.Setenv("APP_ENV", "production")
+		defer os.Unsetenv("APP_ENV")
+
+		if _, err := LoadConfig(); err == nil {
+			t.Error("LoadConfig() should return error when OAUTH_ISSUER is not set in production")
+		}
+
+		os.Setenv("OAUTH_ISSUER", "pizza.example.com")
+		defer os.Unsetenv("OAUTH_ISSUER")
+		if _, err := LoadConfig(); err == nil {
+			t.Error("LoadConfig() should return error when OAUTH_ISSUER is not an absolute URL")
+		}
+
+		os.Setenv("OAUTH_ISSUER", "https://pizza.example.com/")
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() returned unexpected error: %v", err)
+		}
+		if config.OAuthIssuer != "https://pizza.example.com" {
+			t.Errorf("OAuthIssuer = %s, expected https://pizza.example.com", config.OAuthIssuer)
+		}
+	})
+
+	t.Run("should read trusted proxies as a comma-separated list", func(t *testing.T) {
+		cleanupTestEnv()
+		os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.10,")
+		defer os.Unsetenv("TRUSTED_PROXIES")
+
+		config, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig() returned unexpected error: %v", err)
+		}
+		if len(config.TrustedProxies) != 2 || config.TrustedProxies[0] != "10.0.0.0/8" || config.TrustedProxies[1] != "192.168.1.10" {
+			t.Errorf("TrustedProxies = %v, expected [10.0.0.0/8 192.168.1.10]", config.TrustedProxies)
+		}
+	})
+
 	t.Run("should use defaults when optional env vars not set", func(t *testing.T) {
 		cleanupTestEnv()
 		defer cleanupTestEnv()
@@ -134,6 +189,18 @@ func TestLoadConfig(t *testing.T) {
 		if config.LogLevel != "info" {
 			t.Errorf("LogLevel = %s, expected default info", config.LogLevel)
 		}
+		if config.Environment != "development" {
+			t.Errorf("Environment = %s, expected default development", config.Environment)
+		}
+		if len(config.TrustedProxies) != 0 {
+			t.Errorf("TrustedProxies = %v, expected no trusted proxies by default", config.TrustedProxies)
+		}
+		if config.AccessTokenTTL != time.Hour {
+			t.Errorf("AccessTokenTTL = %s, expected default 1h", config.AccessTokenTTL)
+		}
+		if config.RefreshTokenTTL != 7*24*time.Hour {
+			t.Errorf("RefreshTokenTTL = %s, expected default 168h", config.RefreshTokenTTL)
+		}
 	})
 }
 
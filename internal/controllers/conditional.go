@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// pizzaETag returns the strong entity tag of a pizza, derived from its version column
+func pizzaETag(pizza models.Pizza) string {
+	return fmt.Sprintf(`"%d-%d"`, pizza.ID, pizza.Version)
+}
+
+// setPizzaETag adds the ETag header for the pizza being returned
+func setPizzaETag(ctx *gin.Context, pizza models.Pizza) {
+	ctx.Header("ETag", pizzaETag(pizza))
+}
+
+// checkIfMatch evaluates the If-Match header against the current pizza (RFC 9110 section 13.1.1)
+// It returns the version the write must be conditioned on, 0 when the header is absent or "*",
+// and responds with 412 Precondition Failed when none of the listed entity tags match
+func checkIfMatch(ctx *gin.Context, pizza models.Pizza) (int64, bool) {
+	expectedVersion, ok := ifMatchVersion(ctx.GetHeader("If-Match"), pizza)
+	if !ok {
+		setPizzaETag(ctx, pizza)
+		respondPreconditionFailed(ctx)
+	}
+	return expectedVersion, ok
+}
+
+// ifMatchVersion compares an If-Match value with the pizza ETag and returns the version to write against
+// It reports false when the value lists entity tags but none of them is current
+func ifMatchVersion(header string, pizza models.Pizza) (int64, bool) {
+	if header == "" {
+		return 0, true
+	}
+
+	current := pizzaETag(pizza)
+	for _, tag := range strings.Split(header, ",") {
+		switch strings.TrimSpace(tag) {
+		case "*":
+			return 0, true
+		case current:
+			// Weak tags (W/"...") never match because If-Match uses the strong comparison
+			return pizza.Version, true
+		}
+	}
+	return 0, false
+}
+
+// respondPreconditionFailed responds with 412 when a conditional write lost against a concurrent change
+func respondPreconditionFailed(ctx *gin.Context) {
+	ctx.JSON(http.StatusPreconditionFailed, preconditionFailedError())
+}
+
+// preconditionFailedError describes a conditional write that lost against a concurrent change
+func preconditionFailedError() models.APIError {
+	return models.NewAPIError(models.ErrPreconditionFailed,
+		"Pizza was modified since it was retrieved; fetch it again and retry with the new ETag")
+}
+
+// catalogETag returns the entity tag of a pizza listing
+// The query string is part of the tag because filters, sorting and cursors select different representations
+func catalogETag(revision services.CatalogRevision, rawQuery string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%d:%d:%s",
+		revision.Count, revision.VersionSum, revision.LastModified.UnixNano(), rawQuery)))
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// hasCacheValidators reports whether the request is a conditional GET
+func hasCacheValidators(ctx *gin.Context) bool {
+	return ctx.GetHeader("If-None-Match") != "" || ctx.GetHeader("If-Modified-Since") != ""
+}
+
+// setCacheValidators adds the ETag and Last-Modified headers to the response
+func setCacheValidators(ctx *gin.Context, etag string, lastModified time.Time) {
+	ctx.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		ctx.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified sets the validators and answers 304 Not Modified when the client's copy is current
+// (RFC 9110 section 13.2.2). If-Modified-Since is ignored when If-None-Match is present.
+func notModified(ctx *gin.Context, etag string, lastModified time.Time) bool {
+	setCacheValidators(ctx, etag, lastModified)
+
+	if header := ctx.GetHeader("If-None-Match"); header != "" {
+		if !matchesWeakly(header, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(ctx.GetHeader("If-Modified-Since"))
+		// HTTP dates have one-second resolution
+		if err != nil || lastModified.IsZero() || lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	ctx.Status(http.StatusNotModified)
+	return true
+}
+
+// matchesWeakly reports whether an If-None-Match list contains the entity tag, ignoring weakness
+func matchesWeakly(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conditionalContext returns a context for a request carrying the headers
+func conditionalContext(headers map[string]string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	for name, value := range headers {
+		ctx.Request.Header.Set(name, value)
+	}
+	return ctx, w
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	pizza := models.Pizza{ID: 1, Version: 3}
+
+	tests := []struct {
+		name     string
+		header   string
+		version  int64
+		matching bool
+	}{
+		{"absent", "", 0, true},
+		{"any", "*", 0, true},
+		{"current", `"1-3"`, 3, true},
+		{"stale", `"1-2"`, 0, false},
+		{"other pizza", `"2-3"`, 0, false},
+		{"weak tags never match", `W/"1-3"`, 0, false},
+		{"list containing the current tag", `"1-1", "1-2" ,"1-3"`, 3, true},
+		{"list of stale and weak tags", `"1-2", W/"1-3"`, 0, false},
+		{"list containing any", `"1-2", *`, 0, true},
+		{"unquoted", `1-3`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, ok := ifMatchVersion(tt.header, pizza)
+			assert.Equal(t, tt.matching, ok)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	pizza := models.Pizza{ID: 1, Version: 3}
+
+	ctx, w := conditionalContext(map[string]string{"If-Match": `"1-3"`})
+	version, ok := checkIfMatch(ctx, pizza)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), version)
+	assert.False(t, ctx.Writer.Written())
+
+	// The 412 carries the current ETag so the client can fetch and retry
+	ctx, w = conditionalContext(map[string]string{"If-Match": `"1-2"`})
+	_, ok = checkIfMatch(ctx, pizza)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `"1-3"`, w.Header().Get("ETag"))
+	var apiErr models.APIError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+	assert.Equal(t, models.ErrPreconditionFailed, apiErr.Code)
+}
+
+func TestUpdatePizzaIfMatch(t *testing.T) {
+	router, service := setupPizzaRouter(t)
+	pizza := seedPizza(t, service, "Margherita", 1)
+
+	update := func(ifMatch, name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/api/v1/pizzas/%d", pizza.ID),
+			strings.NewReader(fmt.Sprintf(`{"name": %q, "price": 10.99, "ingredients": ["Mozzarella"]}`, name)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", "1")
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update(pizzaETag(pizza), "Margherita Extra")
+	require.Equal(t, http.StatusOK, w.Code)
+	current := w.Header().Get("ETag")
+	assert.NotEqual(t, pizzaETag(pizza), current)
+
+	// A client still holding the old ETag loses, and learns the current one
+	w = update(pizzaETag(pizza), "Lost Update")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, current, w.Header().Get("ETag"))
+	stored, err := service.GetPizzaByID(pizza.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Margherita Extra", stored.Name)
+}
+
+func TestNotModified(t *testing.T) {
+	etag := `"1-3"`
+	// Stored timestamps have sub-second precision, HTTP dates do not
+	lastModified := time.Date(2025, 11, 10, 12, 0, 0, 500_000_000, time.UTC)
+	httpDate := func(t time.Time) string { return t.Format(http.TimeFormat) }
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		lastModified time.Time
+		notModified  bool
+	}{
+		{"no validators", nil, lastModified, false},
+		{"current tag", map[string]string{"If-None-Match": etag}, lastModified, true},
+		{"weak form of the current tag", map[string]string{"If-None-Match": `W/"1-3"`}, lastModified, true},
+		{"stale tag", map[string]string{"If-None-Match": `"1-2"`}, lastModified, false},
+		{"list containing the current tag", map[string]string{"If-None-Match": `"1-1", W/"1-3"`}, lastModified, true},
+		{"any", map[string]string{"If-None-Match": "*"}, lastModified, true},
+		{"stale tag wins over a current date", map[string]string{
+			"If-None-Match": `"1-2"`, "If-Modified-Since": httpDate(lastModified.Add(time.Hour)),
+		}, lastModified, false},
+		{"current tag wins over an old date", map[string]string{
+			"If-None-Match": etag, "If-Modified-Since": httpDate(lastModified.Add(-time.Hour)),
+		}, lastModified, true},
+		{"date of the same second", map[string]string{"If-Modified-Since": httpDate(lastModified)}, lastModified, true},
+		{"later date", map[string]string{"If-Modified-Since": httpDate(lastModified.Add(time.Minute))}, lastModified, true},
+		{"earlier second", map[string]string{"If-Modified-Since": httpDate(lastModified.Add(-time.Second))}, lastModified, false},
+		{"malformed date", map[string]string{"If-Modified-Since": "yesterday"}, lastModified, false},
+		{"no last modification time", map[string]string{"If-Modified-Since": httpDate(lastModified)}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, w := conditionalContext(tt.headers)
+			assert.Equal(t, tt.notModified, notModified(ctx, etag, tt.lastModified))
+			if tt.notModified {
+				assert.Equal(t, http.StatusNotModified, ctx.Writer.Status())
+			}
+
+			// The validators are sent either way
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+			if !tt.lastModified.IsZero() {
+				assert.Equal(t, "Mon, 10 Nov 2025 12:00:00 GMT", w.Header().Get("Last-Modified"))
+			}
+		})
+	}
+}
+
+func TestCatalogETag(t *testing.T) {
+	revision := services.CatalogRevision{Count: 5, VersionSum: 9, LastModified: time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)}
+	etag := catalogETag(revision, "limit=2")
+
+	assert.Regexp(t, `^"[0-9a-f]{24}"$`, etag, "a strong entity tag")
+	assert.Equal(t, etag, catalogETag(revision, "limit=2"))
+	assert.True(t, matchesWeakly("W/"+etag, etag))
+
+	// Any write, purge or other query selects a different representation
+	changed := []services.CatalogRevision{
+		{Count: 4, VersionSum: 9, LastModified: revision.LastModified},
+		{Count: 5, VersionSum: 10, LastModified: revision.LastModified},
+		{Count: 5, VersionSum: 9, LastModified: revision.LastModified.Add(time.Millisecond)},
+	}
+	for _, other := range changed {
+		assert.NotEqual(t, etag, catalogETag(other, "limit=2"))
+	}
+	assert.NotEqual(t, etag, catalogETag(revision, "limit=3"))
+	assert.NotEqual(t, etag, catalogETag(revision, ""))
+}
+
+func TestGetPizzasIfNoneMatch(t *testing.T) {
+	router, service := setupPizzaRouter(t)
+	pizza := seedPizza(t, service, "Margherita", 1)
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{fmt.Sprintf("/api/v1/public/pizzas/%d", pizza.ID), "/api/v1/public/pizzas?limit=10"} {
+		t.Run(path, func(t *testing.T) {
+			w := get(path, "")
+			require.Equal(t, http.StatusOK, w.Code)
+			etag := w.Header().Get("ETag")
+			require.NotEmpty(t, etag)
+
+			w = get(path, etag)
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Empty(t, w.Body.String())
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+
+			assert.Equal(t, http.StatusOK, get(path, `"stale"`).Code)
+		})
+	}
+
+	// Adding a pizza changes the tag of the catalog, but not of the pizzas already in it
+	itemETag := get(fmt.Sprintf("/api/v1/public/pizzas/%d", pizza.ID), "").Header().Get("ETag")
+	catalogTag := get("/api/v1/public/pizzas?limit=10", "").Header().Get("ETag")
+	seedPizza(t, service, "Marinara", 1)
+	assert.Equal(t, http.StatusOK, get("/api/v1/public/pizzas?limit=10", catalogTag).Code)
+	assert.Equal(t, http.StatusNotModified, get(fmt.Sprintf("/api/v1/public/pizzas/%d", pizza.ID), itemETag).Code)
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IngredientController handles HTTP requests related to the ingredient catalog
+type IngredientController interface {
+	// GetAllIngredients lists catalog ingredients
+	GetAllIngredients(c *gin.Context)
+	// GetIngredientByID retrieves a catalog ingredient by its ID
+	GetIngredientByID(c *gin.Context)
+	// CreateIngredient adds an ingredient to the catalog
+	CreateIngredient(c *gin.Context)
+	// UpdateIngredient renames a catalog ingredient
+	UpdateIngredient(c *gin.Context)
+	// DeleteIngredient removes an unused catalog ingredient
+	DeleteIngredient(c *gin.Context)
+}
+
+type ingredientController struct {
+	service services.IngredientService
+}
+
+// NewIngredientController creates a new instance of IngredientController
+func NewIngredientController(service services.IngredientService) *ingredientController {
+	return &ingredientController{service: service}
+}
+
+// ingredientRequest is the request body for creating or renaming an ingredient
+type ingredientRequest struct {
+	Name string `json:"name" binding:"required" example:"Mozzarella"`
+}
+
+// GetAllIngredients godoc
+// @Summary Get all ingredients
+// @Description Get the ingredient catalog, optionally filtered by partial name
+// @Tags ingredients
+// @Accept json
+// @Produce json
+// @Param name query string false "Filter by ingredient name (partial, case-insensitive)"
+// @Success 200 {array} models.Ingredient
+// @Failure 500 {object} models.APIError
+// @Router /api/v1/public/ingredients [get]
+func (c *ingredientController) GetAllIngredients(ctx *gin.Context) {
+	ingredients, err := c.service.GetAllIngredients(ctx.Query("name"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to retrieve ingredients"))
+		return
+	}
+	ctx.JSON(http.StatusOK, ingredients)
+}
+
+// GetIngredientByID godoc
+// @Summary Get ingredient by ID
+// @Description Get a single catalog ingredient by its ID
+// @Tags ingredients
+// @Accept json
+// @Produce json
+// @Param id path int true "Ingredient ID"
+// @Success 200 {object} models.Ingredient
+// @Failure 400 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Router /api/v1/public/ingredients/{id} [get]
+func (c *ingredientController) GetIngredientByID(ctx *gin.Context) {
+	id, ok := parseIngredientID(ctx)
+	if !ok {
+		return
+	}
+
+	ingredient, err := c.service.GetIngredientByID(id)
+	if err != nil {
+		respondIngredientError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, ingredient)
+}
+
+// CreateIngredient godoc
+// @Summary Create an ingredient
+// @Description Add a new ingredient to the catalog (admin only)
+// @Tags ingredients
+// @Accept json
+// @Produce json
+// @Param ingredient body ingredientRequest true "Ingredient"
+// @Success 201 {object} models.Ingredient
+// @Failure 400 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/ingredients [post]
+func (c *ingredientController) CreateIngredient(ctx *gin.Context) {
+	var req ingredientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid request body"))
+		return
+	}
+
+	ingredient, err := c.service.CreateIngredient(req.Name)
+	if err != nil {
+		respondIngredientError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, ingredient)
+}
+
+// UpdateIngredient godoc
+// @Summary Rename an ingredient
+// @Description Rename a catalog ingredient; every pizza using it reflects the new name (admin only)
+// @Tags ingredients
+// @Accept json
+// @Produce json
+// @Param id path int true "Ingredient ID"
+// @Param ingredient body ingredientRequest true "Ingredient"
+// @Success 200 {object} models.Ingredient
+// @Failure 400 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/ingredients/{id} [put]
+func (c *ingredientController) UpdateIngredient(ctx *gin.Context) {
+	id, ok := parseIngredientID(ctx)
+	if !ok {
+		return
+	}
+
+	var req ingredientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid request body"))
+		return
+	}
+
+	ingredient, err := c.service.UpdateIngredient(id, req.Name)
+	if err != nil {
+		respondIngredientError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, ingredient)
+}
+
+// DeleteIngredient godoc
+// @Summary Delete an ingredient
+// @Description Remove an ingredient that no pizza uses (admin only)
+// @Tags ingredients
+// @Accept json
+// @Produce json
+// @Param id path int true "Ingredient ID"
+// @Success 204
+// @Failure 400 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/ingredients/{id} [delete]
+func (c *ingredientController) DeleteIngredient(ctx *gin.Context) {
+	id, ok := parseIngredientID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.service.DeleteIngredient(id); err != nil {
+		respondIngredientError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// parseIngredientID reads the :id path parameter, responding with 400 when it is not numeric
+func parseIngredientID(ctx *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid ingredient ID format"))
+		return 0, false
+	}
+	return id, true
+}
+
+// respondIngredientError maps ingredient service errors to API errors
+func respondIngredientError(ctx *gin.Context, err error) {
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		respondValidationError(ctx, validationErr)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrNotFound, "Ingredient not found"))
+	case errors.Is(err, services.ErrIngredientExists):
+		ctx.JSON(http.StatusConflict, models.NewAPIError(models.ErrConflict, "An ingredient with this name already exists"))
+	case errors.Is(err, services.ErrIngredientInUse):
+		ctx.JSON(http.StatusConflict, models.NewAPIError(models.ErrConflict, "Ingredient is still used by one or more pizzas"))
+	default:
+		ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to process ingredient"))
+	}
+}
@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OrderController handles HTTP requests for customer orders
+type OrderController interface {
+	// GetOrders lists the caller's orders, or every order for admins
+	GetOrders(c *gin.Context)
+	// GetOrderByID retrieves a single order
+	GetOrderByID(c *gin.Context)
+	// CreateOrder places a new order
+	CreateOrder(c *gin.Context)
+	// ConfirmOrder moves a pending order to confirmed
+	ConfirmOrder(c *gin.Context)
+	// StartBakingOrder moves a confirmed order to baking
+	StartBakingOrder(c *gin.Context)
+	// MarkOrderReady moves a baking order to ready
+	MarkOrderReady(c *gin.Context)
+	// DeliverOrder moves a ready order to delivered
+	DeliverOrder(c *gin.Context)
+	// CancelOrder cancels an order that has not started baking
+	CancelOrder(c *gin.Context)
+}
+
+type orderController struct {
+	service services.OrderService
+}
+
+// NewOrderController creates a new instance of OrderController
+func NewOrderController(service services.OrderService) *orderController {
+	return &orderController{service: service}
+}
+
+// orderRequest is the request body for placing an order
+type orderRequest struct {
+	Items []orderItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+// orderItemRequest is a single line of an order request
+type orderItemRequest struct {
+	PizzaID int `json:"pizza_id" binding:"required" example:"1"`
+	// VariantID selects a size/crust variant of the pizza, whose price then applies
+	VariantID *int `json:"variant_id" example:"3"`
+	Quantity  int  `json:"quantity" binding:"required" example:"2"`
+}
+
+// toModel converts the request into an order placed by the given user
+func (r orderRequest) toModel(userID uint) models.Order {
+	order := models.Order{UserID: userID}
+	for _, item := range r.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			PizzaID:   item.PizzaID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+	return order
+}
+
+// GetOrders godoc
+// @Summary List orders
+// @Description List the caller's orders, newest first. Admins see every customer's orders.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param status query string false "Only orders in this status" Enums(pending, confirmed, baking, ready, delivered, cancelled)
+// @Success 200 {array} models.Order
+// @Failure 400 {object} models.APIError
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/orders [get]
+func (c *orderController) GetOrders(ctx *gin.Context) {
+	userID, isAdmin, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	opts := services.OrderListOptions{Status: ctx.Query("status")}
+	if !isAdmin {
+		opts.UserID = &userID
+	}
+
+	orders, err := c.service.GetOrders(opts)
+	if err != nil {
+		respondOrderError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, orders)
+}
+
+// GetOrderByID godoc
+// @Summary Get an order
+// @Description Get one of the caller's orders by ID (admins may read any order)
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 400 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/orders/{id} [get]
+func (c *orderController) GetOrderByID(ctx *gin.Context) {
+	order, _, ok := c.loadOrder(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, order)
+}
+
+// CreateOrder godoc
+// @Summary Place an order
+// @Description Place a pending order. Item names and prices are copied from the menu at this moment.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param order body orderRequest true "Order"
+// @Success 201 {object} models.Order
+// @Failure 400 {object} models.APIError
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/orders [post]
+func (c *orderController) CreateOrder(ctx *gin.Context) {
+	userID, _, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	var req orderRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid request body"))
+		return
+	}
+
+	order, err := c.service.CreateOrder(req.toModel(userID))
+	if err != nil {
+		respondOrderError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, order)
+}
+
+// ConfirmOrder godoc
+// @Summary Confirm an order
+// @Description Move a pending order to confirmed (admin only)
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 403 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/orders/{id}/confirm [post]
+func (c *orderController) ConfirmOrder(ctx *gin.Context) {
+	c.transition(ctx, models.OrderStatusConfirmed)
+}
+
+// StartBakingOrder godoc
+// @Summary Start baking an order
+// @Description Move a confirmed order to baking (admin only)
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 403 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/orders/{id}/bake [post]
+func (c *orderController) StartBakingOrder(ctx *gin.Context) {
+	c.transition(ctx, models.OrderStatusBaking)
+}
+
+// MarkOrderReady godoc
+// @Summary Mark an order ready
+// @Description Move a baking order to ready (admin only)
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 403 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/orders/{id}/ready [post]
+func (c *orderController) MarkOrderReady(ctx *gin.Context) {
+	c.transition(ctx, models.OrderStatusReady)
+}
+
+// DeliverOrder godoc
+// @Summary Deliver an order
+// @Description Move a ready order to delivered (admin only)
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 403 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/orders/{id}/deliver [post]
+func (c *orderController) DeliverOrder(ctx *gin.Context) {
+	c.transition(ctx, models.OrderStatusDelivered)
+}
+
+// CancelOrder godoc
+// @Summary Cancel an order
+// @Description Cancel a pending or confirmed order (owner or admin)
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/orders/{id}/cancel [post]
+func (c *orderController) CancelOrder(ctx *gin.Context) {
+	c.transition(ctx, models.OrderStatusCancelled)
+}
+
+// transition moves the order from the :id path parameter to the given status
+// Customers may only cancel their own orders; every other step is performed by an admin
+func (c *orderController) transition(ctx *gin.Context, status models.OrderStatus) {
+	order, isAdmin, ok := c.loadOrder(ctx)
+	if !ok {
+		return
+	}
+	if status != models.OrderStatusCancelled && !isAdmin {
+		ctx.JSON(http.StatusForbidden, models.NewAPIError(models.ErrForbidden, "Only admins can advance an order"))
+		return
+	}
+
+	updated, err := c.service.TransitionOrder(order.ID, status)
+	if err != nil {
+		respondOrderError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// loadOrder resolves the order from the :id path parameter
+// Orders of other customers are reported as not found unless the caller is an admin
+func (c *orderController) loadOrder(ctx *gin.Context) (models.Order, bool, bool) {
+	userID, isAdmin, ok := currentUser(ctx)
+	if !ok {
+		return models.Order{}, false, false
+	}
+
+	orderID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid order ID format"))
+		return models.Order{}, false, false
+	}
+
+	order, err := c.service.GetOrderByID(orderID)
+	if err == nil && order.UserID != userID && !isAdmin {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		respondOrderError(ctx, err)
+		return models.Order{}, false, false
+	}
+	return order, isAdmin, true
+}
+
+// respondOrderError maps order service errors to API errors
+func respondOrderError(ctx *gin.Context, err error) {
+	var validationErr *services.ValidationError
+	var transitionErr *services.OrderTransitionError
+	switch {
+	case errors.As(err, &validationErr):
+		respondValidationError(ctx, validationErr)
+	case errors.As(err, &transitionErr):
+		ctx.JSON(http.StatusConflict, models.NewAPIError(models.ErrConflict, transitionErr.Error(), map[string]interface{}{
+			"status":           transitionErr.From,
+			"requested_status": transitionErr.To,
+		}))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrNotFound, "Order not found"))
+	default:
+		ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to process order"))
+	}
+}
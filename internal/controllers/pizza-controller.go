@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
 	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // PizzaController handles HTTP requests related to pizzas
@@ -19,8 +22,20 @@ type PizzaController interface {
 	CreatePizza(c *gin.Context)
 	// UpdatePizza updates an existing pizza
 	UpdatePizza(c *gin.Context)
+	// PatchPizza partially updates an existing pizza
+	PatchPizza(c *gin.Context)
 	// DeletePizza deletes a pizza by its ID
 	DeletePizza(c *gin.Context)
+	// RestorePizza undoes the soft delete of a pizza
+	RestorePizza(c *gin.Context)
+	// PurgePizza permanently removes a soft-deleted pizza
+	PurgePizza(c *gin.Context)
+	// ExportPizzas streams the pizza catalog as CSV, JSON or NDJSON
+	ExportPizzas(c *gin.Context)
+	// ImportPizzas creates pizzas from a CSV, JSON or NDJSON upload in one transaction
+	ImportPizzas(c *gin.Context)
+	// BatchPizzas applies several creates, updates and deletes in one request
+	BatchPizzas(c *gin.Context)
 }
 
 type controller struct {
@@ -34,27 +49,89 @@ func NewPizzaController(service services.PizzaService) *controller {
 
 // GetAllPizzas godoc
 // @Summary Get all pizzas
-// @Description Get a list of all pizzas with optional filtering
+// @Description Get a list of pizzas with optional filtering, sorting and cursor-based pagination.
+// @Description When limit or cursor is supplied the response is a page envelope, otherwise a plain array.
 // @Tags pizzas
 // @Accept json
 // @Produce json
 // @Param created_by query string false "Filter by creator user ID"
 // @Param name query string false "Filter by pizza name (partial match)"
-// @Success 200 {array} models.Pizza
-// @Failure 400 {object} map[string]string
+// @Param price_gte query number false "Minimum price (inclusive)"
+// @Param price_lte query number false "Maximum price (inclusive)"
+// @Param ingredient query []string false "Ingredient to match (repeatable, case-insensitive)" collectionFormat(multi)
+// @Param ingredient_match query string false "Match any (default) or all of the ingredients" Enums(any, all)
+// @Param created_after query string false "Only pizzas created after this RFC 3339 timestamp"
+// @Param updated_after query string false "Only pizzas updated after this RFC 3339 timestamp"
+// @Param filter query string false "Boolean filter expression, e.g. (price_gte:10 and ingredient:Basil) or not name:Hawaiian"
+// @Param sort query string false "Comma-separated sort fields, prefix with '-' for descending (e.g. price,-created_at)"
+// @Param limit query int false "Maximum number of pizzas per page (1-100)"
+// @Param cursor query string false "Opaque cursor from a previous page's next_cursor"
+// @Param include_total query bool false "Include the total number of matching pizzas"
+// @Param include_deleted query bool false "Also list soft-deleted pizzas (admin only, /api/v1/pizzas)"
+// @Param If-None-Match header string false "Answer 304 if the listing still has this ETag"
+// @Param If-Modified-Since header string false "Answer 304 if no pizza changed since this HTTP date"
+// @Success 200 {object} models.PizzaListResponse
+// @Header 200 {string} ETag "Entity tag of the listing"
+// @Header 200 {string} Last-Modified "Time of the most recent change to any pizza"
+// @Success 304 "Not Modified"
+// @Failure 400 {object} models.APIError
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} models.APIError
 // @Failure 500 {object} map[string]string
 // @Router /api/v1/public/pizzas [get]
+// @Router /api/v1/pizzas [get]
 func (c *controller) GetAllPizzas(ctx *gin.Context) {
-	// Get query parameters
-	createdBy := ctx.Query("created_by")
-	name := ctx.Query("name")
+	opts, paramErr := parseListOptions(ctx)
+	if paramErr != nil {
+		respondValidationError(ctx, paramErr)
+		return
+	}
+
+	// Soft-deleted pizzas are only listed for admins on the authenticated route
+	if opts.IncludeDeleted {
+		if _, isAdmin, ok := currentUser(ctx); !ok {
+			return
+		} else if !isAdmin {
+			ctx.JSON(http.StatusForbidden, models.NewAPIError(models.ErrForbidden, "Only admins can list deleted pizzas"))
+			return
+		}
+	}
+
+	// The revision is read before the page, so a concurrent write can only make the ETag older than the data
+	revision, err := c.service.GetCatalogRevision()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pizzas"})
+		return
+	}
+	if notModified(ctx, catalogETag(revision, ctx.Request.URL.RawQuery), revision.LastModified) {
+		return
+	}
 
-	pizzas, err := c.service.GetAllPizzas(createdBy, name)
+	page, err := c.service.GetAllPizzas(opts)
 	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			respondValidationError(ctx, validationErr)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pizzas"})
 		return
 	}
-	ctx.JSON(http.StatusOK, pizzas)
+
+	// Unpaginated requests keep the original plain array response for backward compatibility
+	if opts.Limit == 0 && opts.Cursor == "" {
+		if page.Total != nil {
+			ctx.Header("X-Total-Count", strconv.FormatInt(*page.Total, 10))
+		}
+		ctx.JSON(http.StatusOK, page.Items)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.PizzaListResponse{
+		Data:       page.Items,
+		NextCursor: page.NextCursor,
+		Total:      page.Total,
+	})
 }
 
 // GetPizzaByID godoc
@@ -64,7 +141,12 @@ func (c *controller) GetAllPizzas(ctx *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Pizza ID"
+// @Param If-None-Match header string false "Answer 304 if the pizza still has this ETag"
+// @Param If-Modified-Since header string false "Answer 304 if the pizza did not change since this HTTP date"
 // @Success 200 {object} models.Pizza
+// @Header 200 {string} ETag "Strong entity tag of the pizza"
+// @Header 200 {string} Last-Modified "Time of the last change to the pizza"
+// @Success 304 "Not Modified"
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /api/v1/public/pizzas/{id} [get]
@@ -80,11 +162,20 @@ func (c *controller) GetPizzaByID(ctx *gin.Context) {
 		return
 	}
 
+	// Answer revalidations from the version column alone, without loading ingredients and variants
+	if hasCacheValidators(ctx) {
+		revision, err := c.service.GetPizzaRevision(pizzaId)
+		if err == nil && notModified(ctx, pizzaETag(revision), revision.UpdatedAt) {
+			return
+		}
+	}
+
 	pizza, err := c.service.GetPizzaByID(pizzaId)
 	if err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "Pizza not found"})
 		return
 	}
+	setCacheValidators(ctx, pizzaETag(pizza), pizza.UpdatedAt)
 	ctx.JSON(http.StatusOK, pizza)
 }
 
@@ -103,7 +194,7 @@ func (c *controller) GetPizzaByID(ctx *gin.Context) {
 func (c *controller) CreatePizza(ctx *gin.Context) {
 	var pizza models.Pizza
 	if err := ctx.ShouldBindJSON(&pizza); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(ctx, err)
 		return
 	}
 
@@ -131,9 +222,15 @@ func (c *controller) CreatePizza(ctx *gin.Context) {
 
 	createdPizza, err := c.service.CreatePizza(pizza)
 	if err != nil {
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			respondValidationError(ctx, validationErr)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pizza"})
 		return
 	}
+	setPizzaETag(ctx, createdPizza)
 	ctx.JSON(http.StatusCreated, createdPizza)
 }
 
@@ -145,10 +242,13 @@ func (c *controller) CreatePizza(ctx *gin.Context) {
 // @Produce json
 // @Param id path int true "Pizza ID"
 // @Param pizza body models.Pizza true "Pizza object"
+// @Param If-Match header string false "Only update if the pizza still has this ETag"
 // @Success 200 {object} models.Pizza
+// @Header 200 {string} ETag "Strong entity tag of the updated pizza"
 // @Failure 400 {object} map[string]string
 // @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 412 {object} models.APIError
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/v1/pizzas/{id} [put]
@@ -172,53 +272,122 @@ func (c *controller) UpdatePizza(ctx *gin.Context) {
 		return
 	}
 
-	// Get the authenticated user ID and role
-	userID, exists := ctx.Get("userID")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
-	}
-
-	userRole, _ := ctx.Get("userRole")
-	isAdmin := userRole == "admin"
-
 	// Check if user is the creator or an admin
-	var currentUserID uint
-	switch v := userID.(type) {
-	case uint:
-		currentUserID = v
-	case int:
-		currentUserID = uint(v)
-	case string:
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format for this operation"})
+	if !authorizePizzaOwner(ctx, existingPizza, "You can only update your own pizzas") {
 		return
 	}
-
-	if existingPizza.CreatedBy != currentUserID && !isAdmin {
-		ctx.JSON(http.StatusForbidden, gin.H{
-			"error":       "You can only update your own pizzas",
-			"pizza_owner": existingPizza.CreatedBy,
-			"your_id":     currentUserID,
-		})
+	expectedVersion, ok := checkIfMatch(ctx, existingPizza)
+	if !ok {
 		return
 	}
 
 	var pizza models.Pizza
 	if err := ctx.ShouldBindJSON(&pizza); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(ctx, err)
 		return
 	}
 
 	// Ensure the ID from URL is used
 	pizza.ID = pizzaId
-	// Preserve the original creator
+	// Preserve the original creator and creation time
 	pizza.CreatedBy = existingPizza.CreatedBy
+	pizza.CreatedAt = existingPizza.CreatedAt
 
-	updatedPizza, err := c.service.UpdatePizza(pizza)
+	updatedPizza, err := c.service.UpdatePizza(pizza, expectedVersion)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pizza"})
+		var validationErr *services.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			respondValidationError(ctx, validationErr)
+		case errors.Is(err, services.ErrPizzaVersionMismatch):
+			respondPreconditionFailed(ctx)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Pizza not found"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pizza"})
+		}
 		return
 	}
+	setPizzaETag(ctx, updatedPizza)
+	ctx.JSON(http.StatusOK, updatedPizza)
+}
+
+// PatchPizza godoc
+// @Summary Partially update a pizza
+// @Description Apply a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) document to a pizza (owner or admin).
+// @Description Fields that are omitted keep their value. id, created_by, created_at, updated_at, price_minor and variants are read-only.
+// @Tags pizzas
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Param patch body object true "Merge patch object or JSON Patch operation array"
+// @Param If-Match header string false "Only update if the pizza still has this ETag"
+// @Success 200 {object} models.Pizza
+// @Header 200 {string} ETag "Strong entity tag of the updated pizza"
+// @Failure 400 {object} models.APIError
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Failure 412 {object} models.APIError
+// @Failure 415 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas/{id} [patch]
+func (c *controller) PatchPizza(ctx *gin.Context) {
+	pizzaID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid pizza ID format"))
+		return
+	}
+
+	existingPizza, err := c.service.GetPizzaByID(pizzaID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrPizzaNotFound, "Pizza not found"))
+		return
+	}
+	if !authorizePizzaOwner(ctx, existingPizza, "You can only update your own pizzas") {
+		return
+	}
+	expectedVersion, ok := checkIfMatch(ctx, existingPizza)
+	if !ok {
+		return
+	}
+
+	contentType := ctx.ContentType()
+	if contentType != services.MergePatchContentType && contentType != services.JSONPatchContentType {
+		ctx.Header("Accept-Patch", services.MergePatchContentType+", "+services.JSONPatchContentType)
+		ctx.JSON(http.StatusUnsupportedMediaType, models.NewAPIError(models.ErrBadRequest,
+			fmt.Sprintf("Content-Type must be %s or %s", services.MergePatchContentType, services.JSONPatchContentType)))
+		return
+	}
+
+	patch, err := ctx.GetRawData()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid request body"))
+		return
+	}
+
+	updatedPizza, err := c.service.PatchPizza(pizzaID, contentType, patch, expectedVersion)
+	if err != nil {
+		var validationErr *services.ValidationError
+		var testErr *services.PatchTestFailedError
+		switch {
+		case errors.As(err, &validationErr):
+			respondValidationError(ctx, validationErr)
+		case errors.As(err, &testErr):
+			ctx.JSON(http.StatusConflict, models.NewAPIError(models.ErrConflict, testErr.Error(), map[string]interface{}{
+				"path": testErr.Path,
+			}))
+		case errors.Is(err, services.ErrPizzaVersionMismatch):
+			respondPreconditionFailed(ctx)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrPizzaNotFound, "Pizza not found"))
+		default:
+			ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to update pizza"))
+		}
+		return
+	}
+	setPizzaETag(ctx, updatedPizza)
 	ctx.JSON(http.StatusOK, updatedPizza)
 }
 
@@ -229,10 +398,12 @@ func (c *controller) UpdatePizza(ctx *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Pizza ID"
+// @Param If-Match header string false "Only delete if the pizza still has this ETag"
 // @Success 204
 // @Failure 400 {object} map[string]string
 // @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 412 {object} models.APIError
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/v1/pizzas/{id} [delete]
@@ -256,40 +427,268 @@ func (c *controller) DeletePizza(ctx *gin.Context) {
 		return
 	}
 
+	// Check if user is the creator or an admin
+	if !authorizePizzaOwner(ctx, existingPizza, "You can only delete your own pizzas") {
+		return
+	}
+	expectedVersion, ok := checkIfMatch(ctx, existingPizza)
+	if !ok {
+		return
+	}
+
+	if err := c.service.DeletePizza(pizzaId, expectedVersion); err != nil {
+		switch {
+		case errors.Is(err, services.ErrPizzaVersionMismatch):
+			respondPreconditionFailed(ctx)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Pizza not found"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pizza"})
+		}
+		return
+	}
+	ctx.JSON(http.StatusNoContent, nil)
+}
+
+// RestorePizza godoc
+// @Summary Restore a deleted pizza
+// @Description Undo the soft delete of a pizza (owner or admin)
+// @Tags pizzas
+// @Accept json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Success 200 {object} models.Pizza
+// @Failure 400 {object} models.APIError
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas/{id}/restore [post]
+func (c *controller) RestorePizza(ctx *gin.Context) {
+	pizza, ok := c.loadPizzaIncludingDeleted(ctx)
+	if !ok {
+		return
+	}
+	if !authorizePizzaOwner(ctx, pizza, "You can only restore your own pizzas") {
+		return
+	}
+
+	restored, err := c.service.RestorePizza(pizza.ID)
+	if err != nil {
+		respondDeletedPizzaError(ctx, err, "Failed to restore pizza")
+		return
+	}
+	setPizzaETag(ctx, restored)
+	ctx.JSON(http.StatusOK, restored)
+}
+
+// PurgePizza godoc
+// @Summary Permanently delete a pizza
+// @Description Permanently remove a soft-deleted pizza with its variants (owner or admin).
+// @Description Orders keep their copy of the pizza name and price.
+// @Tags pizzas
+// @Accept json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Success 204
+// @Failure 400 {object} models.APIError
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas/{id}/purge [delete]
+func (c *controller) PurgePizza(ctx *gin.Context) {
+	pizza, ok := c.loadPizzaIncludingDeleted(ctx)
+	if !ok {
+		return
+	}
+	if !authorizePizzaOwner(ctx, pizza, "You can only purge your own pizzas") {
+		return
+	}
+
+	if err := c.service.PurgePizza(pizza.ID); err != nil {
+		respondDeletedPizzaError(ctx, err, "Failed to purge pizza")
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// loadPizzaIncludingDeleted resolves the pizza from the :id path parameter, even if it was soft-deleted
+func (c *controller) loadPizzaIncludingDeleted(ctx *gin.Context) (models.Pizza, bool) {
+	pizzaID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid pizza ID format"))
+		return models.Pizza{}, false
+	}
+
+	pizza, err := c.service.GetPizzaByIDIncludingDeleted(pizzaID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrPizzaNotFound, "Pizza not found"))
+		return models.Pizza{}, false
+	}
+	return pizza, true
+}
+
+// respondDeletedPizzaError maps restore and purge errors to API errors
+func respondDeletedPizzaError(ctx *gin.Context, err error, failureMessage string) {
+	switch {
+	case errors.Is(err, services.ErrPizzaNotDeleted):
+		ctx.JSON(http.StatusConflict, models.NewAPIError(models.ErrConflict, "Pizza is not deleted"))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrPizzaNotFound, "Pizza not found"))
+	default:
+		ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, failureMessage))
+	}
+}
+
+// authorizePizzaOwner checks that the authenticated user created the pizza or is an admin
+// It responds with the appropriate error and returns false when the caller may not modify it
+func authorizePizzaOwner(ctx *gin.Context, pizza models.Pizza, forbiddenMessage string) bool {
+	currentUserID, isAdmin, ok := currentUser(ctx)
+	if !ok {
+		return false
+	}
+
+	if !canModifyPizza(pizza, currentUserID, isAdmin) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"error":       forbiddenMessage,
+			"pizza_owner": pizza.CreatedBy,
+			"your_id":     currentUserID,
+		})
+		return false
+	}
+	return true
+}
+
+// canModifyPizza reports whether the user created the pizza or is an admin
+func canModifyPizza(pizza models.Pizza, userID uint, isAdmin bool) bool {
+	return pizza.CreatedBy == userID || isAdmin
+}
+
+// currentUser reads the authenticated user ID and admin flag set by the auth middleware,
+// responding with the appropriate error when the caller cannot be identified
+func currentUser(ctx *gin.Context) (uint, bool, bool) {
 	// Get the authenticated user ID and role
 	userID, exists := ctx.Get("userID")
 	if !exists {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
+		return 0, false, false
 	}
 
 	userRole, _ := ctx.Get("userRole")
 	isAdmin := userRole == "admin"
 
-	// Check if user is the creator or an admin
-	var currentUserID uint
 	switch v := userID.(type) {
 	case uint:
-		currentUserID = v
+		return v, isAdmin, true
 	case int:
-		currentUserID = uint(v)
+		return uint(v), isAdmin, true
 	case string:
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format for this operation"})
-		return
+		return 0, false, false
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unexpected user ID type"})
+		return 0, false, false
 	}
+}
 
-	if existingPizza.CreatedBy != currentUserID && !isAdmin {
-		ctx.JSON(http.StatusForbidden, gin.H{
-			"error":       "You can only delete your own pizzas",
-			"pizza_owner": existingPizza.CreatedBy,
-			"your_id":     currentUserID,
-		})
-		return
+// parseListOptions reads the filtering, sorting and pagination query parameters of GetAllPizzas
+func parseListOptions(ctx *gin.Context) (services.PizzaListOptions, *services.ValidationError) {
+	opts := services.PizzaListOptions{
+		CreatedBy:       ctx.Query("created_by"),
+		Name:            ctx.Query("name"),
+		Ingredients:     ctx.QueryArray("ingredient"),
+		IngredientMatch: ctx.Query("ingredient_match"),
+		Filter:          ctx.Query("filter"),
+		Sort:            ctx.Query("sort"),
+		Cursor:          ctx.Query("cursor"),
+	}
+
+	if raw, ok := ctx.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return opts, &services.ValidationError{
+				Field:   "limit",
+				Message: fmt.Sprintf("must be between 1 and %d", services.MaxPageLimit),
+			}
+		}
+		opts.Limit = limit
+	}
+
+	if raw := ctx.Query("include_total"); raw != "" {
+		includeTotal, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, &services.ValidationError{Field: "include_total", Message: "must be a boolean"}
+		}
+		opts.IncludeTotal = includeTotal
 	}
 
-	if err := c.service.DeletePizza(pizzaId); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pizza"})
+	if raw := ctx.Query("include_deleted"); raw != "" {
+		includeDeleted, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, &services.ValidationError{Field: "include_deleted", Message: "must be a boolean"}
+		}
+		opts.IncludeDeleted = includeDeleted
+	}
+
+	opts.Currency = ctx.Query("currency")
+	for _, field := range []string{"price_gte", "price_lte"} {
+		raw, ok := ctx.GetQuery(field)
+		if !ok {
+			continue
+		}
+		price, err := services.ParsePriceFilter(field, raw, opts.Currency)
+		if err != nil {
+			return opts, asValidationError(err)
+		}
+		if field == "price_gte" {
+			opts.PriceGTE = &price
+		} else {
+			opts.PriceLTE = &price
+		}
+	}
+
+	for _, field := range []string{"created_after", "updated_after"} {
+		raw, ok := ctx.GetQuery(field)
+		if !ok {
+			continue
+		}
+		ts, err := services.ParseTimeFilter(field, raw)
+		if err != nil {
+			return opts, asValidationError(err)
+		}
+		if field == "created_after" {
+			opts.CreatedAfter = &ts
+		} else {
+			opts.UpdatedAfter = &ts
+		}
+	}
+
+	return opts, nil
+}
+
+// asValidationError unwraps a services.ValidationError, wrapping any other error as one
+func asValidationError(err error) *services.ValidationError {
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr
+	}
+	return &services.ValidationError{Field: "query", Message: err.Error()}
+}
+
+// respondBindError responds to a request body that could not be bound, reporting invalid prices as validation failures
+func respondBindError(ctx *gin.Context, err error) {
+	var moneyErr *models.MoneyError
+	if errors.As(err, &moneyErr) {
+		respondValidationError(ctx, &services.ValidationError{Field: moneyErr.Field, Message: moneyErr.Message})
 		return
 	}
-	ctx.JSON(http.StatusNoContent, nil)
+	ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+}
+
+// respondValidationError responds with a VALIDATION_FAILED APIError describing the rejected parameter
+func respondValidationError(ctx *gin.Context, err *services.ValidationError) {
+	ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrValidationFailed, err.Message, map[string]interface{}{
+		"field": err.Field,
+	}))
 }
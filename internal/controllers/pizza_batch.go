@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MaxPizzaBatchOperations caps the number of operations in a single batch request
+const MaxPizzaBatchOperations = 100
+
+// errBatchAborted rolls back an atomic batch after one of its operations failed
+var errBatchAborted = errors.New("batch_aborted")
+
+// CustomMethods dispatches "/collection:verb" routes registered as "/collection:method"
+// Gin keeps the leading colon in the parameter, so handlers are keyed by the bare verb
+func CustomMethods(handlers map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		handler, ok := handlers[strings.TrimPrefix(ctx.Param("method"), ":")]
+		if !ok {
+			ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrNotFound, "Unknown method"))
+			return
+		}
+		handler(ctx)
+	}
+}
+
+// BatchPizzas godoc
+// @Summary Create, update and delete pizzas in one request
+// @Description Apply up to 100 operations in order. Updates and deletes follow the same ownership rules as
+// @Description PUT and DELETE /pizzas/{id}, and if_match behaves like the If-Match header.
+// @Description In atomic mode every operation runs in one transaction: if any fails nothing is applied, the response
+// @Description carries the status of the failing operation and the other operations report 424 Failed Dependency.
+// @Description Otherwise each operation is applied on its own and the response is 200 with one result per operation.
+// @Tags pizzas
+// @Accept json
+// @Produce json
+// @Param batch body models.PizzaBatchRequest true "Batch operations"
+// @Success 200 {object} models.PizzaBatchResponse
+// @Failure 400 {object} models.APIError
+// @Failure 403 {object} models.PizzaBatchResponse
+// @Failure 404 {object} models.PizzaBatchResponse
+// @Failure 412 {object} models.PizzaBatchResponse
+// @Failure 500 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas:batch [post]
+func (c *controller) BatchPizzas(ctx *gin.Context) {
+	var req models.PizzaBatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		respondBindError(ctx, err)
+		return
+	}
+	if err := validateBatchRequest(req); err != nil {
+		respondValidationError(ctx, err)
+		return
+	}
+
+	userID, isAdmin, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	results := make([]models.PizzaBatchResult, len(req.Operations))
+	if !req.Atomic {
+		for i, op := range req.Operations {
+			results[i] = applyBatchOperation(c.service, userID, isAdmin, i, op)
+		}
+		ctx.JSON(http.StatusOK, models.PizzaBatchResponse{Results: results})
+		return
+	}
+
+	failed := -1
+	err := c.service.Transaction(func(tx services.PizzaService) error {
+		for i, op := range req.Operations {
+			results[i] = applyBatchOperation(tx, userID, isAdmin, i, op)
+			if results[i].Error != nil {
+				failed = i
+				return errBatchAborted
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errBatchAborted):
+		for i, op := range req.Operations {
+			if i != failed {
+				results[i] = batchErrorResult(i, op.Op, http.StatusFailedDependency, models.NewAPIError(models.ErrFailedDependency,
+					fmt.Sprintf("Not applied because operation %d failed", failed), map[string]interface{}{"failed_index": failed}))
+			}
+		}
+		ctx.JSON(results[failed].Status, models.PizzaBatchResponse{Atomic: true, Results: results})
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to apply batch"))
+	default:
+		ctx.JSON(http.StatusOK, models.PizzaBatchResponse{Atomic: true, Results: results})
+	}
+}
+
+// validateBatchRequest rejects malformed batches before any operation is applied
+func validateBatchRequest(req models.PizzaBatchRequest) *services.ValidationError {
+	if len(req.Operations) == 0 {
+		return &services.ValidationError{Field: "operations", Message: "must contain at least one operation"}
+	}
+	if len(req.Operations) > MaxPizzaBatchOperations {
+		return &services.ValidationError{Field: "operations", Message: fmt.Sprintf("must contain at most %d operations", MaxPizzaBatchOperations)}
+	}
+
+	for i, op := range req.Operations {
+		field := fmt.Sprintf("operations[%d]", i)
+		hasPizza := len(op.Pizza) > 0 && string(op.Pizza) != "null"
+		switch op.Op {
+		case models.PizzaBatchCreate:
+			if op.ID != 0 {
+				return &services.ValidationError{Field: field + ".id", Message: "must be omitted for create"}
+			}
+			if !hasPizza {
+				return &services.ValidationError{Field: field + ".pizza", Message: "is required"}
+			}
+		case models.PizzaBatchUpdate, models.PizzaBatchDelete:
+			if op.ID <= 0 {
+				return &services.ValidationError{Field: field + ".id", Message: "is required"}
+			}
+			if op.Op == models.PizzaBatchUpdate && !hasPizza {
+				return &services.ValidationError{Field: field + ".pizza", Message: "is required"}
+			}
+		default:
+			return &services.ValidationError{Field: field + ".op", Message: "must be create, update or delete"}
+		}
+	}
+	return nil
+}
+
+// applyBatchOperation performs one operation with the same checks as the single-pizza handlers
+func applyBatchOperation(service services.PizzaService, userID uint, isAdmin bool, index int, op models.PizzaBatchOperation) models.PizzaBatchResult {
+	var pizza models.Pizza
+	if op.Op != models.PizzaBatchDelete {
+		if err := decodeBatchPizza(op.Pizza, &pizza); err != nil {
+			return batchFailure(index, op.Op, err)
+		}
+	}
+
+	if op.Op == models.PizzaBatchCreate {
+		pizza.CreatedBy = userID
+		created, err := service.CreatePizza(pizza)
+		if err != nil {
+			return batchFailure(index, op.Op, err)
+		}
+		return models.PizzaBatchResult{Index: index, Op: op.Op, Status: http.StatusCreated, Pizza: &created, ETag: pizzaETag(created)}
+	}
+
+	existing, err := service.GetPizzaByID(op.ID)
+	if err != nil {
+		return batchFailure(index, op.Op, err)
+	}
+	if !canModifyPizza(existing, userID, isAdmin) {
+		return batchErrorResult(index, op.Op, http.StatusForbidden, models.NewAPIError(models.ErrForbidden,
+			fmt.Sprintf("You can only %s your own pizzas", op.Op), map[string]interface{}{
+				"pizza_owner": existing.CreatedBy,
+				"your_id":     userID,
+			}))
+	}
+	expectedVersion, ok := ifMatchVersion(op.IfMatch, existing)
+	if !ok {
+		result := batchFailure(index, op.Op, services.ErrPizzaVersionMismatch)
+		result.ETag = pizzaETag(existing)
+		return result
+	}
+
+	if op.Op == models.PizzaBatchDelete {
+		if err := service.DeletePizza(op.ID, expectedVersion); err != nil {
+			return batchFailure(index, op.Op, err)
+		}
+		return models.PizzaBatchResult{Index: index, Op: op.Op, Status: http.StatusNoContent}
+	}
+
+	pizza.ID = op.ID
+	pizza.CreatedBy = existing.CreatedBy
+	pizza.CreatedAt = existing.CreatedAt
+	updated, err := service.UpdatePizza(pizza, expectedVersion)
+	if err != nil {
+		return batchFailure(index, op.Op, err)
+	}
+	return models.PizzaBatchResult{Index: index, Op: op.Op, Status: http.StatusOK, Pizza: &updated, ETag: pizzaETag(updated)}
+}
+
+// decodeBatchPizza decodes the pizza of a single operation so a bad payload only fails that operation
+func decodeBatchPizza(data json.RawMessage, pizza *models.Pizza) error {
+	err := json.Unmarshal(data, pizza)
+	if err == nil {
+		return nil
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &services.ValidationError{Field: typeErr.Field, Message: fmt.Sprintf("must be a %s", typeErr.Type)}
+	}
+	var moneyErr *models.MoneyError
+	if errors.As(err, &moneyErr) {
+		return services.AsMoneyValidationError(err)
+	}
+	return &services.ValidationError{Field: "pizza", Message: "must be a pizza object"}
+}
+
+// batchFailure maps a service error to the result of the failed operation
+func batchFailure(index int, op string, err error) models.PizzaBatchResult {
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return batchErrorResult(index, op, http.StatusBadRequest, models.NewAPIError(models.ErrValidationFailed,
+			validationErr.Message, map[string]interface{}{"field": validationErr.Field}))
+	case errors.Is(err, services.ErrPizzaVersionMismatch):
+		return batchErrorResult(index, op, http.StatusPreconditionFailed, preconditionFailedError())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return batchErrorResult(index, op, http.StatusNotFound, models.NewAPIError(models.ErrPizzaNotFound, "Pizza not found"))
+	default:
+		return batchErrorResult(index, op, http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer,
+			fmt.Sprintf("Failed to %s pizza", op)))
+	}
+}
+
+// batchErrorResult builds the result of an operation that was not applied
+func batchErrorResult(index int, op string, status int, apiErr models.APIError) models.PizzaBatchResult {
+	return models.PizzaBatchResult{Index: index, Op: op, Status: status, Error: &apiErr}
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupPizzaRouter serves the pizza routes over an in-memory database
+// The user of the token is taken from the X-Test-User header instead of OAuth2Auth.
+func setupPizzaRouter(t *testing.T) (*gin.Engine, services.PizzaService) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Ingredient{}, &models.Pizza{}, &models.PizzaIngredient{}, &models.PizzaVariant{}))
+	service := services.NewPizzaService(db)
+	pizzaController := NewPizzaController(service)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/public/pizzas", pizzaController.GetAllPizzas)
+	router.GET("/api/v1/public/pizzas/:id", pizzaController.GetPizzaByID)
+	authenticated := router.Group("/api/v1")
+	authenticated.Use(func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-Test-User"), &userID)
+		c.Set("userID", userID)
+		c.Set("userRole", "user")
+	})
+	authenticated.PUT("/pizzas/:id", pizzaController.UpdatePizza)
+	authenticated.POST("/pizzas:method", CustomMethods(map[string]gin.HandlerFunc{
+		"batch": pizzaController.BatchPizzas,
+	}))
+	return router, service
+}
+
+// seedPizza creates a pizza owned by the user
+func seedPizza(t *testing.T, service services.PizzaService, name string, owner uint) models.Pizza {
+	pizza, err := service.CreatePizza(models.Pizza{
+		Name: name, Price: models.Money{Amount: 1099, Currency: "USD"}, CreatedBy: owner, Ingredients: []string{"Mozzarella"},
+	})
+	require.NoError(t, err)
+	return pizza
+}
+
+func TestBatchPizzas(t *testing.T) {
+	router, service := setupPizzaRouter(t)
+	mine := seedPizza(t, service, "Margherita", 1)
+	theirs := seedPizza(t, service, "Hawaiian", 2)
+
+	batch := func(body string) (*httptest.ResponseRecorder, models.PizzaBatchResponse) {
+		req := httptest.NewRequest("POST", "/api/v1/pizzas:batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", "1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp models.PizzaBatchResponse
+		if w.Code != http.StatusBadRequest {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w, resp
+	}
+	statuses := func(resp models.PizzaBatchResponse) []int {
+		var codes []int
+		for _, result := range resp.Results {
+			codes = append(codes, result.Status)
+		}
+		return codes
+	}
+	pizzaNamed := func(name string) bool {
+		page, err := service.GetAllPizzas(services.PizzaListOptions{Name: name})
+		require.NoError(t, err)
+		return len(page.Items) > 0
+	}
+
+	t.Run("best effort reports each operation", func(t *testing.T) {
+		w, resp := batch(fmt.Sprintf(`{"operations": [
+			{"op": "create", "pizza": {"name": "Calzone", "price": 12.50}},
+			{"op": "update", "id": %[1]d, "if_match": "\"%[1]d-0\"", "pizza": {"name": "Stale", "price": 9}},
+			{"op": "delete", "id": %[2]d},
+			{"op": "update", "id": %[1]d, "if_match": %[3]q, "pizza": {"name": "Margherita Extra", "price": 11}}
+		]}`, mine.ID, theirs.ID, pizzaETag(mine)))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, resp.Atomic)
+		assert.Equal(t, []int{http.StatusCreated, http.StatusPreconditionFailed, http.StatusForbidden, http.StatusOK}, statuses(resp))
+		assert.Equal(t, models.ErrPreconditionFailed, resp.Results[1].Error.Code)
+		assert.Equal(t, pizzaETag(mine), resp.Results[1].ETag, "the failed precondition carries the current ETag")
+		assert.Equal(t, models.ErrForbidden, resp.Results[2].Error.Code)
+		assert.Equal(t, "Margherita Extra", resp.Results[3].Pizza.Name)
+
+		assert.True(t, pizzaNamed("Calzone"))
+		_, err := service.GetPizzaByID(theirs.ID)
+		assert.NoError(t, err)
+		mine, err = service.GetPizzaByID(mine.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("atomic failure rolls every operation back", func(t *testing.T) {
+		w, resp := batch(fmt.Sprintf(`{"atomic": true, "operations": [
+			{"op": "create", "pizza": {"name": "Quattro Formaggi", "price": 13}},
+			{"op": "update", "id": %[1]d, "pizza": {"name": "Rolled Back", "price": 10}},
+			{"op": "delete", "id": %[2]d},
+			{"op": "delete", "id": %[1]d}
+		]}`, mine.ID, theirs.ID))
+
+		// The response carries the status of the failing operation, the others depend on it
+		require.Equal(t, http.StatusForbidden, w.Code)
+		assert.True(t, resp.Atomic)
+		assert.Equal(t, []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusForbidden, http.StatusFailedDependency}, statuses(resp))
+		for _, i := range []int{0, 1, 3} {
+			assert.Equal(t, models.ErrFailedDependency, resp.Results[i].Error.Code)
+			assert.EqualValues(t, 2, resp.Results[i].Error.Details["failed_index"])
+			assert.Nil(t, resp.Results[i].Pizza)
+		}
+
+		assert.False(t, pizzaNamed("Quattro Formaggi"))
+		current, err := service.GetPizzaByID(mine.ID)
+		require.NoError(t, err)
+		assert.Equal(t, mine.Name, current.Name)
+		assert.Equal(t, mine.Version, current.Version)
+	})
+
+	t.Run("atomic failure on a stale if_match", func(t *testing.T) {
+		w, resp := batch(fmt.Sprintf(`{"atomic": true, "operations": [
+			{"op": "create", "pizza": {"name": "Funghi", "price": 11}},
+			{"op": "delete", "id": %[1]d, "if_match": "W/%[2]s"}
+		]}`, mine.ID, strings.ReplaceAll(pizzaETag(mine), `"`, `\"`)))
+
+		require.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, []int{http.StatusFailedDependency, http.StatusPreconditionFailed}, statuses(resp))
+		assert.EqualValues(t, 1, resp.Results[0].Error.Details["failed_index"])
+		assert.Equal(t, pizzaETag(mine), resp.Results[1].ETag)
+		assert.False(t, pizzaNamed("Funghi"))
+	})
+
+	t.Run("atomic success applies every operation", func(t *testing.T) {
+		w, resp := batch(fmt.Sprintf(`{"atomic": true, "operations": [
+			{"op": "create", "pizza": {"name": "Capricciosa", "price": 14}},
+			{"op": "delete", "id": %d, "if_match": %q}
+		]}`, mine.ID, pizzaETag(mine)))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []int{http.StatusCreated, http.StatusNoContent}, statuses(resp))
+		assert.True(t, pizzaNamed("Capricciosa"))
+		_, err := service.GetPizzaByID(mine.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("malformed batches are rejected before any operation", func(t *testing.T) {
+		tooMany := make([]string, MaxPizzaBatchOperations+1)
+		for i := range tooMany {
+			tooMany[i] = `{"op": "create", "pizza": {"name": "Bulk", "price": 1}}`
+		}
+
+		tests := []struct {
+			name  string
+			body  string
+			field string
+		}{
+			{"no operations", `{"operations": []}`, "operations"},
+			{"too many operations", `{"operations": [` + strings.Join(tooMany, ",") + `]}`, "operations"},
+			{"id on create", `{"operations": [{"op": "create", "id": 7, "pizza": {"name": "Bulk", "price": 1}}]}`, "operations[0].id"},
+			{"update without pizza", `{"operations": [{"op": "update", "id": 7}]}`, "operations[0].pizza"},
+			{"unknown op", `{"atomic": true, "operations": [{"op": "upsert", "id": 7}]}`, "operations[0].op"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w, _ := batch(tt.body)
+				require.Equal(t, http.StatusBadRequest, w.Code)
+				var apiErr models.APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, models.ErrValidationFailed, apiErr.Code)
+				assert.Equal(t, tt.field, apiErr.Details["field"])
+			})
+		}
+		assert.False(t, pizzaNamed("Bulk"))
+	})
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxImportBytes caps the size of an import request body
+const maxImportBytes = 10 << 20
+
+// transferContentTypes maps the catalog transfer formats to their media types
+var transferContentTypes = map[string]string{
+	services.TransferFormatCSV:    "text/csv",
+	services.TransferFormatJSON:   "application/json",
+	services.TransferFormatNDJSON: "application/x-ndjson",
+}
+
+// importFormats maps the accepted import Content-Types to transfer formats
+var importFormats = map[string]string{
+	"text/csv":             services.TransferFormatCSV,
+	"application/json":     services.TransferFormatJSON,
+	"application/x-ndjson": services.TransferFormatNDJSON,
+	"application/ndjson":   services.TransferFormatNDJSON,
+}
+
+// ExportPizzas godoc
+// @Summary Export the pizza catalog
+// @Description Stream every pizza as CSV, a JSON array or NDJSON (one pizza per line).
+// @Description The format is taken from the format parameter, or negotiated from the Accept header (JSON by default).
+// @Description CSV ingredients are separated by ';' and cells that spreadsheets would evaluate as formulas are prefixed with a quote.
+// @Tags pizzas
+// @Produce json
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "Export format" Enums(csv, json, ndjson)
+// @Success 200 {array} models.Pizza
+// @Failure 400 {object} models.APIError
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/pizzas/export [get]
+func (c *controller) ExportPizzas(ctx *gin.Context) {
+	format := ctx.Query("format")
+	if format == "" {
+		switch ctx.NegotiateFormat("application/json", "text/csv", "application/x-ndjson", "application/ndjson") {
+		case "text/csv":
+			format = services.TransferFormatCSV
+		case "application/x-ndjson", "application/ndjson":
+			format = services.TransferFormatNDJSON
+		default:
+			format = services.TransferFormatJSON
+		}
+	}
+	contentType, ok := transferContentTypes[format]
+	if !ok {
+		respondValidationError(ctx, &services.ValidationError{Field: "format", Message: fmt.Sprintf("must be one of %s, %s, %s",
+			services.TransferFormatCSV, services.TransferFormatJSON, services.TransferFormatNDJSON)})
+		return
+	}
+
+	ctx.Header("Content-Type", contentType+"; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="pizzas-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+	ctx.Status(http.StatusOK)
+
+	// The status line is sent with the first batch, so a later failure can only truncate the stream
+	if err := c.service.ExportPizzas(format, ctx.Writer); err != nil {
+		log.WithError(err).Error("Failed to export pizzas")
+	}
+}
+
+// ImportPizzas godoc
+// @Summary Import pizzas
+// @Description Create pizzas from a CSV file, a JSON array or NDJSON, all-or-nothing in a single transaction.
+// @Description CSV files need a header with name and price, and may have description, currency and ingredients (';'-separated) columns.
+// @Description Exported read-only columns (id, created_by, created_at, updated_at) are ignored. Imported pizzas belong to the caller.
+// @Description When any row is invalid nothing is imported and details.rows lists an error for every invalid row.
+// @Tags pizzas
+// @Accept text/csv
+// @Accept json
+// @Accept application/x-ndjson
+// @Produce json
+// @Success 201 {object} models.PizzaImportResponse
+// @Failure 400 {object} models.APIError
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} models.APIError
+// @Failure 415 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas/import [post]
+func (c *controller) ImportPizzas(ctx *gin.Context) {
+	userID, _, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	format, ok := importFormats[ctx.ContentType()]
+	if !ok {
+		ctx.JSON(http.StatusUnsupportedMediaType, models.NewAPIError(models.ErrBadRequest,
+			"Content-Type must be text/csv, application/json or application/x-ndjson"))
+		return
+	}
+
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportBytes)
+	created, err := c.service.ImportPizzas(format, body, userID)
+	if err != nil {
+		respondImportError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, models.PizzaImportResponse{Imported: len(created), Data: created})
+}
+
+// respondImportError maps import failures to API errors, with one APIError per invalid row
+func respondImportError(ctx *gin.Context, err error) {
+	var importErr *services.ImportError
+	var validationErr *services.ValidationError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &importErr):
+		rows := make([]models.APIError, 0, len(importErr.Rows))
+		for _, row := range importErr.Rows {
+			rows = append(rows, models.NewAPIError(models.ErrValidationFailed, row.Message, map[string]interface{}{
+				"row":   row.Row,
+				"field": row.Field,
+			}))
+		}
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrValidationFailed,
+			fmt.Sprintf("%d rows are invalid; nothing was imported", len(rows)), map[string]interface{}{
+				"rows": rows,
+			}))
+	case errors.As(err, &validationErr):
+		respondValidationError(ctx, validationErr)
+	case errors.As(err, &tooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, models.NewAPIError(models.ErrBadRequest,
+			fmt.Sprintf("Import must not exceed %d bytes", tooLarge.Limit)))
+	default:
+		ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to import pizzas"))
+	}
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PizzaVariantController handles HTTP requests for the variants nested under a pizza
+type PizzaVariantController interface {
+	// GetVariants lists the variants of a pizza
+	GetVariants(c *gin.Context)
+	// GetVariant retrieves a single variant of a pizza
+	GetVariant(c *gin.Context)
+	// CreateVariant adds a variant to a pizza
+	CreateVariant(c *gin.Context)
+	// UpdateVariant updates a variant of a pizza
+	UpdateVariant(c *gin.Context)
+	// DeleteVariant removes a variant from a pizza
+	DeleteVariant(c *gin.Context)
+}
+
+type variantController struct {
+	pizzas   services.PizzaService
+	variants services.PizzaVariantService
+}
+
+// NewPizzaVariantController creates a new instance of PizzaVariantController
+func NewPizzaVariantController(pizzas services.PizzaService, variants services.PizzaVariantService) *variantController {
+	return &variantController{pizzas: pizzas, variants: variants}
+}
+
+// variantRequest is the request body for creating or updating a variant
+type variantRequest struct {
+	SKU   string `json:"sku" binding:"required" example:"MARG-L-THIN"`
+	Size  string `json:"size" binding:"required" example:"large"`
+	Crust string `json:"crust" example:"thin"`
+	// Price is an exact decimal amount, given as a JSON number or string
+	Price json.RawMessage `json:"price" binding:"required" swaggertype:"string" example:"14.99"`
+	// Currency is an ISO 4217 code and defaults to the configured currency
+	Currency string `json:"currency" example:"USD"`
+	// Available defaults to true when omitted
+	Available *bool `json:"available" example:"true"`
+}
+
+// toModel converts the request into a variant of the given pizza
+func (r variantRequest) toModel(pizzaID int) (models.PizzaVariant, error) {
+	price, err := models.MoneyJSON{Price: r.Price, Currency: r.Currency}.ToMoney()
+	if err != nil {
+		return models.PizzaVariant{}, services.AsMoneyValidationError(err)
+	}
+
+	available := true
+	if r.Available != nil {
+		available = *r.Available
+	}
+	return models.PizzaVariant{
+		PizzaID:   pizzaID,
+		SKU:       r.SKU,
+		Size:      r.Size,
+		Crust:     r.Crust,
+		Price:     price,
+		Available: available,
+	}, nil
+}
+
+// GetVariants godoc
+// @Summary Get pizza variants
+// @Description Get the sizes and crust options of a pizza
+// @Tags variants
+// @Accept json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Success 200 {array} models.PizzaVariant
+// @Failure 400 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Router /api/v1/public/pizzas/{id}/variants [get]
+func (c *variantController) GetVariants(ctx *gin.Context) {
+	pizza, ok := c.loadPizza(ctx)
+	if !ok {
+		return
+	}
+
+	variants, err := c.variants.GetVariants(pizza.ID)
+	if err != nil {
+		respondVariantError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, variants)
+}
+
+// GetVariant godoc
+// @Summary Get a pizza variant
+// @Description Get a single variant of a pizza
+// @Tags variants
+// @Accept json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Param variant_id path int true "Variant ID"
+// @Success 200 {object} models.PizzaVariant
+// @Failure 400 {object} models.APIError
+// @Failure 404 {object} models.APIError
+// @Router /api/v1/public/pizzas/{id}/variants/{variant_id} [get]
+func (c *variantController) GetVariant(ctx *gin.Context) {
+	pizza, ok := c.loadPizza(ctx)
+	if !ok {
+		return
+	}
+	variantID, ok := parseVariantID(ctx)
+	if !ok {
+		return
+	}
+
+	variant, err := c.variants.GetVariant(pizza.ID, variantID)
+	if err != nil {
+		respondVariantError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, variant)
+}
+
+// CreateVariant godoc
+// @Summary Create a pizza variant
+// @Description Add a size/crust variant to a pizza (owner or admin)
+// @Tags variants
+// @Accept json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Param variant body variantRequest true "Variant"
+// @Success 201 {object} models.PizzaVariant
+// @Failure 400 {object} models.APIError
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas/{id}/variants [post]
+func (c *variantController) CreateVariant(ctx *gin.Context) {
+	pizza, ok := c.loadPizza(ctx)
+	if !ok {
+		return
+	}
+	if !authorizePizzaOwner(ctx, pizza, "You can only manage variants of your own pizzas") {
+		return
+	}
+
+	var req variantRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid request body"))
+		return
+	}
+
+	variant, err := req.toModel(pizza.ID)
+	if err != nil {
+		respondVariantError(ctx, err)
+		return
+	}
+
+	variant, err = c.variants.CreateVariant(variant)
+	if err != nil {
+		respondVariantError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, variant)
+}
+
+// UpdateVariant godoc
+// @Summary Update a pizza variant
+// @Description Replace a variant of a pizza (owner or admin)
+// @Tags variants
+// @Accept json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Param variant_id path int true "Variant ID"
+// @Param variant body variantRequest true "Variant"
+// @Success 200 {object} models.PizzaVariant
+// @Failure 400 {object} models.APIError
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} models.APIError
+// @Failure 409 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas/{id}/variants/{variant_id} [put]
+func (c *variantController) UpdateVariant(ctx *gin.Context) {
+	pizza, ok := c.loadPizza(ctx)
+	if !ok {
+		return
+	}
+	variantID, ok := parseVariantID(ctx)
+	if !ok {
+		return
+	}
+	if !authorizePizzaOwner(ctx, pizza, "You can only manage variants of your own pizzas") {
+		return
+	}
+
+	var req variantRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid request body"))
+		return
+	}
+
+	variant, err := req.toModel(pizza.ID)
+	if err != nil {
+		respondVariantError(ctx, err)
+		return
+	}
+	variant.ID = variantID
+
+	updated, err := c.variants.UpdateVariant(variant)
+	if err != nil {
+		respondVariantError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// DeleteVariant godoc
+// @Summary Delete a pizza variant
+// @Description Remove a variant from a pizza (owner or admin)
+// @Tags variants
+// @Accept json
+// @Produce json
+// @Param id path int true "Pizza ID"
+// @Param variant_id path int true "Variant ID"
+// @Success 204
+// @Failure 400 {object} models.APIError
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} models.APIError
+// @Security BearerAuth
+// @Router /api/v1/pizzas/{id}/variants/{variant_id} [delete]
+func (c *variantController) DeleteVariant(ctx *gin.Context) {
+	pizza, ok := c.loadPizza(ctx)
+	if !ok {
+		return
+	}
+	variantID, ok := parseVariantID(ctx)
+	if !ok {
+		return
+	}
+	if !authorizePizzaOwner(ctx, pizza, "You can only manage variants of your own pizzas") {
+		return
+	}
+
+	if err := c.variants.DeleteVariant(pizza.ID, variantID); err != nil {
+		respondVariantError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// loadPizza resolves the parent pizza from the :id path parameter
+func (c *variantController) loadPizza(ctx *gin.Context) (models.Pizza, bool) {
+	pizzaID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid pizza ID format"))
+		return models.Pizza{}, false
+	}
+
+	pizza, err := c.pizzas.GetPizzaByID(pizzaID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrPizzaNotFound, "Pizza not found"))
+		return models.Pizza{}, false
+	}
+	return pizza, true
+}
+
+// parseVariantID reads the :variant_id path parameter, responding with 400 when it is not numeric
+func parseVariantID(ctx *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("variant_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid variant ID format"))
+		return 0, false
+	}
+	return id, true
+}
+
+// respondVariantError maps variant service errors to API errors
+func respondVariantError(ctx *gin.Context, err error) {
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		respondValidationError(ctx, validationErr)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, models.NewAPIError(models.ErrNotFound, "Variant not found"))
+	case errors.Is(err, services.ErrVariantSKUExists):
+		ctx.JSON(http.StatusConflict, models.NewAPIError(models.ErrConflict, "A variant with this SKU already exists"))
+	default:
+		ctx.JSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer, "Failed to process variant"))
+	}
+}
@@ -0,0 +1,14 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// CacheControl sets the Cache-Control header of the response to the given directives
+// An empty value leaves caching to the client's heuristics
+func CacheControl(directives string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if directives != "" {
+			c.Header("Cache-Control", directives)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxIdempotencyKeyLength bounds the Idempotency-Key header
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes bounds the request bodies buffered for fingerprinting
+	maxIdempotentBodyBytes = 10 << 20
+)
+
+// replayedHeaders are the response headers stored with an idempotent response besides its body
+var replayedHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Location"}
+
+// Idempotency makes mutating requests safe to retry when they carry an Idempotency-Key header
+// The first response to a key is stored per authenticated clientID and userID, and replayed to every retry.
+// Reusing a key for a different request is rejected with 409 CONFLICT, as are retries that arrive
+// while the first request is still running. Server errors are not stored, so those requests can be
+// retried with the same key. Must run after OAuth2Auth.
+func Idempotency(service services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		scope := services.IdempotencyScope{ClientID: c.GetString("clientID"), UserID: c.GetUint("userID")}
+		if key == "" || scope.ClientID == "" || !isMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest,
+				"Idempotency-Key must not be longer than 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, models.NewAPIError(models.ErrBadRequest,
+				"Request body is too large"))
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.NewAPIError(models.ErrBadRequest, "Invalid request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := service.Begin(scope, key, requestFingerprint(c.Request, body))
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusConflict, models.NewAPIError(models.ErrConflict,
+				"Idempotency-Key was already used for a different request"))
+			return
+		case errors.Is(err, services.ErrIdempotencyKeyInProgress):
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, models.NewAPIError(models.ErrConflict,
+				"A request with this Idempotency-Key is still being processed"))
+			return
+		case err != nil:
+			log.WithError(err).Error("Failed to look up idempotency key")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.NewAPIError(models.ErrInternalServer,
+				"Failed to process Idempotency-Key"))
+			return
+		case stored != nil:
+			for name, value := range stored.Headers {
+				c.Header(name, value)
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Status(stored.StatusCode)
+			_, _ = c.Writer.Write(stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// Release the key when the handler failed or panicked so the client can retry
+			if !completed {
+				if err := service.Release(scope, key); err != nil {
+					log.WithError(err).Error("Failed to release idempotency key")
+				}
+			}
+		}()
+
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		err = service.Complete(scope, key, services.StoredResponse{
+			StatusCode: recorder.Status(),
+			Headers:    headers,
+			Body:       recorder.body.Bytes(),
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed to store idempotent response")
+			return
+		}
+		completed = true
+	}
+}
+
+// isMutatingMethod reports whether requests with the method change server state
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestFingerprint hashes what makes two requests with the same key the same request
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n"+r.Header.Get("Content-Type")+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body while it is written to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
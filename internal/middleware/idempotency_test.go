@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/franciscosanchezn/gin-pizza-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIdempotencyIsScopedToTheUser(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.IdempotencyRecord{}))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// The user of the token is taken from a header instead of OAuth2Auth
+	router.Use(func(c *gin.Context) {
+		c.Set("clientID", "web")
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-Test-User"), &userID)
+		c.Set("userID", userID)
+	})
+	router.Use(Idempotency(services.NewIdempotencyService(db, time.Hour)))
+	orders := 0
+	router.POST("/orders", func(c *gin.Context) {
+		orders++
+		c.JSON(http.StatusCreated, gin.H{"id": orders, "user_id": c.GetUint("userID")})
+	})
+
+	order := func(userID uint) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"pizza_id": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "order-1")
+		req.Header.Set("X-Test-User", fmt.Sprint(userID))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := order(1)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id": 1, "user_id": 1}`, w.Body.String())
+
+	// Another user of the same client sending the same key and request gets their own order,
+	// not the response stored for the first user
+	w = order(2)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, `{"id": 2, "user_id": 2}`, w.Body.String())
+
+	// Each user's retry replays their own response
+	w = order(1)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, `{"id": 1, "user_id": 1}`, w.Body.String())
+	w = order(2)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, `{"id": 2, "user_id": 2}`, w.Body.String())
+	assert.Equal(t, 2, orders)
+}
@@ -11,10 +11,21 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// RevocationList reports whether an access token, identified by its jti claim, was revoked before it expired
+type RevocationList interface {
+	IsRevoked(jti string) bool
+}
+
+// VerificationKeys resolves the signing method and key that verify a token from the kid in its header
+type VerificationKeys interface {
+	VerificationKey(kid string) (jwt.SigningMethod, interface{}, error)
+}
+
 // OAuth2Auth middleware that handles OAuth2 JWT access tokens
 // This middleware validates JWT tokens and extracts user information from claims
-// following RFC 6749 (OAuth2) and RFC 7519 (JWT) specifications
-func OAuth2Auth(jwtSecret []byte) gin.HandlerFunc {
+// following RFC 6749 (OAuth2) and RFC 7519 (JWT) specifications.
+// Tokens whose jti is on the revocation list are rejected; revocations may be nil.
+func OAuth2Auth(keys VerificationKeys, revocations RevocationList) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// RFC 6750: Extract Bearer token from Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -39,12 +50,18 @@ func OAuth2Auth(jwtSecret []byte) gin.HandlerFunc {
 		}
 
 		// Parse and validate the JWT token
-		claims, err := parseAndValidateJWT(tokenString, jwtSecret)
+		claims, err := ParseAndValidateJWT(tokenString, keys)
 		if err != nil {
 			respondWithOAuth2Error(c, http.StatusUnauthorized, "invalid_token", err.Error())
 			return
 		}
 
+		// Reject tokens revoked through the revocation endpoint (RFC 7009)
+		if jti, _ := claims["jti"].(string); revocations != nil && revocations.IsRevoked(jti) {
+			respondWithOAuth2Error(c, http.StatusUnauthorized, "invalid_token", "Token has been revoked")
+			return
+		}
+
 		// Extract and validate required claims, setting context
 		if err := extractAndSetClaims(c, claims); err != nil {
 			respondWithOAuth2Error(c, http.StatusUnauthorized, "invalid_token", err.Error())
@@ -64,19 +81,29 @@ func respondWithOAuth2Error(c *gin.Context, status int, errorCode, description s
 	c.Abort()
 }
 
-// parseJWTToken validates and parses a JWT token using HMAC signing method
+// KeyFunc looks up the verification key named by the token's kid header
+// The token must use the algorithm of that key, which prevents algorithm confusion attacks
+// where an attacker changes the algorithm header, e.g. to HMAC keyed with a public key
+// See: https://auth0.com/blog/critical-vulnerabilities-in-json-web-token-libraries/
+func KeyFunc(keys VerificationKeys) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		method, key, err := keys.VerificationKey(kid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kid %q: %w", kid, err)
+		}
+		if token.Method.Alg() != method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v. Expected %s", token.Header["alg"], method.Alg())
+		}
+		return key, nil
+	}
+}
+
+// parseJWTToken validates and parses a JWT token signed by one of the verification keys
 // Returns the claims if valid, error otherwise
-func parseJWTToken(tokenString string, jwtSecret []byte) (jwt.MapClaims, error) {
+func parseJWTToken(tokenString string, keys VerificationKeys) (jwt.MapClaims, error) {
 	// Parse with validation
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method to prevent algorithm confusion attacks
-		// This protects against attacks where an attacker changes the algorithm header
-		// See: https://auth0.com/blog/critical-vulnerabilities-in-json-web-token-libraries/
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v. Expected HMAC", token.Header["alg"])
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.Parse(tokenString, KeyFunc(keys))
 
 	if err != nil {
 		return nil, fmt.Errorf("token parsing failed: %w", err)
@@ -95,9 +122,10 @@ func parseJWTToken(tokenString string, jwtSecret []byte) (jwt.MapClaims, error)
 	return claims, nil
 }
 
-// parseAndValidateJWT parses the JWT and performs strict validation
-func parseAndValidateJWT(tokenString string, jwtSecret []byte) (jwt.MapClaims, error) {
-	claims, err := parseJWTToken(tokenString, jwtSecret)
+// ParseAndValidateJWT parses the JWT and performs strict validation
+// It is shared with the token introspection endpoint so both apply the same rules
+func ParseAndValidateJWT(tokenString string, keys VerificationKeys) (jwt.MapClaims, error) {
+	claims, err := parseJWTToken(tokenString, keys)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope is a middleware that allows the request when the token was granted any of the scopes
+// It must run after OAuth2Auth, which stores the token's scopes in the context
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return requireScopes(scopes, false)
+}
+
+// RequireAllScopes is a middleware that allows the request only when the token was granted every scope
+func RequireAllScopes(scopes ...string) gin.HandlerFunc {
+	return requireScopes(scopes, true)
+}
+
+func requireScopes(required []string, all bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := make(map[string]bool)
+		for _, scope := range models.SplitScopes(c.GetString("scopes")) {
+			granted[scope] = true
+		}
+
+		matched := 0
+		for _, scope := range required {
+			if granted[scope] {
+				matched++
+			}
+		}
+		if (all && matched < len(required)) || (!all && matched == 0) {
+			respondInsufficientScope(c, required, all)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// respondInsufficientScope rejects the request as described in RFC 6750 section 3.1
+// The scope attribute of the WWW-Authenticate header lists the scopes that would be accepted
+func respondInsufficientScope(c *gin.Context, required []string, all bool) {
+	scope := strings.Join(required, " ")
+	description := fmt.Sprintf("The access token requires one of the scopes: %s", scope)
+	if all {
+		description = fmt.Sprintf("The access token requires all of the scopes: %s", scope)
+	}
+	c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", error_description=%q, scope=%q`, description, scope))
+	respondWithOAuth2Error(c, http.StatusForbidden, "insufficient_scope", description)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// serve runs the middleware for a token granted the scopes; nil stands for a token that has no scope claim
+	serve := func(middleware gin.HandlerFunc, scopes *string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/", func(c *gin.Context) {
+			if scopes != nil {
+				c.Set("scopes", *scopes)
+			}
+		}, middleware, func(c *gin.Context) {
+			c.String(http.StatusOK, "ok")
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+	granted := func(scopes string) *string { return &scopes }
+
+	writePizzas := RequireScope(models.ScopePizzasWrite, models.ScopeLegacyWrite)
+	adminKeys := RequireAllScopes(models.ScopeKeysAdmin, models.ScopeClientsAdmin)
+
+	tests := []struct {
+		name       string
+		middleware gin.HandlerFunc
+		scopes     *string
+		allowed    bool
+	}{
+		{"any of, first scope", writePizzas, granted("read pizzas:write"), true},
+		{"any of, legacy write scope", writePizzas, granted("read write"), true},
+		{"any of, other resource", writePizzas, granted("read orders:write"), false},
+		{"any of, scope prefix", writePizzas, granted("pizzas"), false},
+		{"all of, every scope", adminKeys, granted("clients:admin read keys:admin"), true},
+		{"all of, one scope missing", adminKeys, granted("keys:admin"), false},
+		{"all of, legacy write scope", adminKeys, granted("write"), false},
+		{"empty scope", writePizzas, granted(""), false},
+		{"no scope claim", writePizzas, nil, false},
+		{"all of, no scope claim", adminKeys, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.middleware, tt.scopes)
+			if tt.allowed {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "ok", w.Body.String())
+				assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+			} else {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+				assert.Contains(t, w.Body.String(), `"error":"insufficient_scope"`)
+			}
+		})
+	}
+
+	// The rejection is the RFC 6750 insufficient_scope error, naming the scopes that would be accepted
+	w := serve(writePizzas, granted("read"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{
+		"error": "insufficient_scope",
+		"error_description": "The access token requires one of the scopes: pizzas:write write"
+	}`, w.Body.String())
+	assert.Equal(t,
+		`Bearer error="insufficient_scope", error_description="The access token requires one of the scopes: pizzas:write write", scope="pizzas:write write"`,
+		w.Header().Get("WWW-Authenticate"))
+
+	w = serve(adminKeys, granted("keys:admin"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{
+		"error": "insufficient_scope",
+		"error_description": "The access token requires all of the scopes: keys:admin clients:admin"
+	}`, w.Body.String())
+	assert.Equal(t,
+		`Bearer error="insufficient_scope", error_description="The access token requires all of the scopes: keys:admin clients:admin", scope="keys:admin clients:admin"`,
+		w.Header().Get("WWW-Authenticate"))
+}
@@ -10,13 +10,15 @@ type APIError struct {
 // Error code constants
 const (
 	// General errors
-	ErrBadRequest       = "BAD_REQUEST"
-	ErrUnauthorized     = "UNAUTHORIZED"
-	ErrForbidden        = "FORBIDDEN"
-	ErrNotFound         = "NOT_FOUND"
-	ErrConflict         = "CONFLICT"
-	ErrInternalServer   = "INTERNAL_SERVER_ERROR"
-	ErrValidationFailed = "VALIDATION_FAILED"
+	ErrBadRequest         = "BAD_REQUEST"
+	ErrUnauthorized       = "UNAUTHORIZED"
+	ErrForbidden          = "FORBIDDEN"
+	ErrNotFound           = "NOT_FOUND"
+	ErrConflict           = "CONFLICT"
+	ErrInternalServer     = "INTERNAL_SERVER_ERROR"
+	ErrValidationFailed   = "VALIDATION_FAILED"
+	ErrPreconditionFailed = "PRECONDITION_FAILED"
+	ErrFailedDependency   = "FAILED_DEPENDENCY"
 
 	// Pizza-specific errors
 	ErrPizzaNotFound        = "PIZZA_NOT_FOUND"
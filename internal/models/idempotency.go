@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers the response to a request sent with an Idempotency-Key header
+// Keys are scoped to the OAuth client and the user of the token, and stored only as hashes. The
+// response body is encrypted with a key derived from the Idempotency-Key, so it can only be read
+// by a retry of the request.
+type IdempotencyRecord struct {
+	ID       uint   `gorm:"primaryKey"`
+	ClientID string `gorm:"size:255;not null;uniqueIndex:idx_idempotency_scope_key"`
+	UserID   uint   `gorm:"not null;default:0;uniqueIndex:idx_idempotency_scope_key"`
+	KeyHash  string `gorm:"size:64;not null;uniqueIndex:idx_idempotency_scope_key"`
+	// RequestHash fingerprints the method, URL and body so a reused key with another payload is detected
+	RequestHash string `gorm:"size:64;not null"`
+	// StatusCode is zero while the first request is still being processed
+	StatusCode int
+	Headers    map[string]string `gorm:"serializer:json"`
+	Body       []byte
+	CreatedAt  time.Time `gorm:"index:idx_idempotency_created_at"`
+	UpdatedAt  time.Time
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Ingredient is a catalog entry shared by every pizza that uses it
+type Ingredient struct {
+	ID   int    `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"not null"`
+	// NormalizedName is the case- and whitespace-insensitive key used to deduplicate the catalog
+	NormalizedName string    `json:"-" gorm:"not null;uniqueIndex:idx_ingredient_normalized_name"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PizzaIngredient joins pizzas to catalog ingredients, keeping the order they were listed in
+type PizzaIngredient struct {
+	PizzaID      int         `gorm:"primaryKey;autoIncrement:false"`
+	IngredientID int         `gorm:"primaryKey;autoIncrement:false;index:idx_pizza_ingredient_ingredient_id"`
+	Position     int         `gorm:"not null;default:0"`
+	Ingredient   *Ingredient `gorm:"foreignKey:IngredientID"`
+}
+
+// CleanIngredientName trims an ingredient name and collapses internal runs of whitespace
+func CleanIngredientName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// NormalizeIngredientName returns the catalog key for an ingredient name,
+// so "Mozzarella" and "mozzarella " resolve to the same ingredient
+func NormalizeIngredientName(name string) string {
+	return strings.ToLower(CleanIngredientName(name))
+}
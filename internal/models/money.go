@@ -0,0 +1,180 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount expressed in the minor unit (e.g. cents) of an ISO 4217 currency
+// Amounts are never stored or computed as floating point, so 10.99 always round-trips as 10.99
+type Money struct {
+	Amount   int64  `gorm:"not null;default:0"`
+	Currency string `gorm:"size:3;not null;default:''"`
+}
+
+// defaultCurrency is applied to prices submitted without a currency
+var defaultCurrency = "USD"
+
+// currencyExponents maps active ISO 4217 codes that do not use two decimal places to their minor unit exponent
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// twoDecimalCurrencies lists the active ISO 4217 codes with a minor unit of two decimal places
+var twoDecimalCurrencies = strings.Fields(`
+	AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BRL BSD BTN BWP BYN BZD
+	CAD CDF CHF CNY COP CRC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD
+	GTQ GYD HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD
+	MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP
+	PKR PLN QAR RON RSD RUB SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS
+	TMT TOP TRY TTD TWD TZS UAH USD UZS VES WST XCD YER ZAR ZMW ZWL`)
+
+func init() {
+	for _, code := range twoDecimalCurrencies {
+		currencyExponents[code] = 2
+	}
+}
+
+// MoneyError reports a price or currency that cannot be represented exactly
+type MoneyError struct {
+	Field   string
+	Message string
+}
+
+func (e *MoneyError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+// CurrencyExponent returns the number of decimal places of an ISO 4217 currency
+func CurrencyExponent(currency string) (int, error) {
+	exponent, ok := currencyExponents[strings.ToUpper(strings.TrimSpace(currency))]
+	if !ok {
+		return 0, &MoneyError{Field: "currency", Message: fmt.Sprintf("'%s' is not an ISO 4217 currency code", currency)}
+	}
+	return exponent, nil
+}
+
+// SetDefaultCurrency changes the currency applied to prices submitted without one
+func SetDefaultCurrency(currency string) error {
+	if _, err := CurrencyExponent(currency); err != nil {
+		return err
+	}
+	defaultCurrency = strings.ToUpper(strings.TrimSpace(currency))
+	return nil
+}
+
+// DefaultCurrency returns the currency applied to prices submitted without one
+func DefaultCurrency() string {
+	return defaultCurrency
+}
+
+// ParseMoney converts a decimal string such as "10.99" into an exact amount of the currency
+// An empty currency selects the default. Values with more decimals than the currency allows,
+// negative values and exponent notation are rejected rather than rounded.
+func ParseMoney(value, currency string) (Money, error) {
+	if strings.TrimSpace(currency) == "" {
+		currency = defaultCurrency
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	value = strings.TrimSpace(value)
+	invalid := &MoneyError{Field: "price", Message: fmt.Sprintf("'%s' is not a valid amount", value)}
+	if value == "" || strings.ContainsAny(value, "eE+") {
+		return Money{}, invalid
+	}
+	if strings.HasPrefix(value, "-") {
+		return Money{}, &MoneyError{Field: "price", Message: "must not be negative"}
+	}
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" {
+		return Money{}, invalid
+	}
+	if len(fraction) > exponent {
+		return Money{}, &MoneyError{Field: "price", Message: fmt.Sprintf("%s supports at most %d decimal places", currency, exponent)}
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, invalid
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Validate checks that the amount is non-negative and the currency is a known ISO 4217 code
+func (m Money) Validate() error {
+	if m.Amount < 0 {
+		return &MoneyError{Field: "price", Message: "must not be negative"}
+	}
+	if _, err := CurrencyExponent(m.Currency); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Decimal renders the amount as an exact decimal string in the currency's major unit
+func (m Money) Decimal() string {
+	exponent, err := CurrencyExponent(m.Currency)
+	if err != nil {
+		exponent = 2
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exponent == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+
+	scale := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, exponent, amount%scale)
+}
+
+// MoneyJSON is the wire form of a price embedded in a JSON resource
+// price is written as an exact decimal number and accepted as a number or a string
+type MoneyJSON struct {
+	Price      json.RawMessage `json:"price"`
+	PriceMinor int64           `json:"price_minor"`
+	Currency   string          `json:"currency"`
+}
+
+// NewMoneyJSON builds the JSON representation of a price
+func NewMoneyJSON(m Money) MoneyJSON {
+	return MoneyJSON{
+		Price:      json.RawMessage(m.Decimal()),
+		PriceMinor: m.Amount,
+		Currency:   m.Currency,
+	}
+}
+
+// ToMoney parses the JSON representation of a price without passing through float64
+func (f MoneyJSON) ToMoney() (Money, error) {
+	raw := strings.TrimSpace(string(f.Price))
+	if raw == "" || raw == "null" {
+		// Omitted prices have always defaulted to zero
+		raw = "0"
+	}
+	if strings.HasPrefix(raw, `"`) {
+		var s string
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			return Money{}, &MoneyError{Field: "price", Message: "is not a valid amount"}
+		}
+		raw = s
+	}
+	return ParseMoney(raw, f.Currency)
+}
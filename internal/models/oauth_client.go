@@ -2,19 +2,38 @@ package models
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// OAuth scopes required by the API routes
+const (
+	ScopePizzasWrite      = "pizzas:write"
+	ScopeOrdersWrite      = "orders:write"
+	ScopeIngredientsWrite = "ingredients:write"
+	ScopeClientsAdmin     = "clients:admin"
+	ScopeKeysAdmin        = "keys:admin"
+	// ScopeOpenID asks for an OpenID Connect ID token; ScopeProfile and ScopeEmail add the user's name and email
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	// ScopeLegacyWrite was granted before per-resource scopes existed and still satisfies every *:write scope
+	ScopeLegacyWrite = "write"
+)
+
+// DefaultClientGrantTypes are given to clients registered without grant types
+const DefaultClientGrantTypes = "client_credentials refresh_token"
+
 type OAuthClient struct {
 	ID          string `gorm:"primaryKey"`
 	Secret      string `gorm:"not null"`
 	Name        string
 	Domain      string
 	UserID      uint   // Reference to User model for admin management
-	Scopes      string // Space-separated list of allowed scopes
+	Scopes      string // Space-separated list of allowed scopes, see NormalizeScopes
 	GrantTypes  string // Space-separated list: "authorization_code client_credentials"
 	RedirectURI string // validation tags can be added as needed
 	CreatedAt   time.Time
@@ -48,6 +67,53 @@ func (c *OAuthClient) GetUserID() string {
 	return fmt.Sprint(c.UserID)
 }
 
+// HasScope reports whether the client is allowed the scope
+func (c *OAuthClient) HasScope(scope string) bool {
+	for _, allowed := range SplitScopes(c.Scopes) {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGrantType reports whether the client is registered for the grant type
+func (c *OAuthClient) AllowsGrantType(grantType string) bool {
+	for _, allowed := range SplitScopes(c.GrantTypes) {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize rewrites the scopes and grant types space-separated, defaulting the grant types
+func (c *OAuthClient) Normalize() {
+	c.Scopes = NormalizeScopes(c.Scopes)
+	c.GrantTypes = NormalizeScopes(c.GrantTypes)
+	if c.GrantTypes == "" {
+		c.GrantTypes = DefaultClientGrantTypes
+	}
+}
+
+// NormalizeScopes returns the scopes space-separated and without duplicates, keeping their order
+func NormalizeScopes(scope string) string {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, s := range SplitScopes(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// SplitScopes splits a scope string on spaces, the OAuth2 separator, as well as on commas
+func SplitScopes(scope string) []string {
+	return strings.FieldsFunc(scope, func(r rune) bool { return r == ' ' || r == ',' })
+}
+
 func (OAuthClient) TableName() string {
 	return "oauth_clients"
 }
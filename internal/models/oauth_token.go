@@ -0,0 +1,98 @@
+package models
+
+import "time"
+
+// OAuthToken persists the token information issued by the OAuth2 server so it survives restarts
+// and is shared by every replica. Codes and tokens are indexed by their SHA-256 digest, which keeps
+// the indexes small even though JWTs run to hundreds of bytes.
+type OAuthToken struct {
+	ID          uint   `gorm:"primaryKey"`
+	CodeHash    string `gorm:"size:64;index:idx_oauth_token_code"`
+	AccessHash  string `gorm:"size:64;index:idx_oauth_token_access"`
+	RefreshHash string `gorm:"size:64;index:idx_oauth_token_refresh"`
+	// Data is the JSON encoded go-oauth2 token information
+	Data []byte `gorm:"not null"`
+	// ExpiresAt is the latest expiry of the code, access token and refresh token
+	ExpiresAt time.Time `gorm:"not null;index:idx_oauth_token_expires_at"`
+	// FamilyID links every token obtained by rotating the refresh token of one original grant
+	FamilyID string `gorm:"size:32;index:idx_oauth_token_family"`
+	// RotatedAt is set once the refresh token has been exchanged; the entry is kept to detect reuse
+	RotatedAt *time.Time
+	CreatedAt time.Time
+}
+
+func (OAuthToken) TableName() string {
+	return "oauth_tokens"
+}
+
+// RevokedToken denylists an access token, identified by its jti claim, until it expires
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:32"`
+	ExpiresAt time.Time `gorm:"not null;index:idx_revoked_token_expires_at"`
+	CreatedAt time.Time
+}
+
+func (RevokedToken) TableName() string {
+	return "oauth_revoked_tokens"
+}
+
+// SigningKeyRecord stores a key of the token signing key ring, shared by every replica
+// The newest key that is not retired signs new tokens. Retired keys keep verifying the tokens they
+// signed until ExpiresAt, when they are removed. PrivateKey is encrypted with a key derived from JWT_SECRET.
+type SigningKeyRecord struct {
+	KID       string `gorm:"column:kid;primaryKey;size:64"`
+	Algorithm string `gorm:"size:16;not null"`
+	// PrivateKey is the sealed PKCS #8 private key, or the HMAC secret
+	PrivateKey []byte `gorm:"not null"`
+	RetiredAt  *time.Time
+	ExpiresAt  *time.Time `gorm:"index:idx_signing_key_expires_at"`
+	CreatedAt  time.Time
+}
+
+func (SigningKeyRecord) TableName() string {
+	return "oauth_signing_keys"
+}
+
+// DeviceAuthorizationStatus is the state of a device authorization request
+type DeviceAuthorizationStatus string
+
+const (
+	DeviceAuthorizationPending  DeviceAuthorizationStatus = "pending"
+	DeviceAuthorizationApproved DeviceAuthorizationStatus = "approved"
+	DeviceAuthorizationDenied   DeviceAuthorizationStatus = "denied"
+)
+
+// DeviceAuthorization is a request of the device authorization grant (RFC 8628), from when the device
+// asks for it until the device redeems its device code. The device code is stored as its SHA-256
+// digest, like codes and tokens; the user code is what the user types on the verification page.
+type DeviceAuthorization struct {
+	DeviceCodeHash string                    `gorm:"primaryKey;size:64"`
+	UserCode       string                    `gorm:"size:8;not null;uniqueIndex:idx_device_authorization_user_code"`
+	ClientID       string                    `gorm:"not null"`
+	Scope          string                    `gorm:"not null"`
+	Status         DeviceAuthorizationStatus `gorm:"size:16;not null"`
+	// UserID is the user who approved the request
+	UserID string
+	// Interval is the number of seconds the device must wait between polls; slow_down increases it
+	Interval     int `gorm:"not null"`
+	LastPolledAt *time.Time
+	ExpiresAt    time.Time `gorm:"not null;index:idx_device_authorization_expires_at"`
+	CreatedAt    time.Time
+}
+
+func (DeviceAuthorization) TableName() string {
+	return "oauth_device_authorizations"
+}
+
+// LoginFailure records a failed sign-in on the sign-in pages, once for the account and once for the
+// client IP address, so password guessing can be throttled on every replica. Subjects are stored as
+// SHA-256 digests, which keeps emails and addresses out of the table.
+type LoginFailure struct {
+	ID          uint      `gorm:"primaryKey"`
+	SubjectHash string    `gorm:"size:64;not null;index:idx_login_failure_subject"`
+	CreatedAt   time.Time `gorm:"not null;index:idx_login_failure_created_at"`
+}
+
+func (LoginFailure) TableName() string {
+	return "oauth_login_failures"
+}
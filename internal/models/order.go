@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OrderStatus is a step of the order lifecycle
+type OrderStatus string
+
+// Order lifecycle: pending -> confirmed -> baking -> ready -> delivered, or cancelled before baking
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusConfirmed OrderStatus = "confirmed"
+	OrderStatusBaking    OrderStatus = "baking"
+	OrderStatusReady     OrderStatus = "ready"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+// orderTransitions lists the statuses an order may move to from each status
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusBaking, OrderStatusCancelled},
+	OrderStatusBaking:    {OrderStatusReady},
+	OrderStatusReady:     {OrderStatusDelivered},
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from s to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Order is a customer's purchase of one or more pizzas
+type Order struct {
+	ID        int         `json:"id" gorm:"primaryKey"`
+	UserID    uint        `json:"user_id" gorm:"not null;index:idx_order_user_id"`
+	User      *User       `json:"-" gorm:"foreignKey:UserID"`
+	Status    OrderStatus `json:"status" gorm:"size:16;not null;index:idx_order_status"`
+	Total     Money       `json:"-" gorm:"embedded;embeddedPrefix:total_"`
+	Items     []OrderItem `json:"items" gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// MarshalJSON writes the total as an exact decimal alongside its currency and minor units
+func (o Order) MarshalJSON() ([]byte, error) {
+	type orderAlias Order
+	return json.Marshal(struct {
+		orderAlias
+		Total      json.RawMessage `json:"total"`
+		TotalMinor int64           `json:"total_minor"`
+		Currency   string          `json:"currency"`
+	}{orderAlias(o), json.RawMessage(o.Total.Decimal()), o.Total.Amount, o.Total.Currency})
+}
+
+// OrderItem is a line of an order. The pizza name, SKU and unit price are copied when the
+// order is placed so later menu changes do not alter what the customer was charged.
+type OrderItem struct {
+	ID        int    `json:"id" gorm:"primaryKey"`
+	OrderID   int    `json:"order_id" gorm:"not null;index:idx_order_item_order_id"`
+	PizzaID   int    `json:"pizza_id" gorm:"not null;index:idx_order_item_pizza_id"`
+	VariantID *int   `json:"variant_id,omitempty"`
+	Name      string `json:"name" gorm:"not null"`
+	SKU       string `json:"sku,omitempty"`
+	Quantity  int    `json:"quantity" gorm:"not null"`
+	UnitPrice Money  `json:"-" gorm:"embedded;embeddedPrefix:unit_price_"`
+}
+
+// MarshalJSON writes the unit price as an exact decimal alongside its currency and minor units
+func (i OrderItem) MarshalJSON() ([]byte, error) {
+	type itemAlias OrderItem
+	return json.Marshal(struct {
+		itemAlias
+		MoneyJSON
+	}{itemAlias(i), NewMoneyJSON(i.UnitPrice)})
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -11,11 +12,117 @@ type Pizza struct {
 	ID          int            `json:"id" gorm:"primaryKey"`
 	Name        string         `json:"name" gorm:"not null"`
 	Description string         `json:"description"`
-	Ingredients []string       `json:"ingredients" gorm:"serializer:json"` // Auto JSONB in PostgreSQL
-	Price       float64        `json:"price"`
+	Ingredients []string       `json:"ingredients" gorm:"-"` // Names resolved from IngredientLinks
+	Price       Money          `json:"-" gorm:"embedded;embeddedPrefix:price_"`
 	CreatedBy   uint           `json:"created_by" gorm:"not null;index:idx_pizza_created_by"`
 	Creator     *User          `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index:idx_pizza_deleted_at"`
+	// Version is incremented on every change and exposed as the ETag for optimistic concurrency
+	Version  int64          `json:"-" gorm:"not null;default:1"`
+	Variants []PizzaVariant `json:"variants" gorm:"foreignKey:PizzaID;constraint:OnDelete:CASCADE"`
+
+	// IngredientLinks is the many-to-many join to the ingredient catalog
+	IngredientLinks []PizzaIngredient `json:"-" gorm:"foreignKey:PizzaID;constraint:OnDelete:CASCADE"`
+}
+
+// ResolveIngredientNames fills Ingredients from the preloaded catalog links, in their listed order
+func (p *Pizza) ResolveIngredientNames() {
+	names := make([]string, 0, len(p.IngredientLinks))
+	for _, link := range p.IngredientLinks {
+		if link.Ingredient != nil {
+			names = append(names, link.Ingredient.Name)
+		}
+	}
+	p.Ingredients = names
+}
+
+// MarshalJSON writes the price as an exact decimal alongside its currency and minor units
+// Soft-deleted pizzas, only visible to admins, also report when they were deleted
+func (p Pizza) MarshalJSON() ([]byte, error) {
+	type pizzaAlias Pizza
+	var deletedAt *time.Time
+	if p.DeletedAt.Valid {
+		deletedAt = &p.DeletedAt.Time
+	}
+	return json.Marshal(struct {
+		pizzaAlias
+		MoneyJSON
+		DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	}{pizzaAlias(p), NewMoneyJSON(p.Price), deletedAt})
+}
+
+// UnmarshalJSON reads the price without a lossy float64 conversion
+func (p *Pizza) UnmarshalJSON(data []byte) error {
+	type pizzaAlias Pizza
+	var wire struct {
+		*pizzaAlias
+		MoneyJSON
+	}
+	wire.pizzaAlias = (*pizzaAlias)(p)
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	price, err := wire.MoneyJSON.ToMoney()
+	if err != nil {
+		return err
+	}
+	p.Price = price
+	return nil
+}
+
+// PizzaListResponse is the envelope returned by paginated pizza listings
+type PizzaListResponse struct {
+	Data       []Pizza `json:"data"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      *int64  `json:"total,omitempty"`
+}
+
+// PizzaImportResponse is returned by a successful catalog import
+type PizzaImportResponse struct {
+	Imported int     `json:"imported"`
+	Data     []Pizza `json:"data"`
+}
+
+// Pizza batch operation kinds
+const (
+	PizzaBatchCreate = "create"
+	PizzaBatchUpdate = "update"
+	PizzaBatchDelete = "delete"
+)
+
+// PizzaBatchRequest is the body of POST /api/v1/pizzas:batch
+type PizzaBatchRequest struct {
+	// Atomic applies every operation in one transaction, rolling all of them back if any fails
+	Atomic     bool                  `json:"atomic"`
+	Operations []PizzaBatchOperation `json:"operations"`
+}
+
+// PizzaBatchOperation is a single create, update or delete within a batch
+type PizzaBatchOperation struct {
+	Op string `json:"op"`
+	// ID identifies the pizza to update or delete
+	ID int `json:"id,omitempty"`
+	// IfMatch is compared with the pizza ETag like the If-Match header of PUT and DELETE
+	IfMatch string `json:"if_match,omitempty"`
+	// Pizza is the full representation for create and update, decoded per operation
+	Pizza json.RawMessage `json:"pizza,omitempty"`
+}
+
+// PizzaBatchResult reports the outcome of one batch operation, in request order
+type PizzaBatchResult struct {
+	Index  int       `json:"index"`
+	Op     string    `json:"op"`
+	Status int       `json:"status"`
+	Pizza  *Pizza    `json:"pizza,omitempty"`
+	ETag   string    `json:"etag,omitempty"`
+	Error  *APIError `json:"error,omitempty"`
+}
+
+// PizzaBatchResponse is returned by POST /api/v1/pizzas:batch
+type PizzaBatchResponse struct {
+	Atomic  bool               `json:"atomic"`
+	Results []PizzaBatchResult `json:"results"`
 }
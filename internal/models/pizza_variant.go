@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Supported pizza sizes
+const (
+	SizeSmall  = "small"
+	SizeMedium = "medium"
+	SizeLarge  = "large"
+)
+
+// PizzaVariant is a sellable size/crust combination of a pizza with its own SKU and price
+type PizzaVariant struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	PizzaID   int       `json:"pizza_id" gorm:"not null;index:idx_variant_pizza_id"`
+	SKU       string    `json:"sku" gorm:"not null;uniqueIndex:idx_variant_sku"`
+	Size      string    `json:"size" gorm:"not null"`
+	Crust     string    `json:"crust"`
+	Price     Money     `json:"-" gorm:"embedded;embeddedPrefix:price_"`
+	Available bool      `json:"available" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MarshalJSON writes the price as an exact decimal alongside its currency and minor units
+func (v PizzaVariant) MarshalJSON() ([]byte, error) {
+	type variantAlias PizzaVariant
+	return json.Marshal(struct {
+		variantAlias
+		MoneyJSON
+	}{variantAlias(v), NewMoneyJSON(v.Price)})
+}
@@ -1,14 +1,46 @@
 package models
 
 import (
+	"errors"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// MinPasswordLength is the shortest password SetPassword accepts
+const MinPasswordLength = 8
+
+// ErrPasswordTooShort is returned by SetPassword for passwords under MinPasswordLength characters
+var ErrPasswordTooShort = errors.New("password must be at least 8 characters")
+
 type User struct {
-	ID        uint   `gorm:"primaryKey"`
-	Email     string `gorm:"uniqueIndex;not null"`
-	Name      string
-	Role      string `gorm:"default:'admin'"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID    uint   `gorm:"primaryKey"`
+	Email string `gorm:"uniqueIndex;not null"`
+	Name  string
+	Role  string `gorm:"default:'admin'"`
+	// PasswordHash is the bcrypt hash of the login password; users without one cannot log in
+	PasswordHash string `gorm:"not null;default:''" json:"-"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// SetPassword stores the bcrypt hash of the password
+func (u *User) SetPassword(password string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether the password matches the stored hash
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
 }
@@ -22,6 +22,7 @@ func NewClientService(db *gorm.DB) ClientService {
 }
 
 func (s *clientService) CreateClient(client *models.OAuthClient) error {
+	client.Normalize()
 	return s.db.Create(client).Error
 }
 
@@ -48,3 +49,23 @@ func (s *clientService) DeleteClient(clientID string, userID uint) error {
 	}
 	return result.Error
 }
+
+// NormalizeClientRegistrations rewrites the scopes and grant types of existing clients space-separated
+// Clients registered without grant types keep the grants they always had: client_credentials and refresh_token
+func NormalizeClientRegistrations(db *gorm.DB) error {
+	var clients []models.OAuthClient
+	if err := db.Find(&clients).Error; err != nil {
+		return err
+	}
+	for _, client := range clients {
+		scopes, grantTypes := client.Scopes, client.GrantTypes
+		client.Normalize()
+		if client.Scopes == scopes && client.GrantTypes == grantTypes {
+			continue
+		}
+		if err := db.Model(&client).Select("scopes", "grant_types").Updates(&client).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeClientRegistrations(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.OAuthClient{}))
+
+	require.NoError(t, db.Create(&models.OAuthClient{ID: "legacy", Secret: "x", Scopes: "read,write, read"}).Error)
+	require.NoError(t, db.Create(&models.OAuthClient{ID: "current", Secret: "x", Scopes: "read pizzas:write", GrantTypes: "client_credentials"}).Error)
+
+	require.NoError(t, NormalizeClientRegistrations(db))
+
+	var legacy, current models.OAuthClient
+	require.NoError(t, db.First(&legacy, "id = ?", "legacy").Error)
+	require.NoError(t, db.First(&current, "id = ?", "current").Error)
+	assert.Equal(t, "read write", legacy.Scopes)
+	assert.Equal(t, models.DefaultClientGrantTypes, legacy.GrantTypes)
+	assert.Equal(t, "read pizzas:write", current.Scopes)
+	assert.Equal(t, "client_credentials", current.GrantTypes)
+
+	created := &models.OAuthClient{ID: "created", Secret: "x", Scopes: "read,pizzas:write"}
+	require.NoError(t, NewClientService(db).CreateClient(created))
+	assert.Equal(t, "read pizzas:write", created.Scopes)
+	assert.Equal(t, models.DefaultClientGrantTypes, created.GrantTypes)
+}
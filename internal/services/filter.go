@@ -0,0 +1,313 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+)
+
+const (
+	// IngredientMatchAny matches pizzas containing at least one of the requested ingredients
+	IngredientMatchAny = "any"
+	// IngredientMatchAll matches pizzas containing every requested ingredient
+	IngredientMatchAll = "all"
+
+	// maxFilterPredicates bounds the size of a filter expression to keep generated SQL small
+	maxFilterPredicates = 20
+)
+
+// sqlFragment is a parameterized piece of a WHERE clause
+type sqlFragment struct {
+	SQL  string
+	Args []interface{}
+}
+
+// ParsePriceFilter parses a price filter value such as price_gte into minor units of the currency
+func ParsePriceFilter(field, raw, currency string) (int64, error) {
+	price, err := models.ParseMoney(raw, currency)
+	var moneyErr *models.MoneyError
+	if errors.As(err, &moneyErr) {
+		return 0, &ValidationError{Field: field, Message: moneyErr.Message}
+	} else if err != nil {
+		return 0, err
+	}
+	return price.Amount, nil
+}
+
+// ParseTimeFilter parses an RFC 3339 timestamp filter value such as created_after
+func ParseTimeFilter(field, raw string) (time.Time, error) {
+	value, err := time.Parse(time.RFC3339, strings.TrimSpace(raw))
+	if err != nil {
+		return time.Time{}, &ValidationError{Field: field, Message: fmt.Sprintf("'%s' is not an RFC 3339 timestamp", raw)}
+	}
+	// SQLite compares timestamps as text, so match the zone GORM used when writing them
+	return value.Local(), nil
+}
+
+// pizzaPredicate translates a single field:value filter into SQL
+// Only whitelisted fields are accepted, and values are always passed as bind parameters
+func pizzaPredicate(field, value string) (sqlFragment, error) {
+	switch field {
+	case "name":
+		return sqlFragment{SQL: "name LIKE ?", Args: []interface{}{"%" + value + "%"}}, nil
+	case "created_by":
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return sqlFragment{}, &ValidationError{Field: "created_by", Message: fmt.Sprintf("'%s' is not a user ID", value)}
+		}
+		return sqlFragment{SQL: "created_by = ?", Args: []interface{}{id}}, nil
+	case "price_gte", "price_lte":
+		// Expressions have no currency context, so amounts are read in, and only compared with prices
+		// in, the default currency
+		currency := models.DefaultCurrency()
+		price, err := ParsePriceFilter(field, value, currency)
+		if err != nil {
+			return sqlFragment{}, err
+		}
+		op := ">="
+		if field == "price_lte" {
+			op = "<="
+		}
+		return sqlFragment{SQL: "(price_amount " + op + " ? AND price_currency = ?)", Args: []interface{}{price, currency}}, nil
+	case "currency":
+		if _, err := models.CurrencyExponent(value); err != nil {
+			return sqlFragment{}, &ValidationError{Field: "currency", Message: err.Error()}
+		}
+		return sqlFragment{SQL: "price_currency = ?", Args: []interface{}{strings.ToUpper(value)}}, nil
+	case "ingredient":
+		if strings.TrimSpace(value) == "" {
+			return sqlFragment{}, &ValidationError{Field: "ingredient", Message: "must not be empty"}
+		}
+		return sqlFragment{
+			SQL: "EXISTS (SELECT 1 FROM pizza_ingredients JOIN ingredients ON ingredients.id = pizza_ingredients.ingredient_id " +
+				"WHERE pizza_ingredients.pizza_id = pizzas.id AND ingredients.normalized_name = ?)",
+			Args: []interface{}{models.NormalizeIngredientName(value)},
+		}, nil
+	case "created_after", "updated_after":
+		ts, err := ParseTimeFilter(field, value)
+		if err != nil {
+			return sqlFragment{}, err
+		}
+		column := strings.TrimSuffix(field, "_after") + "_at"
+		return sqlFragment{SQL: column + " > ?", Args: []interface{}{ts}}, nil
+	default:
+		return sqlFragment{}, &ValidationError{Field: "filter", Message: fmt.Sprintf("unsupported filter field '%s'", field)}
+	}
+}
+
+// ingredientsPredicate combines several ingredient matches with OR (any) or AND (all)
+func ingredientsPredicate(ingredients []string, match string) (sqlFragment, error) {
+	joiner := " OR "
+	switch match {
+	case "", IngredientMatchAny:
+	case IngredientMatchAll:
+		joiner = " AND "
+	default:
+		return sqlFragment{}, &ValidationError{Field: "ingredient_match", Message: "must be 'any' or 'all'"}
+	}
+
+	var parts []string
+	var args []interface{}
+	for _, ingredient := range ingredients {
+		frag, err := pizzaPredicate("ingredient", ingredient)
+		if err != nil {
+			return sqlFragment{}, err
+		}
+		parts = append(parts, frag.SQL)
+		args = append(args, frag.Args...)
+	}
+	return sqlFragment{SQL: "(" + strings.Join(parts, joiner) + ")", Args: args}, nil
+}
+
+// parseFilterExpression translates a boolean filter expression into a parameterized WHERE clause
+//
+// Grammar (keywords are case-insensitive):
+//
+//	expr      := term { "or" term }
+//	term      := factor { "and" factor }
+//	factor    := "not" factor | "(" expr ")" | predicate
+//	predicate := field ":" value
+//
+// Values containing spaces or parentheses must be double quoted, e.g.
+// (price_gte:10 and price_lte:15) or ingredient:"Bell Peppers"
+func parseFilterExpression(input string) (sqlFragment, error) {
+	tokens, err := tokenizeFilter(input)
+	if err != nil {
+		return sqlFragment{}, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	frag, err := p.parseOr()
+	if err != nil {
+		return sqlFragment{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return sqlFragment{}, filterSyntaxError("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	return frag, nil
+}
+
+func filterSyntaxError(format string, args ...interface{}) error {
+	return &ValidationError{Field: "filter", Message: fmt.Sprintf(format, args...)}
+}
+
+type filterTokenKind int
+
+const (
+	tokenWord filterTokenKind = iota
+	tokenPredicate
+	tokenLParen
+	tokenRParen
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	text  string
+	field string
+	value string
+}
+
+// tokenizeFilter splits a filter expression into parentheses, keywords and field:value predicates
+func tokenizeFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")"})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != ':' {
+				i++
+			}
+			word := string(runes[start:i])
+
+			if i >= len(runes) || runes[i] != ':' {
+				tokens = append(tokens, filterToken{kind: tokenWord, text: word})
+				continue
+			}
+
+			// field:value predicate, value is either quoted or runs to the next delimiter
+			i++
+			var value string
+			if i < len(runes) && runes[i] == '"' {
+				end := i + 1
+				for end < len(runes) && runes[end] != '"' {
+					end++
+				}
+				if end >= len(runes) {
+					return nil, filterSyntaxError("unterminated quoted value for '%s'", word)
+				}
+				value = string(runes[i+1 : end])
+				i = end + 1
+			} else {
+				valueStart := i
+				for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+					i++
+				}
+				value = string(runes[valueStart:i])
+			}
+			if word == "" || value == "" {
+				return nil, filterSyntaxError("predicates must have the form field:value")
+			}
+			tokens = append(tokens, filterToken{kind: tokenPredicate, text: word + ":" + value, field: word, value: value})
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, filterSyntaxError("expression is empty")
+	}
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser over filter tokens
+type filterParser struct {
+	tokens     []filterToken
+	pos        int
+	predicates int
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenWord && strings.EqualFold(p.tokens[p.pos].text, keyword)
+}
+
+func (p *filterParser) parseOr() (sqlFragment, error) {
+	return p.parseBinary("or", p.parseAnd)
+}
+
+func (p *filterParser) parseAnd() (sqlFragment, error) {
+	return p.parseBinary("and", p.parseFactor)
+}
+
+func (p *filterParser) parseBinary(keyword string, operand func() (sqlFragment, error)) (sqlFragment, error) {
+	left, err := operand()
+	if err != nil {
+		return sqlFragment{}, err
+	}
+
+	for p.peekKeyword(keyword) {
+		p.pos++
+		right, err := operand()
+		if err != nil {
+			return sqlFragment{}, err
+		}
+		left = sqlFragment{
+			SQL:  fmt.Sprintf("(%s %s %s)", left.SQL, strings.ToUpper(keyword), right.SQL),
+			Args: append(left.Args, right.Args...),
+		}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseFactor() (sqlFragment, error) {
+	if p.pos >= len(p.tokens) {
+		return sqlFragment{}, filterSyntaxError("unexpected end of expression")
+	}
+
+	tok := p.tokens[p.pos]
+	switch {
+	case p.peekKeyword("not"):
+		p.pos++
+		inner, err := p.parseFactor()
+		if err != nil {
+			return sqlFragment{}, err
+		}
+		return sqlFragment{SQL: "(NOT " + inner.SQL + ")", Args: inner.Args}, nil
+
+	case tok.kind == tokenLParen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return sqlFragment{}, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenRParen {
+			return sqlFragment{}, filterSyntaxError("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+
+	case tok.kind == tokenPredicate:
+		p.pos++
+		p.predicates++
+		if p.predicates > maxFilterPredicates {
+			return sqlFragment{}, filterSyntaxError("expression has more than %d predicates", maxFilterPredicates)
+		}
+		return pizzaPredicate(tok.field, tok.value)
+
+	default:
+		return sqlFragment{}, filterSyntaxError("unexpected '%s'", tok.text)
+	}
+}
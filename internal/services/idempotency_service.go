@@ -0,0 +1,168 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when an Idempotency-Key is sent again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency_key_reused")
+	// ErrIdempotencyKeyInProgress is returned while the first request with an Idempotency-Key is still running
+	ErrIdempotencyKeyInProgress = errors.New("idempotency_key_in_progress")
+)
+
+// StoredResponse is the response replayed to retries of an idempotent request
+type StoredResponse struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       []byte
+}
+
+// IdempotencyScope is who an Idempotency-Key belongs to: a user of an OAuth client
+// Users signed in to the same client never see each other's keys or responses.
+type IdempotencyScope struct {
+	ClientID string
+	UserID   uint
+}
+
+// IdempotencyService records the responses of requests sent with an Idempotency-Key
+type IdempotencyService interface {
+	// Begin claims the key for a request identified by requestHash
+	// It returns nil when the caller should process the request, or the stored response of an earlier request
+	Begin(scope IdempotencyScope, key, requestHash string) (*StoredResponse, error)
+	// Complete stores the response of a claimed request for replay
+	Complete(scope IdempotencyScope, key string, response StoredResponse) error
+	// Release gives up a claimed key so the request can be retried, e.g. after a server error
+	Release(scope IdempotencyScope, key string) error
+	// PurgeExpired deletes records older than the retention period and returns how many were removed
+	PurgeExpired() (int64, error)
+}
+
+// idempotencyService is the implementation of the IdempotencyService interface
+type idempotencyService struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewIdempotencyService creates a new instance of IdempotencyService keeping responses for ttl
+func NewIdempotencyService(db *gorm.DB, ttl time.Duration) IdempotencyService {
+	return &idempotencyService{db: db, ttl: ttl}
+}
+
+func (s *idempotencyService) Begin(scope IdempotencyScope, key, requestHash string) (*StoredResponse, error) {
+	keyHash := idempotencyKeyHash(scope, key)
+	var existing models.IdempotencyRecord
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// An expired key may be used again for a new request
+		if err := scopedRecord(tx, scope, keyHash).Where("created_at < ?", s.expiry()).
+			Delete(&models.IdempotencyRecord{}).Error; err != nil {
+			return err
+		}
+
+		claim := models.IdempotencyRecord{ClientID: scope.ClientID, UserID: scope.UserID, KeyHash: keyHash, RequestHash: requestHash}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&claim)
+		if result.Error != nil || result.RowsAffected == 1 {
+			return result.Error
+		}
+		return scopedRecord(tx, scope, keyHash).First(&existing).Error
+	})
+	if err != nil || existing.ID == 0 {
+		return nil, err
+	}
+
+	switch {
+	case existing.RequestHash != requestHash:
+		return nil, ErrIdempotencyKeyReused
+	case existing.StatusCode == 0:
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	body, err := openIdempotentBody(scope, key, existing.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredResponse{StatusCode: existing.StatusCode, Headers: existing.Headers, Body: body}, nil
+}
+
+func (s *idempotencyService) Complete(scope IdempotencyScope, key string, response StoredResponse) error {
+	body, err := sealIdempotentBody(scope, key, response.Body)
+	if err != nil {
+		return err
+	}
+	return scopedRecord(s.db.Model(&models.IdempotencyRecord{}), scope, idempotencyKeyHash(scope, key)).
+		Select("status_code", "headers", "body", "updated_at").
+		Updates(&models.IdempotencyRecord{StatusCode: response.StatusCode, Headers: response.Headers, Body: body}).Error
+}
+
+func (s *idempotencyService) Release(scope IdempotencyScope, key string) error {
+	return scopedRecord(s.db, scope, idempotencyKeyHash(scope, key)).Where("status_code = 0").
+		Delete(&models.IdempotencyRecord{}).Error
+}
+
+func (s *idempotencyService) PurgeExpired() (int64, error) {
+	result := s.db.Where("created_at < ?", s.expiry()).Delete(&models.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
+
+// expiry is the creation time before which records are no longer replayed
+func (s *idempotencyService) expiry() time.Time {
+	return time.Now().Add(-s.ttl)
+}
+
+// scopedRecord narrows a query to the record of a key in the scope
+func scopedRecord(tx *gorm.DB, scope IdempotencyScope, keyHash string) *gorm.DB {
+	return tx.Where("client_id = ? AND user_id = ? AND key_hash = ?", scope.ClientID, scope.UserID, keyHash)
+}
+
+// idempotencyKeyHash identifies a key in its scope without storing the key itself
+func idempotencyKeyHash(scope IdempotencyScope, key string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("idempotency-key\x00%s\x00%d\x00%s", scope.ClientID, scope.UserID, key)))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyCipher derives the AES-256-GCM cipher protecting a stored response from the key and its scope
+func idempotencyCipher(scope IdempotencyScope, key string) (cipher.AEAD, error) {
+	secret := sha256.Sum256([]byte(fmt.Sprintf("idempotency-response\x00%s\x00%d\x00%s", scope.ClientID, scope.UserID, key)))
+	block, err := aes.NewCipher(secret[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealIdempotentBody encrypts a response body, which may contain secrets such as new client credentials
+func sealIdempotentBody(scope IdempotencyScope, key string, body []byte) ([]byte, error) {
+	aead, err := idempotencyCipher(scope, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, body, nil), nil
+}
+
+// openIdempotentBody decrypts a body sealed by sealIdempotentBody
+func openIdempotentBody(scope IdempotencyScope, key string, sealed []byte) ([]byte, error) {
+	aead, err := idempotencyCipher(scope, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("stored idempotent response is corrupt")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyService(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.IdempotencyRecord{}))
+	service := NewIdempotencyService(db, time.Hour)
+	alice := IdempotencyScope{ClientID: "ci-client", UserID: 1}
+	otherClient := IdempotencyScope{ClientID: "other-client", UserID: 1}
+
+	stored, err := service.Begin(alice, "key-1", "request-a")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// Retries are rejected until the first request has a response
+	_, err = service.Begin(alice, "key-1", "request-a")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyInProgress)
+
+	body := []byte(`{"client_id":"new","client_secret":"s3cr3t"}`)
+	require.NoError(t, service.Complete(alice, "key-1", StoredResponse{
+		StatusCode: 201, Headers: map[string]string{"Content-Type": "application/json"}, Body: body,
+	}))
+
+	stored, err = service.Begin(alice, "key-1", "request-a")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, 201, stored.StatusCode)
+	assert.Equal(t, "application/json", stored.Headers["Content-Type"])
+	assert.Equal(t, body, stored.Body)
+
+	_, err = service.Begin(alice, "key-1", "request-b")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	// Neither the key nor the response is stored in the clear
+	var record models.IdempotencyRecord
+	require.NoError(t, db.First(&record).Error)
+	assert.NotEqual(t, "key-1", record.KeyHash)
+	assert.False(t, bytes.Contains(record.Body, []byte("s3cr3t")))
+
+	// Keys are scoped to the client
+	stored, err = service.Begin(otherClient, "key-1", "request-b")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// and to the user of the client: another user's request with the same key is a new request,
+	// and cannot read the response stored for alice
+	bob := IdempotencyScope{ClientID: "ci-client", UserID: 2}
+	stored, err = service.Begin(bob, "key-1", "request-a")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+	require.NoError(t, service.Complete(bob, "key-1", StoredResponse{StatusCode: 201, Body: []byte(`{"client_id":"bobs"}`)}))
+	stored, err = service.Begin(alice, "key-1", "request-a")
+	require.NoError(t, err)
+	assert.Equal(t, body, stored.Body)
+	_, err = openIdempotentBody(bob, "key-1", record.Body)
+	assert.Error(t, err, "the response is sealed for alice")
+
+	// Released keys can be claimed again by a retry
+	require.NoError(t, service.Release(otherClient, "key-1"))
+	stored, err = service.Begin(otherClient, "key-1", "request-b")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// Expired keys are purged and may be reused for a different request
+	require.NoError(t, db.Model(&models.IdempotencyRecord{}).Where("1 = 1").
+		Update("created_at", time.Now().Add(-2*time.Hour)).Error)
+	stored, err = service.Begin(alice, "key-1", "request-b")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	purged, err := service.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrIngredientExists is returned when a name collides with an existing catalog entry
+	ErrIngredientExists = errors.New("ingredient_already_exists")
+	// ErrIngredientInUse is returned when deleting an ingredient that pizzas still reference
+	ErrIngredientInUse = errors.New("ingredient_in_use")
+)
+
+// IngredientService manages the shared ingredient catalog
+type IngredientService interface {
+	// GetAllIngredients lists catalog ingredients, optionally filtered by partial name
+	GetAllIngredients(name string) ([]models.Ingredient, error)
+	// GetIngredientByID retrieves a catalog ingredient by its ID
+	GetIngredientByID(id int) (models.Ingredient, error)
+	// CreateIngredient adds a new ingredient to the catalog
+	CreateIngredient(name string) (models.Ingredient, error)
+	// UpdateIngredient renames a catalog ingredient, which is reflected on every pizza using it
+	UpdateIngredient(id int, name string) (models.Ingredient, error)
+	// DeleteIngredient removes an ingredient that no pizza references
+	DeleteIngredient(id int) error
+}
+
+// ingredientService is the implementation of the IngredientService interface
+type ingredientService struct {
+	db *gorm.DB
+}
+
+// NewIngredientService creates a new instance of IngredientService
+func NewIngredientService(db *gorm.DB) IngredientService {
+	return &ingredientService{db: db}
+}
+
+func (s *ingredientService) GetAllIngredients(name string) ([]models.Ingredient, error) {
+	var ingredients []models.Ingredient
+	query := s.db.Order("normalized_name ASC")
+	if name != "" {
+		query = query.Where("normalized_name LIKE ?", "%"+models.NormalizeIngredientName(name)+"%")
+	}
+	if err := query.Find(&ingredients).Error; err != nil {
+		return nil, err
+	}
+	return ingredients, nil
+}
+
+func (s *ingredientService) GetIngredientByID(id int) (models.Ingredient, error) {
+	var ingredient models.Ingredient
+	if err := s.db.First(&ingredient, id).Error; err != nil {
+		return models.Ingredient{}, err
+	}
+	return ingredient, nil
+}
+
+func (s *ingredientService) CreateIngredient(name string) (models.Ingredient, error) {
+	ingredient, err := newIngredient(name)
+	if err != nil {
+		return models.Ingredient{}, err
+	}
+
+	if err := s.ensureNameAvailable(ingredient.NormalizedName, 0); err != nil {
+		return models.Ingredient{}, err
+	}
+	if err := s.db.Create(&ingredient).Error; err != nil {
+		return models.Ingredient{}, err
+	}
+	return ingredient, nil
+}
+
+func (s *ingredientService) UpdateIngredient(id int, name string) (models.Ingredient, error) {
+	existing, err := s.GetIngredientByID(id)
+	if err != nil {
+		return models.Ingredient{}, err
+	}
+
+	renamed, err := newIngredient(name)
+	if err != nil {
+		return models.Ingredient{}, err
+	}
+	if err := s.ensureNameAvailable(renamed.NormalizedName, id); err != nil {
+		return models.Ingredient{}, err
+	}
+
+	existing.Name = renamed.Name
+	existing.NormalizedName = renamed.NormalizedName
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		// Pizzas embed their ingredient names, so the rename changes their representation too
+		return bumpPizzaVersion(tx, "id IN (?)",
+			tx.Model(&models.PizzaIngredient{}).Select("pizza_id").Where("ingredient_id = ?", id))
+	})
+	if err != nil {
+		return models.Ingredient{}, err
+	}
+	return existing, nil
+}
+
+func (s *ingredientService) DeleteIngredient(id int) error {
+	if _, err := s.GetIngredientByID(id); err != nil {
+		return err
+	}
+
+	// Links of soft-deleted pizzas count too, so restoring a pizza never loses ingredients
+	var uses int64
+	if err := s.db.Model(&models.PizzaIngredient{}).Where("ingredient_id = ?", id).Count(&uses).Error; err != nil {
+		return err
+	}
+	if uses > 0 {
+		return ErrIngredientInUse
+	}
+
+	return s.db.Delete(&models.Ingredient{}, id).Error
+}
+
+// ensureNameAvailable checks that no other catalog entry uses the normalized name
+func (s *ingredientService) ensureNameAvailable(normalized string, exceptID int) error {
+	var count int64
+	if err := s.db.Model(&models.Ingredient{}).
+		Where("normalized_name = ? AND id <> ?", normalized, exceptID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrIngredientExists
+	}
+	return nil
+}
+
+// newIngredient builds a catalog entry from a user supplied name
+func newIngredient(name string) (models.Ingredient, error) {
+	clean := models.CleanIngredientName(name)
+	if clean == "" {
+		return models.Ingredient{}, &ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	return models.Ingredient{Name: clean, NormalizedName: models.NormalizeIngredientName(clean)}, nil
+}
+
+// linkIngredients replaces the ingredient links of a pizza, creating catalog entries for new names
+// Blank and duplicate names are skipped; the remaining names keep the order they were given in
+func linkIngredients(tx *gorm.DB, pizzaID int, names []string) error {
+	if err := tx.Where("pizza_id = ?", pizzaID).Delete(&models.PizzaIngredient{}).Error; err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		candidate, err := newIngredient(name)
+		if err != nil || seen[candidate.NormalizedName] {
+			continue
+		}
+		seen[candidate.NormalizedName] = true
+
+		// Concurrent writes may add the same new ingredient: the insert yields to the one that
+		// won, and the select below then finds it
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "normalized_name"}},
+			DoNothing: true,
+		}).Create(&candidate).Error; err != nil {
+			return err
+		}
+		var ingredient models.Ingredient
+		if err := tx.Where("normalized_name = ?", candidate.NormalizedName).First(&ingredient).Error; err != nil {
+			return err
+		}
+
+		link := models.PizzaIngredient{PizzaID: pizzaID, IngredientID: ingredient.ID, Position: len(seen) - 1}
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateIngredientCatalog converts the legacy JSON-serialized pizzas.ingredients column into
+// catalog rows and join links. Each converted row has its legacy column cleared, so the
+// migration is idempotent and safe to run on every startup.
+func MigrateIngredientCatalog(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("pizzas", "ingredients") {
+		return nil
+	}
+
+	type legacyPizza struct {
+		ID          int
+		Ingredients []string `gorm:"serializer:json"`
+	}
+
+	var rows []legacyPizza
+	if err := db.Table("pizzas").
+		Select("id, ingredients").
+		Where("ingredients IS NOT NULL AND ingredients <> ''").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if err := linkIngredients(tx, row.ID, row.Ingredients); err != nil {
+				return err
+			}
+			if err := tx.Table("pizzas").Where("id = ?", row.ID).Update("ingredients", nil).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
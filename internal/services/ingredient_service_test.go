@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPizzaIngredientsShareCatalog(t *testing.T) {
+	db := setupTestDB(t)
+	pizzaService := NewPizzaService(db)
+	ingredientService := NewIngredientService(db)
+
+	first, err := pizzaService.CreatePizza(models.Pizza{
+		Name:        "Margherita",
+		CreatedBy:   1,
+		Ingredients: []string{"Tomato Sauce", "Mozzarella", "  basil ", "mozzarella"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Tomato Sauce", "Mozzarella", "basil"}, first.Ingredients)
+
+	second, err := pizzaService.CreatePizza(models.Pizza{
+		Name:        "Caprese",
+		CreatedBy:   1,
+		Ingredients: []string{"MOZZARELLA ", "Basil", "Tomato  Sauce"},
+	})
+	require.NoError(t, err)
+	// Existing catalog entries keep their original spelling
+	assert.Equal(t, []string{"Mozzarella", "basil", "Tomato Sauce"}, second.Ingredients)
+
+	catalog, err := ingredientService.GetAllIngredients("")
+	require.NoError(t, err)
+	assert.Len(t, catalog, 3)
+
+	// Renaming a catalog entry is reflected on every pizza
+	basil := catalog[0]
+	require.Equal(t, "basil", basil.NormalizedName)
+	_, err = ingredientService.UpdateIngredient(basil.ID, "Fresh Basil")
+	require.NoError(t, err)
+
+	reloaded, err := pizzaService.GetPizzaByID(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Tomato Sauce", "Mozzarella", "Fresh Basil"}, reloaded.Ingredients)
+}
+
+func TestIngredientServiceConflicts(t *testing.T) {
+	db := setupTestDB(t)
+	pizzaService := NewPizzaService(db)
+	ingredientService := NewIngredientService(db)
+
+	_, err := ingredientService.CreateIngredient("Olives")
+	require.NoError(t, err)
+
+	_, err = ingredientService.CreateIngredient(" olives ")
+	assert.ErrorIs(t, err, ErrIngredientExists)
+
+	_, err = ingredientService.CreateIngredient("   ")
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+
+	pizza, err := pizzaService.CreatePizza(models.Pizza{Name: "Vegetarian", CreatedBy: 1, Ingredients: []string{"Olives"}})
+	require.NoError(t, err)
+
+	olives, err := ingredientService.GetAllIngredients("oliv")
+	require.NoError(t, err)
+	require.Len(t, olives, 1)
+
+	// Soft-deleted pizzas still hold on to their ingredients
+	require.NoError(t, pizzaService.DeletePizza(pizza.ID, 0))
+	assert.ErrorIs(t, ingredientService.DeleteIngredient(olives[0].ID), ErrIngredientInUse)
+}
+
+func TestConcurrentPizzasAddTheSameIngredient(t *testing.T) {
+	db := setupTestDB(t)
+	pizzaService := NewPizzaService(db)
+
+	// Another request adds the ingredient between this request's lookup and its insert
+	raced := false
+	require.NoError(t, db.Callback().Create().Before("gorm:create").Register("test:race_ingredient", func(tx *gorm.DB) {
+		if tx.Statement.Table != "ingredients" || raced {
+			return
+		}
+		raced = true
+		tx.AddError(tx.Session(&gorm.Session{NewDB: true}).Exec(
+			"INSERT INTO ingredients (name, normalized_name, created_at, updated_at) VALUES (?, ?, ?, ?)",
+			"Truffle", "truffle", time.Now(), time.Now()).Error)
+	}))
+
+	pizza, err := pizzaService.CreatePizza(models.Pizza{Name: "Tartufo", CreatedBy: 1, Ingredients: []string{"truffle"}})
+	require.NoError(t, err)
+	require.True(t, raced)
+	assert.Equal(t, []string{"Truffle"}, pizza.Ingredients, "the pizza links the ingredient the other request added")
+
+	var count int64
+	require.NoError(t, db.Model(&models.Ingredient{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMigrateIngredientCatalog(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Recreate the legacy JSON column and rows written before the catalog existed
+	require.NoError(t, db.Exec("ALTER TABLE pizzas ADD COLUMN ingredients text").Error)
+	require.NoError(t, db.Exec(`INSERT INTO pizzas (name, created_by, ingredients) VALUES
+		('Margherita', 1, '["Tomato Sauce","Mozzarella","Basil"]'),
+		('Pepperoni', 1, '["tomato sauce","Mozzarella ","Pepperoni"]'),
+		('Plain', 1, NULL)`).Error)
+
+	require.NoError(t, MigrateIngredientCatalog(db))
+	// Running again must not duplicate anything
+	require.NoError(t, MigrateIngredientCatalog(db))
+
+	var catalogSize int64
+	require.NoError(t, db.Model(&models.Ingredient{}).Count(&catalogSize).Error)
+	assert.Equal(t, int64(4), catalogSize)
+
+	page, err := NewPizzaService(db).GetAllPizzas(PizzaListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 3)
+	assert.Equal(t, []string{"Tomato Sauce", "Mozzarella", "Basil"}, page.Items[0].Ingredients)
+	assert.Equal(t, []string{"Tomato Sauce", "Mozzarella", "Pepperoni"}, page.Items[1].Ingredients)
+	assert.Empty(t, page.Items[2].Ingredients)
+
+	var remaining int64
+	require.NoError(t, db.Table("pizzas").Where("ingredients IS NOT NULL").Count(&remaining).Error)
+	assert.Zero(t, remaining)
+}
@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the supported patch documents
+const (
+	// MergePatchContentType is a JSON Merge Patch document (RFC 7396)
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType is a JSON Patch document (RFC 6902)
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// PatchTestFailedError is returned when a JSON Patch "test" operation does not match the resource
+type PatchTestFailedError struct {
+	Path string
+}
+
+func (e *PatchTestFailedError) Error() string {
+	return fmt.Sprintf("test operation failed at '%s'", e.Path)
+}
+
+// applyPatch applies a patch document of the given media type to a JSON document
+func applyPatch(doc []byte, contentType string, patch []byte) ([]byte, error) {
+	target, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	patchDoc, err := decodeJSONValue(patch)
+	if err != nil {
+		return nil, &ValidationError{Field: "patch", Message: "is not valid JSON"}
+	}
+
+	switch contentType {
+	case MergePatchContentType:
+		target = applyMergePatch(target, patchDoc)
+	case JSONPatchContentType:
+		target, err = applyJSONPatch(target, patchDoc)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &ValidationError{Field: "Content-Type", Message: fmt.Sprintf("unsupported patch format '%s'", contentType)}
+	}
+	return json.Marshal(target)
+}
+
+// decodeJSONValue decodes a single JSON value, keeping numbers as json.Number so prices stay exact
+func decodeJSONValue(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+// applyMergePatch implements the MergePatch algorithm of RFC 7396 section 2
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = applyMergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// jsonPatchOperation is a single operation of an RFC 6902 document
+type jsonPatchOperation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// applyJSONPatch applies the operations of an RFC 6902 document in order
+// Either every operation succeeds or the error of the first failing one is returned
+func applyJSONPatch(target, patch interface{}) (interface{}, error) {
+	rawOps, ok := patch.([]interface{})
+	if !ok {
+		return nil, &ValidationError{Field: "patch", Message: "a JSON Patch document must be an array of operations"}
+	}
+
+	for i, rawOp := range rawOps {
+		op, err := parseJSONPatchOperation(i, rawOp)
+		if err != nil {
+			return nil, err
+		}
+		target, err = op.apply(target)
+		if err != nil {
+			var testErr *PatchTestFailedError
+			var validationErr *ValidationError
+			if !errors.As(err, &testErr) && !errors.As(err, &validationErr) {
+				err = &ValidationError{Field: fmt.Sprintf("patch[%d]", i), Message: err.Error()}
+			}
+			return nil, err
+		}
+	}
+	return target, nil
+}
+
+// parseJSONPatchOperation validates the members of an operation object
+func parseJSONPatchOperation(index int, raw interface{}) (jsonPatchOperation, error) {
+	field := fmt.Sprintf("patch[%d]", index)
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return jsonPatchOperation{}, &ValidationError{Field: field, Message: "an operation must be an object"}
+	}
+
+	var op jsonPatchOperation
+	var hasValue bool
+	for member, target := range map[string]*string{"op": &op.Op, "path": &op.Path, "from": &op.From} {
+		if value, present := object[member]; present {
+			s, ok := value.(string)
+			if !ok {
+				return jsonPatchOperation{}, &ValidationError{Field: field, Message: fmt.Sprintf("'%s' must be a string", member)}
+			}
+			*target = s
+		}
+	}
+	if _, present := object["path"]; !present {
+		return jsonPatchOperation{}, &ValidationError{Field: field, Message: "'path' is required"}
+	}
+	op.Value, hasValue = object["value"]
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if !hasValue {
+			return jsonPatchOperation{}, &ValidationError{Field: field, Message: fmt.Sprintf("'value' is required for %s", op.Op)}
+		}
+	case "move", "copy":
+		if _, present := object["from"]; !present {
+			return jsonPatchOperation{}, &ValidationError{Field: field, Message: fmt.Sprintf("'from' is required for %s", op.Op)}
+		}
+	case "remove":
+	default:
+		return jsonPatchOperation{}, &ValidationError{Field: field, Message: fmt.Sprintf("unsupported operation '%s'", op.Op)}
+	}
+	return op, nil
+}
+
+// apply performs the operation on the document and returns the updated document
+func (op jsonPatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return addJSONValue(doc, path, op.Value)
+	case "remove":
+		doc, _, err := removeJSONValue(doc, path)
+		return doc, err
+	case "replace":
+		if _, err := getJSONValue(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return op.Value, nil
+		}
+		doc, _, err := removeJSONValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return addJSONValue(doc, path, op.Value)
+	case "move":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("cannot move '%s' into one of its children", op.From)
+		}
+		doc, value, err := removeJSONValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addJSONValue(doc, path, value)
+	case "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getJSONValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addJSONValue(doc, path, deepCopyJSON(value))
+	default: // test
+		value, err := getJSONValue(doc, path)
+		if err != nil || !jsonEqual(value, op.Value) {
+			return nil, &PatchTestFailedError{Path: op.Path}
+		}
+		return doc, nil
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 pointer into its unescaped reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("'%s' is not a JSON pointer", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// parseArrayIndex parses an array reference token, allowing "-" (one past the end) when appending
+func parseArrayIndex(token string, length int, appending bool) (int, error) {
+	if token == "-" && appending {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("'%s' is not an array index", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not an array index", token)
+	}
+	limit := length - 1
+	if appending {
+		limit = length
+	}
+	if index > limit {
+		return 0, fmt.Errorf("array index %d is out of bounds", index)
+	}
+	return index, nil
+}
+
+// getJSONValue returns the value referenced by the pointer tokens
+func getJSONValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member '%s' does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			index, err := parseArrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("cannot reference '%s' inside a scalar value", token)
+		}
+	}
+	return doc, nil
+}
+
+// addJSONValue sets an object member or inserts an array element, returning the updated document
+func addJSONValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token, rest := path[0], path[1:]
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			container[token] = value
+			return container, nil
+		}
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("member '%s' does not exist", token)
+		}
+		updated, err := addJSONValue(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		container[token] = updated
+		return container, nil
+	case []interface{}:
+		index, err := parseArrayIndex(token, len(container), len(rest) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		updated, err := addJSONValue(container[index], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = updated
+		return container, nil
+	default:
+		return nil, fmt.Errorf("cannot add '%s' inside a scalar value", token)
+	}
+}
+
+// removeJSONValue deletes the referenced value, returning the updated document and the removed value
+func removeJSONValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	token, rest := path[0], path[1:]
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		child, ok := container[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("member '%s' does not exist", token)
+		}
+		if len(rest) == 0 {
+			delete(container, token)
+			return container, child, nil
+		}
+		updated, removed, err := removeJSONValue(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		container[token] = updated
+		return container, removed, nil
+	case []interface{}:
+		index, err := parseArrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := container[index]
+			return append(container[:index], container[index+1:]...), removed, nil
+		}
+		updated, removed, err := removeJSONValue(container[index], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		container[index] = updated
+		return container, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("cannot remove '%s' inside a scalar value", token)
+	}
+}
+
+// deepCopyJSON copies a decoded JSON value so a copied subtree can be modified independently
+func deepCopyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			copied[key] = deepCopyJSON(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, child := range v {
+			copied[i] = deepCopyJSON(child)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// jsonEqual compares decoded JSON values, treating numbers as equal when their values are equal (1.0 == 1)
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ar, aok := new(big.Rat).SetString(string(av))
+		br, bok := new(big.Rat).SetString(string(bv))
+		return aok && bok && ar.Cmp(br) == 0
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, child := range av {
+			other, present := bv[key]
+			if !present || !jsonEqual(child, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
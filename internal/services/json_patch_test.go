@@ -0,0 +1,115 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	// Examples from RFC 7396 Appendix A
+	testCases := []struct {
+		original string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"price":10.10}`, `{"name":"x"}`, `{"name":"x","price":10.10}`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.patch, func(t *testing.T) {
+			result, err := applyPatch([]byte(tt.original), MergePatchContentType, []byte(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	// Examples from RFC 6902 Appendix A
+	testCases := []struct {
+		name     string
+		original string
+		patch    string
+		expected string
+	}{
+		{"add object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"remove object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{
+			"move value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{
+			"test success", `{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{"add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{"ignore unknown members", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"foo":"bar","baz":"qux"}`},
+		{"escaped pointers", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`},
+		{"append to array", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"copy value", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"numbers compare by value", `{"price":10.10}`, `[{"op":"test","path":"/price","value":10.1}]`, `{"price":10.10}`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyPatch([]byte(tt.original), JSONPatchContentType, []byte(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(result))
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		patch string
+		field string
+	}{
+		{name: "not an array", patch: `{"op":"add"}`, field: "patch"},
+		{name: "invalid json", patch: `[{"op":`, field: "patch"},
+		{name: "unknown operation", patch: `[{"op":"frobnicate","path":"/foo"}]`, field: "patch[0]"},
+		{name: "missing value", patch: `[{"op":"add","path":"/foo"}]`, field: "patch[0]"},
+		{name: "missing path", patch: `[{"op":"remove"}]`, field: "patch[0]"},
+		{name: "missing parent", patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, field: "patch[0]"},
+		{name: "remove missing member", patch: `[{"op":"test","path":"/foo","value":"bar"},{"op":"remove","path":"/nope"}]`, field: "patch[1]"},
+		{name: "index out of bounds", patch: `[{"op":"add","path":"/list/3","value":1}]`, field: "patch[0]"},
+		{name: "leading zero index", patch: `[{"op":"replace","path":"/list/01","value":1}]`, field: "patch[0]"},
+		{name: "move into child", patch: `[{"op":"move","from":"/list","path":"/list/0"}]`, field: "patch[0]"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyPatch([]byte(`{"foo":"bar","list":[1,2]}`), JSONPatchContentType, []byte(tt.patch))
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+
+	_, err := applyPatch([]byte(`{"baz":"qux"}`), JSONPatchContentType, []byte(`[{"op":"test","path":"/baz","value":"bar"}]`))
+	var testErr *PatchTestFailedError
+	require.ErrorAs(t, err, &testErr)
+	assert.Equal(t, "/baz", testErr.Path)
+}
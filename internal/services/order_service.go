@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxOrderItems is the largest number of lines accepted in a single order
+	MaxOrderItems = 50
+	// MaxOrderItemQuantity is the largest quantity accepted on a single order line
+	MaxOrderItemQuantity = 100
+)
+
+// orderStatuses is the set of known order statuses
+var orderStatuses = map[models.OrderStatus]struct{}{
+	models.OrderStatusPending:   {},
+	models.OrderStatusConfirmed: {},
+	models.OrderStatusBaking:    {},
+	models.OrderStatusReady:     {},
+	models.OrderStatusDelivered: {},
+	models.OrderStatusCancelled: {},
+}
+
+// OrderTransitionError is returned when an order cannot move from its current status to the requested one
+type OrderTransitionError struct {
+	From models.OrderStatus
+	To   models.OrderStatus
+}
+
+func (e *OrderTransitionError) Error() string {
+	return fmt.Sprintf("order cannot move from %s to %s", e.From, e.To)
+}
+
+// OrderService places orders and moves them through their lifecycle
+type OrderService interface {
+	// GetOrders lists orders, newest first, optionally restricted to a customer or status
+	GetOrders(opts OrderListOptions) ([]models.Order, error)
+	// GetOrderByID retrieves an order with its items
+	GetOrderByID(id int) (models.Order, error)
+	// CreateOrder places a pending order, snapshotting the current name and price of every item
+	CreateOrder(order models.Order) (models.Order, error)
+	// TransitionOrder moves an order to the given status if the lifecycle allows it
+	TransitionOrder(id int, status models.OrderStatus) (models.Order, error)
+}
+
+// OrderListOptions holds the filters for listing orders
+type OrderListOptions struct {
+	// UserID restricts the listing to a single customer when set
+	UserID *uint
+	Status string
+}
+
+// orderService is the implementation of the OrderService interface
+type orderService struct {
+	db *gorm.DB
+}
+
+// NewOrderService creates a new instance of OrderService
+func NewOrderService(db *gorm.DB) OrderService {
+	return &orderService{db: db}
+}
+
+func (s *orderService) GetOrders(opts OrderListOptions) ([]models.Order, error) {
+	query := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	})
+	if opts.UserID != nil {
+		query = query.Where("user_id = ?", *opts.UserID)
+	}
+	if opts.Status != "" {
+		status := models.OrderStatus(opts.Status)
+		if _, ok := orderStatuses[status]; !ok {
+			return nil, &ValidationError{Field: "status", Message: fmt.Sprintf("unknown order status '%s'", opts.Status)}
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	orders := []models.Order{}
+	if err := query.Order("created_at DESC").Order("id DESC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (s *orderService) GetOrderByID(id int) (models.Order, error) {
+	return findOrder(s.db, id)
+}
+
+func (s *orderService) CreateOrder(order models.Order) (models.Order, error) {
+	if len(order.Items) == 0 {
+		return models.Order{}, &ValidationError{Field: "items", Message: "an order needs at least one item"}
+	}
+	if len(order.Items) > MaxOrderItems {
+		return models.Order{}, &ValidationError{Field: "items", Message: fmt.Sprintf("an order may have at most %d items", MaxOrderItems)}
+	}
+
+	var created models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order.ID = 0
+		order.Status = models.OrderStatusPending
+		order.Total = models.Money{}
+
+		for i := range order.Items {
+			if err := snapshotOrderItem(tx, i, &order.Items[i]); err != nil {
+				return err
+			}
+			item := order.Items[i]
+
+			if i == 0 {
+				order.Total.Currency = item.UnitPrice.Currency
+			} else if item.UnitPrice.Currency != order.Total.Currency {
+				return &ValidationError{
+					Field:   fmt.Sprintf("items[%d]", i),
+					Message: fmt.Sprintf("priced in %s but the order is in %s", item.UnitPrice.Currency, order.Total.Currency),
+				}
+			}
+			order.Total.Amount += item.UnitPrice.Amount * int64(item.Quantity)
+		}
+
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+
+		var err error
+		created, err = findOrder(tx, order.ID)
+		return err
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+	return created, nil
+}
+
+func (s *orderService) TransitionOrder(id int, status models.OrderStatus) (models.Order, error) {
+	if _, ok := orderStatuses[status]; !ok {
+		return models.Order{}, &ValidationError{Field: "status", Message: fmt.Sprintf("unknown order status '%s'", status)}
+	}
+
+	order, err := findOrder(s.db, id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if !order.Status.CanTransitionTo(status) {
+		return models.Order{}, &OrderTransitionError{From: order.Status, To: status}
+	}
+
+	// Only move the order if nobody else changed its status since it was read
+	result := s.db.Model(&models.Order{}).
+		Where("id = ? AND status = ?", id, order.Status).
+		Updates(map[string]interface{}{"status": status, "updated_at": time.Now()})
+	if result.Error != nil {
+		return models.Order{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		current, err := findOrder(s.db, id)
+		if err != nil {
+			return models.Order{}, err
+		}
+		return models.Order{}, &OrderTransitionError{From: current.Status, To: status}
+	}
+
+	return findOrder(s.db, id)
+}
+
+// snapshotOrderItem validates an order line and copies the current name, SKU and price of the
+// pizza, or of the variant when one is given
+func snapshotOrderItem(tx *gorm.DB, index int, item *models.OrderItem) error {
+	field := fmt.Sprintf("items[%d]", index)
+	if item.Quantity < 1 || item.Quantity > MaxOrderItemQuantity {
+		return &ValidationError{Field: field + ".quantity", Message: fmt.Sprintf("must be between 1 and %d", MaxOrderItemQuantity)}
+	}
+
+	var pizza models.Pizza
+	if err := tx.First(&pizza, item.PizzaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &ValidationError{Field: field + ".pizza_id", Message: fmt.Sprintf("pizza %d does not exist", item.PizzaID)}
+		}
+		return err
+	}
+
+	item.ID = 0
+	item.Name = pizza.Name
+	item.SKU = ""
+	item.UnitPrice = pizza.Price
+
+	if item.VariantID != nil {
+		var variant models.PizzaVariant
+		err := tx.Where("pizza_id = ?", pizza.ID).First(&variant, *item.VariantID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &ValidationError{Field: field + ".variant_id", Message: fmt.Sprintf("variant %d does not belong to pizza %d", *item.VariantID, pizza.ID)}
+		} else if err != nil {
+			return err
+		}
+		if !variant.Available {
+			return &ValidationError{Field: field + ".variant_id", Message: fmt.Sprintf("variant %s is not available", variant.SKU)}
+		}
+		item.SKU = variant.SKU
+		item.UnitPrice = variant.Price
+	}
+	return nil
+}
+
+// findOrder loads an order with its items in their original order
+func findOrder(db *gorm.DB, id int) (models.Order, error) {
+	var order models.Order
+	err := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).First(&order, id).Error
+	if err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateOrderSnapshotsPrices(t *testing.T) {
+	db := setupTestDB(t)
+	pizzaService := NewPizzaService(db)
+	orderService := NewOrderService(db)
+
+	pizza, err := pizzaService.CreatePizza(models.Pizza{Name: "Margherita", Price: usd(1099), CreatedBy: 1})
+	require.NoError(t, err)
+	variant, err := NewPizzaVariantService(db).CreateVariant(models.PizzaVariant{
+		PizzaID: pizza.ID, SKU: "MARG-L", Size: "large", Price: usd(1499), Available: true,
+	})
+	require.NoError(t, err)
+
+	order, err := orderService.CreateOrder(models.Order{
+		UserID: 7,
+		Status: models.OrderStatusDelivered,
+		Items: []models.OrderItem{
+			{PizzaID: pizza.ID, Quantity: 2},
+			{PizzaID: pizza.ID, VariantID: &variant.ID, Quantity: 1},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPending, order.Status)
+	assert.Equal(t, uint(7), order.UserID)
+	assert.Equal(t, usd(3697), order.Total)
+	require.Len(t, order.Items, 2)
+	assert.Equal(t, "Margherita", order.Items[0].Name)
+	assert.Equal(t, usd(1099), order.Items[0].UnitPrice)
+	assert.Equal(t, "MARG-L", order.Items[1].SKU)
+	assert.Equal(t, usd(1499), order.Items[1].UnitPrice)
+
+	// Repricing the menu does not change orders already placed
+	pizza.Price = usd(1299)
+	_, err = pizzaService.UpdatePizza(pizza, 0)
+	require.NoError(t, err)
+
+	stored, err := orderService.GetOrderByID(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, usd(3697), stored.Total)
+	assert.Equal(t, usd(1099), stored.Items[0].UnitPrice)
+}
+
+func TestCreateOrderValidation(t *testing.T) {
+	db := setupTestDB(t)
+	pizzaService := NewPizzaService(db)
+	orderService := NewOrderService(db)
+
+	pizza, err := pizzaService.CreatePizza(models.Pizza{Name: "Margherita", Price: usd(1099), CreatedBy: 1})
+	require.NoError(t, err)
+	yen, err := pizzaService.CreatePizza(models.Pizza{Name: "Napoli", Price: models.Money{Amount: 1200, Currency: "JPY"}, CreatedBy: 1})
+	require.NoError(t, err)
+	other, err := pizzaService.CreatePizza(models.Pizza{Name: "Marinara", Price: usd(999), CreatedBy: 1})
+	require.NoError(t, err)
+	soldOut, err := NewPizzaVariantService(db).CreateVariant(models.PizzaVariant{
+		PizzaID: pizza.ID, SKU: "MARG-S", Size: "small", Price: usd(899), Available: false,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		items []models.OrderItem
+		field string
+	}{
+		{name: "no items", items: nil, field: "items"},
+		{name: "zero quantity", items: []models.OrderItem{{PizzaID: pizza.ID}}, field: "items[0].quantity"},
+		{name: "unknown pizza", items: []models.OrderItem{{PizzaID: 999, Quantity: 1}}, field: "items[0].pizza_id"},
+		{name: "variant of another pizza", items: []models.OrderItem{{PizzaID: other.ID, VariantID: &soldOut.ID, Quantity: 1}}, field: "items[0].variant_id"},
+		{name: "unavailable variant", items: []models.OrderItem{{PizzaID: pizza.ID, VariantID: &soldOut.ID, Quantity: 1}}, field: "items[0].variant_id"},
+		{name: "mixed currencies", items: []models.OrderItem{{PizzaID: pizza.ID, Quantity: 1}, {PizzaID: yen.ID, Quantity: 1}}, field: "items[1]"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := orderService.CreateOrder(models.Order{UserID: 1, Items: tt.items})
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+
+	orders, err := orderService.GetOrders(OrderListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	orderService := NewOrderService(db)
+	pizza, err := NewPizzaService(db).CreatePizza(models.Pizza{Name: "Margherita", Price: usd(1099), CreatedBy: 1})
+	require.NoError(t, err)
+
+	place := func(userID uint) models.Order {
+		order, err := orderService.CreateOrder(models.Order{UserID: userID, Items: []models.OrderItem{{PizzaID: pizza.ID, Quantity: 1}}})
+		require.NoError(t, err)
+		return order
+	}
+
+	delivered := place(1)
+	for _, status := range []models.OrderStatus{
+		models.OrderStatusConfirmed, models.OrderStatusBaking, models.OrderStatusReady, models.OrderStatusDelivered,
+	} {
+		order, err := orderService.TransitionOrder(delivered.ID, status)
+		require.NoError(t, err)
+		assert.Equal(t, status, order.Status)
+	}
+
+	// Terminal and skipped steps are rejected with the current status
+	var transitionErr *OrderTransitionError
+	_, err = orderService.TransitionOrder(delivered.ID, models.OrderStatusCancelled)
+	require.ErrorAs(t, err, &transitionErr)
+	assert.Equal(t, models.OrderStatusDelivered, transitionErr.From)
+
+	skipped := place(2)
+	_, err = orderService.TransitionOrder(skipped.ID, models.OrderStatusReady)
+	require.ErrorAs(t, err, &transitionErr)
+	assert.Equal(t, models.OrderStatusPending, transitionErr.From)
+
+	_, err = orderService.TransitionOrder(skipped.ID, models.OrderStatus("eaten"))
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	// Orders can no longer be cancelled once baking has started
+	baking := place(2)
+	_, err = orderService.TransitionOrder(baking.ID, models.OrderStatusConfirmed)
+	require.NoError(t, err)
+	_, err = orderService.TransitionOrder(baking.ID, models.OrderStatusBaking)
+	require.NoError(t, err)
+	_, err = orderService.TransitionOrder(baking.ID, models.OrderStatusCancelled)
+	require.ErrorAs(t, err, &transitionErr)
+
+	cancelled, err := orderService.TransitionOrder(skipped.ID, models.OrderStatusCancelled)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, cancelled.Status)
+
+	// Listings can be scoped to a customer and a status
+	customer := uint(2)
+	orders, err := orderService.GetOrders(OrderListOptions{UserID: &customer})
+	require.NoError(t, err)
+	assert.Len(t, orders, 2)
+
+	orders, err = orderService.GetOrders(OrderListOptions{Status: "delivered"})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, delivered.ID, orders[0].ID)
+
+	_, err = orderService.GetOrders(OrderListOptions{Status: "eaten"})
+	require.ErrorAs(t, err, &validationErr)
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPageLimit is the page size used when a cursor is supplied without a limit
+	DefaultPageLimit = 50
+	// MaxPageLimit is the largest page size a client may request
+	MaxPageLimit = 100
+)
+
+// ValidationError reports a client supplied parameter that could not be applied to a query
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+// SortField is a single column of an ORDER BY clause
+type SortField struct {
+	// Column is the API field name, see pizzaSortColumns for the database column
+	Column string
+	Desc   bool
+}
+
+// dbColumn returns the database column backing the sort field
+func (f SortField) dbColumn() string {
+	return pizzaSortColumns[f.Column]
+}
+
+// String returns the field in query string notation ("-price" for descending)
+func (f SortField) String() string {
+	if f.Desc {
+		return "-" + f.Column
+	}
+	return f.Column
+}
+
+// pizzaSortColumns whitelists the fields a client is allowed to sort on and maps them to columns
+var pizzaSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"price":      "price_amount",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// ParseSort parses a comma-separated sort expression such as "price,-created_at"
+// The primary key is always appended as a final tie-breaker so keyset pagination is stable
+func ParseSort(expr string) ([]SortField, error) {
+	var fields []SortField
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		field := SortField{Column: part}
+		if strings.HasPrefix(part, "-") {
+			field = SortField{Column: strings.TrimPrefix(part, "-"), Desc: true}
+		} else if strings.HasPrefix(part, "+") {
+			field.Column = strings.TrimPrefix(part, "+")
+		}
+
+		if _, ok := pizzaSortColumns[field.Column]; !ok {
+			return nil, &ValidationError{Field: "sort", Message: fmt.Sprintf("unsupported sort field '%s'", field.Column)}
+		}
+		if seen[field.Column] {
+			return nil, &ValidationError{Field: "sort", Message: fmt.Sprintf("duplicate sort field '%s'", field.Column)}
+		}
+		seen[field.Column] = true
+		fields = append(fields, field)
+	}
+
+	if !seen["id"] {
+		fields = append(fields, SortField{Column: "id"})
+	}
+	return fields, nil
+}
+
+// sortKey renders the normalized sort so a cursor can be tied to the ordering that produced it
+func sortKey(fields []SortField) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// pageCursor is the decoded form of the opaque cursor handed to clients
+type pageCursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// encodeCursor builds an opaque cursor pointing just after the given pizza
+func encodeCursor(fields []SortField, last models.Pizza) (string, error) {
+	cursor := pageCursor{Sort: sortKey(fields)}
+	for _, f := range fields {
+		raw, err := json.Marshal(pizzaSortValue(last, f.Column))
+		if err != nil {
+			return "", err
+		}
+		cursor.Values = append(cursor.Values, raw)
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor validates an opaque cursor against the requested sort and returns its typed values
+func decodeCursor(token string, fields []SortField) ([]interface{}, error) {
+	invalid := &ValidationError{Field: "cursor", Message: "malformed or expired cursor"}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, invalid
+	}
+
+	if cursor.Sort != sortKey(fields) {
+		return nil, &ValidationError{Field: "cursor", Message: "cursor was issued for a different sort order"}
+	}
+	if len(cursor.Values) != len(fields) {
+		return nil, invalid
+	}
+
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		value, err := decodeSortValue(f.Column, cursor.Values[i])
+		if err != nil {
+			return nil, invalid
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// pizzaSortValue returns the value of a sortable column for the given pizza
+func pizzaSortValue(p models.Pizza, column string) interface{} {
+	switch column {
+	case "name":
+		return p.Name
+	case "price":
+		return p.Price.Amount
+	case "created_at":
+		return p.CreatedAt
+	case "updated_at":
+		return p.UpdatedAt
+	default:
+		return p.ID
+	}
+}
+
+// decodeSortValue restores the Go type of a cursor value so both drivers compare it natively
+func decodeSortValue(column string, raw json.RawMessage) (interface{}, error) {
+	switch column {
+	case "name":
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case "price":
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case "created_at", "updated_at":
+		var v time.Time
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		var v int
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+}
+
+// applyKeyset restricts the query to rows strictly after the cursor position
+// The predicate is expanded to (a > ?) OR (a = ? AND b > ?) ... instead of a row-value
+// comparison so mixed sort directions work identically on SQLite and PostgreSQL
+func applyKeyset(query *gorm.DB, fields []SortField, values []interface{}) *gorm.DB {
+	var clauses []string
+	var args []interface{}
+
+	for i, f := range fields {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, fields[j].dbColumn()+" = ?")
+			args = append(args, values[j])
+		}
+
+		op := ">"
+		if f.Desc {
+			op = "<"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s ?", f.dbColumn(), op))
+		args = append(args, values[i])
+
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return query.Where("("+strings.Join(clauses, " OR ")+")", args...)
+}
+
+// applyOrder adds the ORDER BY clause for the given sort fields
+func applyOrder(query *gorm.DB, fields []SortField) *gorm.DB {
+	for _, f := range fields {
+		if f.Desc {
+			query = query.Order(f.dbColumn() + " DESC")
+		} else {
+			query = query.Order(f.dbColumn() + " ASC")
+		}
+	}
+	return query
+}
@@ -1,22 +1,103 @@
 package services
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
 	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
 	"gorm.io/gorm"
 )
 
 // PizzaService provides methods to interact with the pizza database
 type PizzaService interface {
-	// GetAllPizzas retrieves all pizzas from the database with optional filtering
-	GetAllPizzas(createdBy string, name string) ([]models.Pizza, error)
+	// GetAllPizzas retrieves pizzas from the database with optional filtering, sorting and pagination
+	GetAllPizzas(opts PizzaListOptions) (PizzaPage, error)
 	// GetPizzaByID retrieves a pizza by its ID
 	GetPizzaByID(id int) (models.Pizza, error)
 	// CreatePizza creates a new pizza in the database
 	CreatePizza(pizza models.Pizza) (models.Pizza, error)
 	// UpdatePizza updates an existing pizza in the database
-	UpdatePizza(pizza models.Pizza) (models.Pizza, error)
+	// A non-zero expectedVersion must match the stored version
+	UpdatePizza(pizza models.Pizza, expectedVersion int64) (models.Pizza, error)
+	// PatchPizza applies a JSON Merge Patch or JSON Patch document to the JSON representation of a pizza
+	// A non-zero expectedVersion must match the stored version
+	PatchPizza(id int, contentType string, patch []byte, expectedVersion int64) (models.Pizza, error)
 	// DeletePizza deletes a pizza from the database by its ID
-	DeletePizza(id int) error
+	// A non-zero expectedVersion must match the stored version
+	DeletePizza(id int, expectedVersion int64) error
+	// GetPizzaByIDIncludingDeleted retrieves a pizza by its ID even if it was soft-deleted
+	GetPizzaByIDIncludingDeleted(id int) (models.Pizza, error)
+	// RestorePizza undoes the soft delete of a pizza
+	RestorePizza(id int) (models.Pizza, error)
+	// PurgePizza permanently removes a soft-deleted pizza with its variants and ingredient links
+	PurgePizza(id int) error
+	// GetPizzaRevision retrieves only the ID, version and modification time of a pizza
+	// so conditional requests can be answered without loading its associations
+	GetPizzaRevision(id int) (models.Pizza, error)
+	// GetCatalogRevision summarizes the state of the whole pizza catalog for conditional requests
+	GetCatalogRevision() (CatalogRevision, error)
+	// ExportPizzas streams every pizza to w in the given transfer format (csv, json or ndjson)
+	ExportPizzas(format string, w io.Writer) error
+	// ImportPizzas creates every pizza read from r in a single transaction
+	// Nothing is created if any row is invalid; the *ImportError then lists every invalid row
+	ImportPizzas(format string, r io.Reader, createdBy uint) ([]models.Pizza, error)
+	// Transaction runs fn with a PizzaService bound to a single database transaction
+	// Every change made through it is rolled back if fn returns an error
+	Transaction(fn func(PizzaService) error) error
+}
+
+var (
+	// ErrPizzaNotDeleted is returned when restoring or purging a pizza that is not soft-deleted
+	ErrPizzaNotDeleted = errors.New("pizza_not_deleted")
+	// ErrPizzaVersionMismatch is returned when a pizza changed since the version the caller expected
+	ErrPizzaVersionMismatch = errors.New("pizza_version_mismatch")
+)
+
+// PizzaListOptions holds the filtering, sorting and pagination parameters for listing pizzas
+type PizzaListOptions struct {
+	CreatedBy string
+	Name      string
+	// PriceGTE and PriceLTE are minor units of Currency, or of the default currency when it is empty
+	PriceGTE *int64
+	PriceLTE *int64
+	Currency string
+	// Ingredients are matched case-insensitively according to IngredientMatch ("any" or "all")
+	Ingredients     []string
+	IngredientMatch string
+	CreatedAfter    *time.Time
+	UpdatedAfter    *time.Time
+	// Filter is a boolean expression over the same fields, ANDed with the individual filters
+	Filter string
+	// Sort is a comma-separated list of columns, prefixed with '-' for descending order
+	Sort string
+	// Limit caps the page size; zero means no limit unless a cursor is supplied
+	Limit int
+	// Cursor is the opaque next_cursor value returned by a previous page
+	Cursor string
+	// IncludeTotal requests the total number of rows matching the filters
+	IncludeTotal bool
+	// IncludeDeleted also lists soft-deleted pizzas
+	IncludeDeleted bool
+}
+
+// PizzaPage is a single page of pizzas together with the cursor to the next page
+type PizzaPage struct {
+	Items      []models.Pizza
+	NextCursor string
+	Total      *int64
+}
+
+// CatalogRevision identifies a state of the pizza catalog
+// Every create, update, delete, restore and purge changes at least one of its fields
+type CatalogRevision struct {
+	// Count includes soft-deleted pizzas so purges are visible
+	Count int64
+	// VersionSum grows with every write because each write increments a pizza version
+	VersionSum   int64
+	LastModified time.Time
 }
 
 // pizzaService is the implementation of the PizzaService interface
@@ -29,49 +110,414 @@ func NewPizzaService(db *gorm.DB) PizzaService {
 	return &pizzaService{db: db}
 }
 
-func (s *pizzaService) GetAllPizzas(createdBy string, name string) ([]models.Pizza, error) {
-	var pizzas []models.Pizza
-	query := s.db
+func (s *pizzaService) Transaction(fn func(PizzaService) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&pizzaService{db: tx})
+	})
+}
+
+func (s *pizzaService) GetAllPizzas(opts PizzaListOptions) (PizzaPage, error) {
+	var page PizzaPage
+
+	sortFields, err := ParseSort(opts.Sort)
+	if err != nil {
+		return page, err
+	}
 
-	// Apply filters if provided
-	if createdBy != "" {
-		query = query.Where("created_by = ?", createdBy)
+	limit := opts.Limit
+	if limit < 0 || limit > MaxPageLimit {
+		return page, &ValidationError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", MaxPageLimit)}
 	}
-	if name != "" {
-		query = query.Where("name LIKE ?", "%"+name+"%")
+	if limit == 0 && opts.Cursor != "" {
+		limit = DefaultPageLimit
+	}
+
+	query := s.db.Model(&models.Pizza{})
+	if opts.IncludeDeleted {
+		query = query.Unscoped()
+	}
+
+	query, err = s.applyFilters(query, opts)
+	if err != nil {
+		return page, err
 	}
 
-	if err := query.Find(&pizzas).Error; err != nil {
-		return nil, err
+	// Count before the cursor predicate so the total covers every page
+	if opts.IncludeTotal {
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return page, err
+		}
+		page.Total = &total
 	}
-	return pizzas, nil
+
+	if opts.Cursor != "" {
+		values, err := decodeCursor(opts.Cursor, sortFields)
+		if err != nil {
+			return page, err
+		}
+		query = applyKeyset(query, sortFields, values)
+	}
+
+	query = applyOrder(query, sortFields)
+	if limit > 0 {
+		// Fetch one extra row to learn whether another page exists
+		query = query.Limit(limit + 1)
+	}
+
+	var pizzas []models.Pizza
+	if err := preloadAssociations(query).Find(&pizzas).Error; err != nil {
+		return page, err
+	}
+	for i := range pizzas {
+		resolveAssociations(&pizzas[i])
+	}
+
+	if limit > 0 && len(pizzas) > limit {
+		pizzas = pizzas[:limit]
+		page.NextCursor, err = encodeCursor(sortFields, pizzas[len(pizzas)-1])
+		if err != nil {
+			return page, err
+		}
+	}
+
+	page.Items = pizzas
+	return page, nil
+}
+
+// applyFilters adds a WHERE clause for every filter set in opts
+func (s *pizzaService) applyFilters(query *gorm.DB, opts PizzaListOptions) (*gorm.DB, error) {
+	if opts.CreatedBy != "" {
+		query = query.Where("created_by = ?", opts.CreatedBy)
+	}
+	if opts.Name != "" {
+		query = query.Where("name LIKE ?", "%"+opts.Name+"%")
+	}
+	// Amounts in different currencies cannot be compared, so price bounds only match prices in theirs
+	currency := opts.Currency
+	if currency == "" && (opts.PriceGTE != nil || opts.PriceLTE != nil) {
+		currency = models.DefaultCurrency()
+	}
+	if currency != "" {
+		frag, err := pizzaPredicate("currency", currency)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(frag.SQL, frag.Args...)
+	}
+	if opts.PriceGTE != nil {
+		query = query.Where("price_amount >= ?", *opts.PriceGTE)
+	}
+	if opts.PriceLTE != nil {
+		query = query.Where("price_amount <= ?", *opts.PriceLTE)
+	}
+	if opts.PriceGTE != nil && opts.PriceLTE != nil && *opts.PriceGTE > *opts.PriceLTE {
+		return nil, &ValidationError{Field: "price_gte", Message: "must not be greater than price_lte"}
+	}
+	if len(opts.Ingredients) > 0 {
+		frag, err := ingredientsPredicate(opts.Ingredients, opts.IngredientMatch)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(frag.SQL, frag.Args...)
+	}
+	if opts.CreatedAfter != nil {
+		query = query.Where("created_at > ?", *opts.CreatedAfter)
+	}
+	if opts.UpdatedAfter != nil {
+		query = query.Where("updated_at > ?", *opts.UpdatedAfter)
+	}
+	if opts.Filter != "" {
+		frag, err := parseFilterExpression(opts.Filter)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(frag.SQL, frag.Args...)
+	}
+	return query, nil
 }
 
 func (s *pizzaService) GetPizzaByID(id int) (models.Pizza, error) {
-	var pizza models.Pizza
-	if err := s.db.First(&pizza, id).Error; err != nil {
+	return findPizza(s.db, id)
+}
+
+func (s *pizzaService) CreatePizza(pizza models.Pizza) (models.Pizza, error) {
+	if err := normalizeMoney(&pizza.Price); err != nil {
 		return models.Pizza{}, err
 	}
-	return pizza, nil
+	var created models.Pizza
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = createPizza(tx, pizza)
+		return err
+	})
+	if err != nil {
+		return models.Pizza{}, err
+	}
+	return created, nil
 }
 
-func (s *pizzaService) CreatePizza(pizza models.Pizza) (models.Pizza, error) {
-	if err := s.db.Create(&pizza).Error; err != nil {
+// createPizza inserts a validated pizza with its ingredient links and reloads it
+func createPizza(tx *gorm.DB, pizza models.Pizza) (models.Pizza, error) {
+	if err := tx.Omit("IngredientLinks", "Variants").Create(&pizza).Error; err != nil {
 		return models.Pizza{}, err
 	}
-	return pizza, nil
+	if err := linkIngredients(tx, pizza.ID, pizza.Ingredients); err != nil {
+		return models.Pizza{}, err
+	}
+	return findPizza(tx, pizza.ID)
 }
 
-func (s *pizzaService) UpdatePizza(pizza models.Pizza) (models.Pizza, error) {
-	if err := s.db.Save(&pizza).Error; err != nil {
+func (s *pizzaService) UpdatePizza(pizza models.Pizza, expectedVersion int64) (models.Pizza, error) {
+	if err := normalizeMoney(&pizza.Price); err != nil {
+		return models.Pizza{}, err
+	}
+	var updated models.Pizza
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if expectedVersion == 0 {
+			var current models.Pizza
+			if err := tx.Select("id", "version").First(&current, pizza.ID).Error; err != nil {
+				return err
+			}
+			expectedVersion = current.Version
+		}
+
+		// Compare-and-swap on the version so concurrent writers cannot overwrite each other
+		pizza.Version = expectedVersion + 1
+		pizza.UpdatedAt = time.Now()
+		result := tx.Model(&models.Pizza{}).
+			Where("id = ? AND version = ?", pizza.ID, expectedVersion).
+			Select("name", "description", "price_amount", "price_currency", "version", "updated_at").
+			Updates(&pizza)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return versionConflict(tx, pizza.ID)
+		}
+
+		if err := linkIngredients(tx, pizza.ID, pizza.Ingredients); err != nil {
+			return err
+		}
+
+		var err error
+		updated, err = findPizza(tx, pizza.ID)
+		return err
+	})
+	if err != nil {
+		return models.Pizza{}, err
+	}
+	return updated, nil
+}
+
+// pizzaReadOnlyFields are managed by the server or by other endpoints and cannot be patched
+var pizzaReadOnlyFields = []string{"id", "created_by", "created_at", "updated_at", "deleted_at", "creator", "variants", "price_minor"}
+
+// pizzaRequiredFields cannot be removed by a patch
+var pizzaRequiredFields = []string{"name", "price"}
+
+func (s *pizzaService) PatchPizza(id int, contentType string, patch []byte, expectedVersion int64) (models.Pizza, error) {
+	existing, err := findPizza(s.db, id)
+	if err != nil {
+		return models.Pizza{}, err
+	}
+	if expectedVersion != 0 && existing.Version != expectedVersion {
+		return models.Pizza{}, ErrPizzaVersionMismatch
+	}
+
+	original, err := json.Marshal(existing)
+	if err != nil {
+		return models.Pizza{}, err
+	}
+	patched, err := applyPatch(original, contentType, patch)
+	if err != nil {
+		return models.Pizza{}, err
+	}
+	if err := checkPatchedPizza(original, patched); err != nil {
+		return models.Pizza{}, err
+	}
+
+	var pizza models.Pizza
+	if err := json.Unmarshal(patched, &pizza); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return models.Pizza{}, &ValidationError{Field: typeErr.Field, Message: fmt.Sprintf("must be a %s", typeErr.Type)}
+		}
+		return models.Pizza{}, AsMoneyValidationError(err)
+	}
+
+	pizza.ID = existing.ID
+	pizza.CreatedBy = existing.CreatedBy
+	pizza.CreatedAt = existing.CreatedAt
+	// The patch was computed against this version, so it must still be current when saved
+	return s.UpdatePizza(pizza, existing.Version)
+}
+
+// checkPatchedPizza rejects patches that change read-only fields or remove required ones
+func checkPatchedPizza(original, patched []byte) error {
+	originalValue, err := decodeJSONValue(original)
+	if err != nil {
+		return err
+	}
+	patchedValue, err := decodeJSONValue(patched)
+	if err != nil {
+		return err
+	}
+	before, _ := originalValue.(map[string]interface{})
+	after, ok := patchedValue.(map[string]interface{})
+	if !ok {
+		return &ValidationError{Field: "patch", Message: "must leave the pizza a JSON object"}
+	}
+
+	for _, field := range pizzaReadOnlyFields {
+		oldValue, hadField := before[field]
+		newValue, hasField := after[field]
+		if hadField != hasField || !jsonEqual(oldValue, newValue) {
+			return &ValidationError{Field: field, Message: "is read-only"}
+		}
+	}
+	for _, field := range pizzaRequiredFields {
+		if value, present := after[field]; !present || value == nil {
+			return &ValidationError{Field: field, Message: "cannot be removed"}
+		}
+	}
+	return nil
+}
+
+func (s *pizzaService) DeletePizza(id int, expectedVersion int64) error {
+	query := s.db.Model(&models.Pizza{}).Where("id = ?", id)
+	if expectedVersion != 0 {
+		query = query.Where("version = ?", expectedVersion)
+	}
+	result := query.Updates(map[string]interface{}{
+		"deleted_at": time.Now(),
+		"version":    gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 && expectedVersion != 0 {
+		return versionConflict(s.db, id)
+	}
+	return nil
+}
+
+// versionConflict explains why a versioned write matched no rows: the pizza is gone or has changed
+func versionConflict(db *gorm.DB, id int) error {
+	var count int64
+	if err := db.Model(&models.Pizza{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrPizzaVersionMismatch
+}
+
+// bumpPizzaVersion marks pizzas as changed when data embedded in their representation changes elsewhere
+func bumpPizzaVersion(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	return tx.Unscoped().Model(&models.Pizza{}).Where(query, args...).Updates(map[string]interface{}{
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": time.Now(),
+	}).Error
+}
+
+func (s *pizzaService) GetPizzaRevision(id int) (models.Pizza, error) {
+	var pizza models.Pizza
+	if err := s.db.Select("id", "version", "updated_at").First(&pizza, id).Error; err != nil {
 		return models.Pizza{}, err
 	}
 	return pizza, nil
 }
 
-func (s *pizzaService) DeletePizza(id int) error {
-	if err := s.db.Delete(&models.Pizza{}, id).Error; err != nil {
+func (s *pizzaService) GetCatalogRevision() (CatalogRevision, error) {
+	var revision CatalogRevision
+	if err := s.db.Unscoped().Model(&models.Pizza{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(version), 0) AS version_sum").
+		Scan(&revision).Error; err != nil {
+		return CatalogRevision{}, err
+	}
+
+	// Read the timestamp through the model so every driver scans it as a time
+	var latest models.Pizza
+	if err := s.db.Unscoped().Select("updated_at").Order("updated_at DESC").Limit(1).Find(&latest).Error; err != nil {
+		return CatalogRevision{}, err
+	}
+	revision.LastModified = latest.UpdatedAt
+	return revision, nil
+}
+
+func (s *pizzaService) GetPizzaByIDIncludingDeleted(id int) (models.Pizza, error) {
+	return findPizza(s.db.Unscoped(), id)
+}
+
+func (s *pizzaService) RestorePizza(id int) (models.Pizza, error) {
+	if err := s.ensureDeleted(id); err != nil {
+		return models.Pizza{}, err
+	}
+	if err := s.db.Unscoped().Model(&models.Pizza{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted_at": nil,
+		"version":    gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return models.Pizza{}, err
+	}
+	return findPizza(s.db, id)
+}
+
+func (s *pizzaService) PurgePizza(id int) error {
+	if err := s.ensureDeleted(id); err != nil {
 		return err
 	}
+	// Orders keep their own snapshot of the pizza, so only the catalog rows are removed
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pizza_id = ?", id).Delete(&models.PizzaIngredient{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pizza_id = ?", id).Delete(&models.PizzaVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Pizza{}, id).Error
+	})
+}
+
+// ensureDeleted checks that the pizza exists and is soft-deleted
+func (s *pizzaService) ensureDeleted(id int) error {
+	var pizza models.Pizza
+	if err := s.db.Unscoped().Select("id", "deleted_at").First(&pizza, id).Error; err != nil {
+		return err
+	}
+	if !pizza.DeletedAt.Valid {
+		return ErrPizzaNotDeleted
+	}
 	return nil
 }
+
+// preloadAssociations loads the catalog ingredients of each pizza in their listed order and its variants
+func preloadAssociations(query *gorm.DB) *gorm.DB {
+	return query.
+		Preload("IngredientLinks", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC")
+		}).
+		Preload("IngredientLinks.Ingredient").
+		Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		})
+}
+
+// resolveAssociations prepares preloaded associations for the JSON response
+func resolveAssociations(pizza *models.Pizza) {
+	pizza.ResolveIngredientNames()
+	if pizza.Variants == nil {
+		pizza.Variants = []models.PizzaVariant{}
+	}
+}
+
+// findPizza loads a single pizza with its ingredient names and variants resolved
+func findPizza(db *gorm.DB, id int) (models.Pizza, error) {
+	var pizza models.Pizza
+	if err := preloadAssociations(db).First(&pizza, id).Error; err != nil {
+		return models.Pizza{}, err
+	}
+	resolveAssociations(&pizza)
+	return pizza, nil
+}
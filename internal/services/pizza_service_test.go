@@ -0,0 +1,460 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(&models.User{}, &models.Ingredient{}, &models.Pizza{}, &models.PizzaIngredient{}, &models.PizzaVariant{}, &models.Order{}, &models.OrderItem{})
+	require.NoError(t, err)
+
+	return db
+}
+
+func seedPizzas(t *testing.T, service PizzaService) {
+	pizzas := []models.Pizza{
+		{Name: "Margherita", Price: usd(1099), CreatedBy: 1, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Basil"}},
+		{Name: "Pepperoni", Price: usd(1299), CreatedBy: 1, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Pepperoni"}},
+		{Name: "Vegetarian", Price: usd(1199), CreatedBy: 2, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Bell Peppers", "Olives"}},
+		{Name: "Hawaiian", Price: usd(1299), CreatedBy: 2, Ingredients: []string{"Tomato Sauce", "Mozzarella", "Ham", "Pineapple"}},
+		{Name: "Marinara", Price: usd(999), CreatedBy: 1, Ingredients: []string{"Tomato Sauce", "Garlic", "Oregano"}},
+	}
+	for _, p := range pizzas {
+		_, err := service.CreatePizza(p)
+		require.NoError(t, err)
+	}
+}
+
+func TestGetAllPizzasUnpaginated(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+	seedPizzas(t, service)
+
+	page, err := service.GetAllPizzas(PizzaListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 5)
+	assert.Empty(t, page.NextCursor)
+	assert.Nil(t, page.Total)
+}
+
+func TestGetAllPizzasCursorPagination(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+	seedPizzas(t, service)
+
+	// Walk every page with a mixed-direction sort and collect the names in order
+	var names []string
+	opts := PizzaListOptions{Sort: "-price,name", Limit: 2, IncludeTotal: true}
+	for pages := 0; pages < 10; pages++ {
+		page, err := service.GetAllPizzas(opts)
+		require.NoError(t, err)
+		require.NotNil(t, page.Total)
+		assert.Equal(t, int64(5), *page.Total)
+
+		for _, p := range page.Items {
+			names = append(names, p.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	assert.Equal(t, []string{"Hawaiian", "Pepperoni", "Vegetarian", "Margherita", "Marinara"}, names)
+}
+
+func TestGetAllPizzasValidation(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+	seedPizzas(t, service)
+
+	testCases := []struct {
+		name  string
+		opts  PizzaListOptions
+		field string
+	}{
+		{name: "unknown sort field", opts: PizzaListOptions{Sort: "secret"}, field: "sort"},
+		{name: "duplicate sort field", opts: PizzaListOptions{Sort: "price,-price"}, field: "sort"},
+		{name: "limit too large", opts: PizzaListOptions{Limit: MaxPageLimit + 1}, field: "limit"},
+		{name: "garbage cursor", opts: PizzaListOptions{Cursor: "not-a-cursor"}, field: "cursor"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GetAllPizzas(tt.opts)
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+
+	t.Run("cursor from a different sort", func(t *testing.T) {
+		page, err := service.GetAllPizzas(PizzaListOptions{Sort: "price", Limit: 1})
+		require.NoError(t, err)
+		require.NotEmpty(t, page.NextCursor)
+
+		_, err = service.GetAllPizzas(PizzaListOptions{Sort: "name", Limit: 1, Cursor: page.NextCursor})
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "cursor", validationErr.Field)
+	})
+}
+
+func TestGetAllPizzasFilters(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+	seedPizzas(t, service)
+	// Priced within the USD ranges below, but in euros
+	_, err := service.CreatePizza(models.Pizza{
+		Name: "Diavola", Price: models.Money{Amount: 1100, Currency: "EUR"}, CreatedBy: 3, Ingredients: []string{"Tomato Sauce", "Salami"},
+	})
+	require.NoError(t, err)
+
+	price := func(v int64) *int64 { return &v }
+
+	testCases := []struct {
+		name     string
+		opts     PizzaListOptions
+		expected []string
+	}{
+		{
+			name:     "price range",
+			opts:     PizzaListOptions{PriceGTE: price(1000), PriceLTE: price(1200)},
+			expected: []string{"Margherita", "Vegetarian"},
+		},
+		{
+			name:     "price range in another currency",
+			opts:     PizzaListOptions{PriceGTE: price(1000), PriceLTE: price(1200), Currency: "EUR"},
+			expected: []string{"Diavola"},
+		},
+		{
+			name:     "price range in an expression",
+			opts:     PizzaListOptions{Filter: "price_gte:10 and price_lte:12"},
+			expected: []string{"Margherita", "Vegetarian"},
+		},
+		{
+			name:     "negated price bound",
+			opts:     PizzaListOptions{Filter: "not price_gte:10"},
+			expected: []string{"Marinara", "Diavola"},
+		},
+		{
+			name:     "any ingredient ignores case and whitespace",
+			opts:     PizzaListOptions{Ingredients: []string{" basil", "OLIVES"}},
+			expected: []string{"Margherita", "Vegetarian"},
+		},
+		{
+			name:     "all ingredients",
+			opts:     PizzaListOptions{Ingredients: []string{"mozzarella", "ham"}, IngredientMatch: IngredientMatchAll},
+			expected: []string{"Hawaiian"},
+		},
+		{
+			name:     "boolean expression",
+			opts:     PizzaListOptions{Filter: `(price_gte:12 and not ingredient:ham) or ingredient:"Bell Peppers"`},
+			expected: []string{"Pepperoni", "Vegetarian"},
+		},
+		{
+			name:     "expression combined with individual filters",
+			opts:     PizzaListOptions{CreatedBy: "1", Filter: "price_lte:11 OR name:pepp"},
+			expected: []string{"Margherita", "Pepperoni", "Marinara"},
+		},
+		{
+			name:     "created after the epoch",
+			opts:     PizzaListOptions{Filter: "created_after:1970-01-01T00:00:00Z and price_lte:10"},
+			expected: []string{"Marinara"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.GetAllPizzas(tt.opts)
+			require.NoError(t, err)
+
+			var names []string
+			for _, p := range page.Items {
+				names = append(names, p.Name)
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestGetAllPizzasMalformedFilters(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+
+	filters := []string{
+		"price_gte:cheap",
+		"created_after:yesterday",
+		"secret:1",
+		"(price_gte:1",
+		"price_gte:1 and",
+		"ingredient:\"unterminated",
+		"price_gte:1 xor price_lte:2",
+		"; DROP TABLE pizzas",
+	}
+
+	for _, filter := range filters {
+		t.Run(filter, func(t *testing.T) {
+			_, err := service.GetAllPizzas(PizzaListOptions{Filter: filter})
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+		})
+	}
+}
+
+func TestRestoreAndPurgeDeletedPizzas(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewPizzaService(db)
+	seedPizzas(t, service)
+
+	page, err := service.GetAllPizzas(PizzaListOptions{Sort: "name"})
+	require.NoError(t, err)
+	hawaiian, marinara := page.Items[0], page.Items[1]
+	_, err = NewPizzaVariantService(db).CreateVariant(models.PizzaVariant{
+		PizzaID: marinara.ID, SKU: "MARI-L", Size: "large", Price: usd(1299), Available: true,
+	})
+	require.NoError(t, err)
+
+	// Only soft-deleted pizzas can be restored or purged
+	_, err = service.RestorePizza(hawaiian.ID)
+	assert.ErrorIs(t, err, ErrPizzaNotDeleted)
+	assert.ErrorIs(t, service.PurgePizza(hawaiian.ID), ErrPizzaNotDeleted)
+	_, err = service.RestorePizza(999)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, service.DeletePizza(hawaiian.ID, 0))
+	require.NoError(t, service.DeletePizza(marinara.ID, 0))
+
+	page, err = service.GetAllPizzas(PizzaListOptions{IncludeTotal: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *page.Total)
+
+	page, err = service.GetAllPizzas(PizzaListOptions{IncludeDeleted: true, IncludeTotal: true, Filter: "ingredient:ham"})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.True(t, page.Items[0].DeletedAt.Valid)
+	assert.Equal(t, []string{"Tomato Sauce", "Mozzarella", "Ham", "Pineapple"}, page.Items[0].Ingredients)
+
+	restored, err := service.RestorePizza(hawaiian.ID)
+	require.NoError(t, err)
+	assert.False(t, restored.DeletedAt.Valid)
+	assert.Len(t, restored.Ingredients, 4)
+
+	require.NoError(t, service.PurgePizza(marinara.ID))
+	_, err = service.GetPizzaByIDIncludingDeleted(marinara.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	var orphans int64
+	require.NoError(t, db.Model(&models.PizzaVariant{}).Where("pizza_id = ?", marinara.ID).Count(&orphans).Error)
+	assert.Zero(t, orphans)
+	require.NoError(t, db.Model(&models.PizzaIngredient{}).Where("pizza_id = ?", marinara.ID).Count(&orphans).Error)
+	assert.Zero(t, orphans)
+
+	page, err = service.GetAllPizzas(PizzaListOptions{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 4)
+}
+
+func TestPatchPizza(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewPizzaService(db)
+
+	pizza, err := service.CreatePizza(models.Pizza{
+		Name:        "Margherita",
+		Description: "Classic Italian pizza",
+		Price:       usd(1099),
+		CreatedBy:   1,
+		Ingredients: []string{"Tomato Sauce", "Mozzarella"},
+	})
+	require.NoError(t, err)
+
+	// Omitted fields keep their values
+	patched, err := service.PatchPizza(pizza.ID, MergePatchContentType, []byte(`{"price":"11.50","ingredients":["Tomato Sauce","Mozzarella","Basil"]}`), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Classic Italian pizza", patched.Description)
+	assert.Equal(t, usd(1150), patched.Price)
+	assert.Equal(t, []string{"Tomato Sauce", "Mozzarella", "Basil"}, patched.Ingredients)
+	assert.Equal(t, uint(1), patched.CreatedBy)
+	assert.True(t, pizza.CreatedAt.Equal(patched.CreatedAt))
+
+	patched, err = service.PatchPizza(pizza.ID, JSONPatchContentType, []byte(`[
+		{"op":"test","path":"/price","value":11.5},
+		{"op":"remove","path":"/ingredients/0"},
+		{"op":"replace","path":"/name","value":"Margherita Bianca"},
+		{"op":"remove","path":"/description"}
+	]`), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "Margherita Bianca", patched.Name)
+	assert.Empty(t, patched.Description)
+	assert.Equal(t, []string{"Mozzarella", "Basil"}, patched.Ingredients)
+
+	stored, err := service.GetPizzaByID(pizza.ID)
+	require.NoError(t, err)
+	assert.Equal(t, patched.Name, stored.Name)
+	assert.Equal(t, usd(1150), stored.Price)
+
+	testCases := []struct {
+		name        string
+		contentType string
+		patch       string
+		field       string
+	}{
+		{name: "change id", contentType: MergePatchContentType, patch: `{"id":99}`, field: "id"},
+		{name: "change creator", contentType: MergePatchContentType, patch: `{"created_by":2}`, field: "created_by"},
+		{name: "remove created_at", contentType: JSONPatchContentType, patch: `[{"op":"remove","path":"/created_at"}]`, field: "created_at"},
+		{name: "change price_minor", contentType: MergePatchContentType, patch: `{"price_minor":1}`, field: "price_minor"},
+		{name: "remove price", contentType: MergePatchContentType, patch: `{"price":null}`, field: "price"},
+		{name: "inexact price", contentType: MergePatchContentType, patch: `{"currency":"JPY"}`, field: "price"},
+		{name: "wrong type", contentType: MergePatchContentType, patch: `{"name":5}`, field: "name"},
+		{name: "replace document", contentType: MergePatchContentType, patch: `["pizza"]`, field: "patch"},
+		{name: "unsupported format", contentType: "application/json", patch: `{}`, field: "Content-Type"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.PatchPizza(pizza.ID, tt.contentType, []byte(tt.patch), 0)
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+
+	_, err = service.PatchPizza(pizza.ID, JSONPatchContentType, []byte(`[{"op":"test","path":"/name","value":"Margherita"}]`), 0)
+	var testErr *PatchTestFailedError
+	assert.ErrorAs(t, err, &testErr)
+
+	_, err = service.PatchPizza(999, MergePatchContentType, []byte(`{}`), 0)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestPizzaVersionCompareAndSwap(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewPizzaService(db)
+
+	pizza, err := service.CreatePizza(models.Pizza{Name: "Margherita", Price: usd(1099), CreatedBy: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pizza.Version)
+
+	pizza.Price = usd(1199)
+	updated, err := service.UpdatePizza(pizza, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+
+	// A writer still holding version 1 loses against the update above
+	pizza.Price = usd(999)
+	_, err = service.UpdatePizza(pizza, 1)
+	assert.ErrorIs(t, err, ErrPizzaVersionMismatch)
+	_, err = service.PatchPizza(pizza.ID, MergePatchContentType, []byte(`{"name":"Stale"}`), 1)
+	assert.ErrorIs(t, err, ErrPizzaVersionMismatch)
+
+	patched, err := service.PatchPizza(pizza.ID, MergePatchContentType, []byte(`{"name":"Margherita DOP"}`), 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), patched.Version)
+
+	// Changing a variant changes the pizza representation and therefore its version
+	_, err = NewPizzaVariantService(db).CreateVariant(models.PizzaVariant{
+		PizzaID: pizza.ID, SKU: "MARG-L", Size: "large", Price: usd(1499), Available: true,
+	})
+	require.NoError(t, err)
+	stored, err := service.GetPizzaByID(pizza.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stored.Version)
+	assert.Equal(t, usd(1199), stored.Price)
+
+	assert.ErrorIs(t, service.DeletePizza(pizza.ID, 3), ErrPizzaVersionMismatch)
+	require.NoError(t, service.DeletePizza(pizza.ID, 4))
+	assert.ErrorIs(t, service.DeletePizza(pizza.ID, 5), gorm.ErrRecordNotFound)
+}
+
+func TestCatalogRevisionChangesOnEveryWrite(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewPizzaService(db)
+
+	previous, err := service.GetCatalogRevision()
+	require.NoError(t, err)
+	requireNewRevision := func(step string) {
+		revision, err := service.GetCatalogRevision()
+		require.NoError(t, err)
+		assert.NotEqual(t, previous, revision, "revision unchanged after %s", step)
+		previous = revision
+	}
+
+	other, err := service.CreatePizza(models.Pizza{Name: "Marinara", Price: usd(999), CreatedBy: 1})
+	require.NoError(t, err)
+	requireNewRevision("first create")
+	pizza, err := service.CreatePizza(models.Pizza{Name: "Margherita", Price: usd(1099), CreatedBy: 1})
+	require.NoError(t, err)
+	requireNewRevision("create")
+
+	pizza.Price = usd(1199)
+	_, err = service.UpdatePizza(pizza, 0)
+	require.NoError(t, err)
+	requireNewRevision("update")
+
+	_, err = service.PatchPizza(pizza.ID, MergePatchContentType, []byte(`{"name":"Margherita DOP"}`), 0)
+	require.NoError(t, err)
+	requireNewRevision("patch")
+
+	require.NoError(t, service.DeletePizza(pizza.ID, 0))
+	requireNewRevision("delete")
+
+	_, err = service.RestorePizza(pizza.ID)
+	require.NoError(t, err)
+	requireNewRevision("restore")
+
+	require.NoError(t, service.DeletePizza(pizza.ID, 0))
+	requireNewRevision("second delete")
+	require.NoError(t, service.PurgePizza(pizza.ID))
+	requireNewRevision("purge")
+
+	revision, err := service.GetPizzaRevision(other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, other.Version, revision.Version)
+	assert.True(t, other.UpdatedAt.Equal(revision.UpdatedAt))
+	assert.Empty(t, revision.Name)
+}
+
+func TestPizzaTransactionRollsBackEveryChange(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewPizzaService(db)
+
+	pizza, err := service.CreatePizza(models.Pizza{Name: "Margherita", Price: usd(1099), CreatedBy: 1})
+	require.NoError(t, err)
+
+	err = service.Transaction(func(tx PizzaService) error {
+		if _, err := tx.CreatePizza(models.Pizza{Name: "Marinara", Price: usd(999), CreatedBy: 1}); err != nil {
+			return err
+		}
+		pizza.Price = usd(1199)
+		if _, err := tx.UpdatePizza(pizza, pizza.Version); err != nil {
+			return err
+		}
+		// The first update already moved the pizza past this version
+		_, err := tx.UpdatePizza(pizza, pizza.Version)
+		return err
+	})
+	require.ErrorIs(t, err, ErrPizzaVersionMismatch)
+
+	page, err := service.GetAllPizzas(PizzaListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, usd(1099), page.Items[0].Price)
+	assert.Equal(t, int64(1), page.Items[0].Version)
+
+	err = service.Transaction(func(tx PizzaService) error {
+		if _, err := tx.CreatePizza(models.Pizza{Name: "Marinara", Price: usd(999), CreatedBy: 1}); err != nil {
+			return err
+		}
+		return tx.DeletePizza(pizza.ID, pizza.Version)
+	})
+	require.NoError(t, err)
+
+	page, err = service.GetAllPizzas(PizzaListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "Marinara", page.Items[0].Name)
+}
@@ -0,0 +1,506 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Catalog transfer formats accepted by ExportPizzas and ImportPizzas
+const (
+	TransferFormatCSV    = "csv"
+	TransferFormatJSON   = "json"
+	TransferFormatNDJSON = "ndjson"
+)
+
+const (
+	// MaxImportRows caps the number of pizzas in a single import
+	MaxImportRows = 1000
+	// exportBatchSize is the number of pizzas loaded per query while exporting
+	exportBatchSize = 100
+	// ingredientSeparator joins ingredient names in a single CSV cell
+	ingredientSeparator = ";"
+)
+
+// csvExportColumns is the header of exported CSV files
+var csvExportColumns = []string{"id", "name", "description", "price", "currency", "ingredients", "created_by", "created_at", "updated_at"}
+
+// csvImportColumns are the CSV columns an import reads; name and price are required
+var csvImportColumns = map[string]bool{"name": true, "description": true, "price": true, "currency": true, "ingredients": true}
+
+// csvIgnoredColumns are exported columns that an import skips, so exported files can be edited and loaded again
+var csvIgnoredColumns = map[string]bool{"id": true, "price_minor": true, "created_by": true, "created_at": true, "updated_at": true}
+
+// ImportRowError describes why a single row of an import was rejected
+// Rows are numbered from 1 in file order, not counting the CSV header or blank NDJSON lines
+type ImportRowError struct {
+	Row int
+	ValidationError
+}
+
+// ImportError is returned when an import contains invalid rows; nothing is imported
+type ImportError struct {
+	Rows []ImportRowError
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%d invalid rows", len(e.Rows))
+}
+
+// importRow is a decoded pizza, or the reason it could not be decoded
+type importRow struct {
+	pizza models.Pizza
+	err   *ValidationError
+}
+
+func (s *pizzaService) ExportPizzas(format string, w io.Writer) error {
+	encoder, err := newPizzaEncoder(format, w)
+	if err != nil {
+		return err
+	}
+
+	var batch []models.Pizza
+	err = preloadAssociations(s.db).FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			resolveAssociations(&batch[i])
+			if err := encoder.encode(batch[i]); err != nil {
+				return err
+			}
+		}
+		// Send each batch to the client instead of buffering the whole catalog
+		if err := encoder.flush(); err != nil {
+			return err
+		}
+		if flusher, ok := w.(interface{ Flush() }); ok {
+			flusher.Flush()
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	return encoder.close()
+}
+
+func (s *pizzaService) ImportPizzas(format string, r io.Reader, createdBy uint) ([]models.Pizza, error) {
+	rows, err := decodePizzaRows(format, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, &ValidationError{Field: "body", Message: "must contain at least one pizza"}
+	}
+
+	// Validate every row up front so the caller gets all problems at once
+	importErr := &ImportError{}
+	pizzas := make([]models.Pizza, 0, len(rows))
+	for i, row := range rows {
+		if row.err == nil {
+			row.err = validateImportedPizza(&row.pizza)
+		}
+		if row.err != nil {
+			importErr.Rows = append(importErr.Rows, ImportRowError{Row: i + 1, ValidationError: *row.err})
+			continue
+		}
+		row.pizza.CreatedBy = createdBy
+		pizzas = append(pizzas, row.pizza)
+	}
+	if len(importErr.Rows) > 0 {
+		return nil, importErr
+	}
+
+	created := make([]models.Pizza, 0, len(pizzas))
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, pizza := range pizzas {
+			pizza, err := createPizza(tx, pizza)
+			if err != nil {
+				return err
+			}
+			created = append(created, pizza)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// validateImportedPizza checks the fields a create request would otherwise enforce
+func validateImportedPizza(pizza *models.Pizza) *ValidationError {
+	pizza.Name = strings.TrimSpace(pizza.Name)
+	if pizza.Name == "" {
+		return &ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if err := normalizeMoney(&pizza.Price); err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return validationErr
+		}
+		return &ValidationError{Field: "price", Message: err.Error()}
+	}
+	return nil
+}
+
+// decodePizzaRows reads the pizzas of an import in the given format
+// Problems confined to a row are reported on that row; problems with the file itself are returned as errors
+func decodePizzaRows(format string, r io.Reader) ([]importRow, error) {
+	switch format {
+	case TransferFormatCSV:
+		return decodePizzaCSV(r)
+	case TransferFormatJSON:
+		return decodePizzaJSON(r)
+	case TransferFormatNDJSON:
+		return decodePizzaNDJSON(r)
+	default:
+		return nil, unsupportedTransferFormat()
+	}
+}
+
+func decodePizzaCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, csvReadError("header", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheet applications often prepend a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch {
+		case csvIgnoredColumns[name]:
+			continue
+		case !csvImportColumns[name]:
+			return nil, &ValidationError{Field: "header", Message: fmt.Sprintf("unknown column '%s'", name)}
+		}
+		if _, duplicate := columns[name]; duplicate {
+			return nil, &ValidationError{Field: "header", Message: fmt.Sprintf("duplicate column '%s'", name)}
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, &ValidationError{Field: "header", Message: fmt.Sprintf("missing column '%s'", required)}
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if len(rows) == MaxImportRows {
+			return nil, tooManyImportRows()
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, importRow{err: &ValidationError{Field: "row", Message: parseErr.Error()}})
+			// A wrong field count is confined to its record; any other syntax error leaves the rest unreadable
+			if errors.Is(parseErr.Err, csv.ErrFieldCount) {
+				continue
+			}
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, pizzaFromCSV(record, columns))
+	}
+}
+
+// csvReadError reports a malformed header as a validation error and passes read failures through
+func csvReadError(field string, err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &ValidationError{Field: field, Message: parseErr.Error()}
+	}
+	return err
+}
+
+// pizzaFromCSV builds a pizza from a CSV record using the column positions of the header
+func pizzaFromCSV(record []string, columns map[string]int) importRow {
+	cell := func(name string) string {
+		i, ok := columns[name]
+		if !ok {
+			return ""
+		}
+		return unescapeCSVFormula(strings.TrimSpace(record[i]))
+	}
+
+	pizza := models.Pizza{Name: cell("name"), Description: cell("description")}
+	for _, name := range strings.Split(cell("ingredients"), ingredientSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			pizza.Ingredients = append(pizza.Ingredients, name)
+		}
+	}
+
+	price, err := models.ParseMoney(cell("price"), cell("currency"))
+	if err != nil {
+		var moneyErr *models.MoneyError
+		if errors.As(err, &moneyErr) {
+			return importRow{err: &ValidationError{Field: moneyErr.Field, Message: moneyErr.Message}}
+		}
+		return importRow{err: &ValidationError{Field: "price", Message: err.Error()}}
+	}
+	pizza.Price = price
+	return importRow{pizza: pizza}
+}
+
+func decodePizzaJSON(r io.Reader) ([]importRow, error) {
+	notAnArray := &ValidationError{Field: "body", Message: "must be a JSON array of pizzas"}
+
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if isJSONSyntaxError(err) {
+		return nil, notAnArray
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('[') {
+		return nil, notAnArray
+	}
+
+	var rows []importRow
+	for decoder.More() {
+		if len(rows) == MaxImportRows {
+			return nil, tooManyImportRows()
+		}
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if isJSONSyntaxError(err) {
+			// The decoder cannot resynchronize after a syntax error, so the rest of the array is unreadable
+			return append(rows, importRow{err: &ValidationError{Field: "row", Message: "is not valid JSON"}}), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, pizzaFromJSON(raw))
+	}
+
+	_, err = decoder.Token()
+	if isJSONSyntaxError(err) {
+		return nil, notAnArray
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// isJSONSyntaxError reports whether a decoding error is caused by malformed or truncated JSON
+func isJSONSyntaxError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func decodePizzaNDJSON(r io.Reader) ([]importRow, error) {
+	reader := bufio.NewReader(r)
+	var rows []importRow
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if len(rows) == MaxImportRows {
+				return nil, tooManyImportRows()
+			}
+			rows = append(rows, pizzaFromJSON(line))
+		}
+		if err == io.EOF {
+			return rows, nil
+		}
+	}
+}
+
+// pizzaFromJSON builds a pizza from one JSON object, keeping only the fields a create request accepts
+func pizzaFromJSON(raw []byte) importRow {
+	var decoded models.Pizza
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		var moneyErr *models.MoneyError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &moneyErr):
+			return importRow{err: &ValidationError{Field: moneyErr.Field, Message: moneyErr.Message}}
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return importRow{err: &ValidationError{Field: typeErr.Field, Message: fmt.Sprintf("must be a %s", typeErr.Type)}}
+		case errors.As(err, &typeErr):
+			return importRow{err: &ValidationError{Field: "row", Message: "must be a JSON object"}}
+		default:
+			return importRow{err: &ValidationError{Field: "row", Message: "is not valid JSON"}}
+		}
+	}
+
+	return importRow{pizza: models.Pizza{
+		Name:        decoded.Name,
+		Description: decoded.Description,
+		Price:       decoded.Price,
+		Ingredients: decoded.Ingredients,
+	}}
+}
+
+func tooManyImportRows() *ValidationError {
+	return &ValidationError{Field: "body", Message: fmt.Sprintf("must not contain more than %d pizzas", MaxImportRows)}
+}
+
+func unsupportedTransferFormat() *ValidationError {
+	return &ValidationError{Field: "format", Message: fmt.Sprintf("must be one of %s, %s, %s",
+		TransferFormatCSV, TransferFormatJSON, TransferFormatNDJSON)}
+}
+
+// pizzaEncoder writes pizzas to an export stream
+type pizzaEncoder interface {
+	encode(pizza models.Pizza) error
+	// flush writes buffered output to the underlying writer
+	flush() error
+	// close terminates the document
+	close() error
+}
+
+func newPizzaEncoder(format string, w io.Writer) (pizzaEncoder, error) {
+	switch format {
+	case TransferFormatCSV:
+		return &csvPizzaEncoder{writer: csv.NewWriter(w)}, nil
+	case TransferFormatJSON:
+		return &jsonPizzaEncoder{w: w}, nil
+	case TransferFormatNDJSON:
+		return &ndjsonPizzaEncoder{encoder: json.NewEncoder(w)}, nil
+	default:
+		return nil, unsupportedTransferFormat()
+	}
+}
+
+// csvPizzaEncoder writes one pizza per record below a header of csvExportColumns
+type csvPizzaEncoder struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (e *csvPizzaEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	return e.writer.Write(csvExportColumns)
+}
+
+func (e *csvPizzaEncoder) encode(pizza models.Pizza) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.writer.Write([]string{
+		strconv.Itoa(pizza.ID),
+		escapeCSVFormula(pizza.Name),
+		escapeCSVFormula(pizza.Description),
+		pizza.Price.Decimal(),
+		pizza.Price.Currency,
+		escapeCSVFormula(strings.Join(pizza.Ingredients, ingredientSeparator+" ")),
+		strconv.FormatUint(uint64(pizza.CreatedBy), 10),
+		pizza.CreatedAt.UTC().Format(time.RFC3339),
+		pizza.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvPizzaEncoder) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvPizzaEncoder) close() error {
+	// An empty catalog still produces a header so the file can be used as a template
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.flush()
+}
+
+// jsonPizzaEncoder writes a single JSON array
+type jsonPizzaEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonPizzaEncoder) encode(pizza models.Pizza) error {
+	data, err := json.Marshal(pizza)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if e.count == 0 {
+		separator = "["
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonPizzaEncoder) flush() error {
+	return nil
+}
+
+func (e *jsonPizzaEncoder) close() error {
+	closing := "]"
+	if e.count == 0 {
+		closing = "[]"
+	}
+	_, err := io.WriteString(e.w, closing+"\n")
+	return err
+}
+
+// ndjsonPizzaEncoder writes one JSON object per line
+type ndjsonPizzaEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonPizzaEncoder) encode(pizza models.Pizza) error {
+	return e.encoder.Encode(pizza)
+}
+
+func (e *ndjsonPizzaEncoder) flush() error {
+	return nil
+}
+
+func (e *ndjsonPizzaEncoder) close() error {
+	return nil
+}
+
+// escapeCSVFormula prefixes cells that spreadsheet applications would evaluate as formulas
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVFormula reverts escapeCSVFormula so exported files import unchanged
+func unescapeCSVFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{TransferFormatCSV, TransferFormatJSON, TransferFormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			source := NewPizzaService(setupTestDB(t))
+			seedPizzas(t, source)
+			_, err := source.CreatePizza(models.Pizza{
+				Name: "=HYPERLINK(\"x\")", Description: "Quoted, \"tricky\"", Price: models.Money{Amount: 1500, Currency: "JPY"}, CreatedBy: 1,
+			})
+			require.NoError(t, err)
+
+			var exported bytes.Buffer
+			require.NoError(t, source.ExportPizzas(format, &exported))
+
+			target := NewPizzaService(setupTestDB(t))
+			imported, err := target.ImportPizzas(format, &exported, 9)
+			require.NoError(t, err)
+
+			original, err := source.GetAllPizzas(PizzaListOptions{})
+			require.NoError(t, err)
+			require.Len(t, imported, len(original.Items))
+			for i, pizza := range imported {
+				assert.Equal(t, original.Items[i].Name, pizza.Name)
+				assert.Equal(t, original.Items[i].Description, pizza.Description)
+				assert.Equal(t, original.Items[i].Price, pizza.Price)
+				assert.Equal(t, original.Items[i].Ingredients, pizza.Ingredients)
+				assert.Equal(t, uint(9), pizza.CreatedBy)
+			}
+		})
+	}
+}
+
+func TestExportPizzasCSV(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+
+	var empty bytes.Buffer
+	require.NoError(t, service.ExportPizzas(TransferFormatCSV, &empty))
+	assert.Equal(t, "id,name,description,price,currency,ingredients,created_by,created_at,updated_at\n", empty.String())
+
+	_, err := service.CreatePizza(models.Pizza{Name: "@SUM(A1)", Price: usd(1099), CreatedBy: 1, Ingredients: []string{"Tomato Sauce", "Basil"}})
+	require.NoError(t, err)
+	var exported bytes.Buffer
+	require.NoError(t, service.ExportPizzas(TransferFormatCSV, &exported))
+	assert.Contains(t, exported.String(), "1,'@SUM(A1),,10.99,USD,Tomato Sauce; Basil,1,")
+
+	var array bytes.Buffer
+	require.NoError(t, NewPizzaService(setupTestDB(t)).ExportPizzas(TransferFormatJSON, &array))
+	assert.JSONEq(t, `[]`, array.String())
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, service.ExportPizzas("xml", &bytes.Buffer{}), &validationErr)
+	assert.Equal(t, "format", validationErr.Field)
+}
+
+func TestImportPizzasIsAllOrNothing(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewPizzaService(db)
+
+	csvFile := strings.Join([]string{
+		"name,price,currency,ingredients",
+		"Margherita,10.99,,Tomato Sauce; Mozzarella",
+		",9.99,,",
+		"Diavola,12.999,USD,",
+		"Marinara,8.50,XXX,",
+		"Quattro,11,EUR",
+		"Calzone,abc,,",
+	}, "\n")
+	_, err := service.ImportPizzas(TransferFormatCSV, strings.NewReader(csvFile), 1)
+	var importErr *ImportError
+	require.ErrorAs(t, err, &importErr)
+
+	rows := map[int]string{}
+	for _, row := range importErr.Rows {
+		rows[row.Row] = row.Field
+	}
+	assert.Equal(t, map[int]string{2: "name", 3: "price", 4: "currency", 5: "row", 6: "price"}, rows)
+
+	var count int64
+	require.NoError(t, db.Model(&models.Pizza{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	ndjson := "{\"name\":\"Margherita\",\"price\":\"10.99\"}\n\n{\"name\":5}\n{not json\n{\"name\":\"Funghi\",\"price\":-1}\n"
+	_, err = service.ImportPizzas(TransferFormatNDJSON, strings.NewReader(ndjson), 1)
+	require.ErrorAs(t, err, &importErr)
+	rows = map[int]string{}
+	for _, row := range importErr.Rows {
+		rows[row.Row] = row.Field
+	}
+	assert.Equal(t, map[int]string{2: "name", 3: "row", 4: "price"}, rows)
+
+	// A truncated array is reported on the row that could not be read
+	_, err = service.ImportPizzas(TransferFormatJSON, strings.NewReader(`[{"name":"Margherita","price":1},{"name":`), 1)
+	require.ErrorAs(t, err, &importErr)
+	require.Len(t, importErr.Rows, 1)
+	assert.Equal(t, 2, importErr.Rows[0].Row)
+
+	// Read-only fields of an exported document are ignored
+	imported, err := service.ImportPizzas(TransferFormatJSON,
+		strings.NewReader(`[{"id":42,"name":"Margherita","price":10.99,"created_by":7,"variants":[{"sku":"X"}]}]`), 3)
+	require.NoError(t, err)
+	require.Len(t, imported, 1)
+	assert.NotEqual(t, 42, imported[0].ID)
+	assert.Equal(t, uint(3), imported[0].CreatedBy)
+	assert.Empty(t, imported[0].Variants)
+}
+
+func TestImportPizzasFileErrors(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+
+	tooMany := &strings.Builder{}
+	tooMany.WriteString("name,price\n")
+	for i := 0; i <= MaxImportRows; i++ {
+		tooMany.WriteString("Margherita,10\n")
+	}
+	hugeArray, err := json.Marshal(make([]struct{}, MaxImportRows+1))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		format string
+		body   string
+		field  string
+	}{
+		{name: "empty csv", format: TransferFormatCSV, body: "", field: "body"},
+		{name: "header only", format: TransferFormatCSV, body: "name,price\n", field: "body"},
+		{name: "unknown column", format: TransferFormatCSV, body: "name,price,colour\n", field: "header"},
+		{name: "missing price column", format: TransferFormatCSV, body: "name,description\n", field: "header"},
+		{name: "duplicate column", format: TransferFormatCSV, body: "name,price,Name\n", field: "header"},
+		{name: "too many rows", format: TransferFormatCSV, body: tooMany.String(), field: "body"},
+		{name: "json object", format: TransferFormatJSON, body: `{"name":"Margherita"}`, field: "body"},
+		{name: "not json", format: TransferFormatJSON, body: `pizza`, field: "body"},
+		{name: "too many json rows", format: TransferFormatJSON, body: string(hugeArray), field: "body"},
+		{name: "unknown format", format: "xlsx", body: "", field: "format"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.ImportPizzas(tt.format, strings.NewReader(tt.body), 1)
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// normalizeMoney applies the default currency to a price without one and reports an invalid
+// price as a ValidationError
+func normalizeMoney(price *models.Money) error {
+	price.Currency = strings.ToUpper(strings.TrimSpace(price.Currency))
+	if price.Currency == "" {
+		price.Currency = models.DefaultCurrency()
+	}
+	return AsMoneyValidationError(price.Validate())
+}
+
+// AsMoneyValidationError converts a *models.MoneyError into a *ValidationError so callers can
+// report bad prices like any other invalid field. Other errors are returned unchanged.
+func AsMoneyValidationError(err error) error {
+	var moneyErr *models.MoneyError
+	if errors.As(err, &moneyErr) {
+		return &ValidationError{Field: moneyErr.Field, Message: moneyErr.Message}
+	}
+	return err
+}
+
+// MigratePriceToMinorUnits converts the legacy floating point price column of pizzas and
+// variants into the exact price_amount/price_currency pair, in place.
+// Legacy prices carry no currency, so they are interpreted in the default currency.
+// The migration is idempotent: the legacy column is dropped once its values have been copied.
+func MigratePriceToMinorUnits(db *gorm.DB) error {
+	currency := models.DefaultCurrency()
+	exponent, err := models.CurrencyExponent(currency)
+	if err != nil {
+		return err
+	}
+	scale := int64(math.Pow10(exponent))
+
+	// legacyPrice lets the migrator resolve the old column on both tables
+	type legacyPrice struct {
+		Price *float64
+	}
+
+	for _, table := range []string{"pizzas", "pizza_variants"} {
+		if !db.Migrator().HasColumn(table, "price") {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			update := fmt.Sprintf(
+				"UPDATE %s SET price_amount = CAST(ROUND(price * %d) AS BIGINT), price_currency = ? WHERE price IS NOT NULL",
+				table, scale)
+			if err := tx.Exec(update, currency).Error; err != nil {
+				return err
+			}
+			return tx.Table(table).Migrator().DropColumn(&legacyPrice{}, "price")
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func usd(amount int64) models.Money {
+	return models.Money{Amount: amount, Currency: "USD"}
+}
+
+func TestPizzaPriceRoundTripsExactly(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+
+	testCases := []struct {
+		name     string
+		body     string
+		expected models.Money
+		price    string
+	}{
+		{name: "number", body: `{"name":"Margherita","price":10.99}`, expected: usd(1099), price: "10.99"},
+		{name: "string", body: `{"name":"Margherita","price":"0.30"}`, expected: usd(30), price: "0.30"},
+		{name: "zero decimal currency", body: `{"name":"Margherita","price":1200,"currency":"jpy"}`, expected: models.Money{Amount: 1200, Currency: "JPY"}, price: "1200"},
+		{name: "three decimal currency", body: `{"name":"Margherita","price":"4.125","currency":"KWD"}`, expected: models.Money{Amount: 4125, Currency: "KWD"}, price: "4.125"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var pizza models.Pizza
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &pizza))
+			pizza.CreatedBy = 1
+
+			created, err := service.CreatePizza(pizza)
+			require.NoError(t, err)
+			stored, err := service.GetPizzaByID(created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, stored.Price)
+
+			out, err := json.Marshal(stored)
+			require.NoError(t, err)
+			var fields map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal(out, &fields))
+			assert.Equal(t, tt.price, string(fields["price"]))
+			assert.Equal(t, `"`+tt.expected.Currency+`"`, string(fields["currency"]))
+		})
+	}
+}
+
+func TestPizzaPriceRejectsInexactAmounts(t *testing.T) {
+	for _, body := range []string{
+		`{"name":"Margherita","price":10.999}`,
+		`{"name":"Margherita","price":1e3}`,
+		`{"name":"Margherita","price":-1}`,
+		`{"name":"Margherita","price":"ten"}`,
+		`{"name":"Margherita","price":12.5,"currency":"JPY"}`,
+		`{"name":"Margherita","price":12,"currency":"ABC"}`,
+	} {
+		var pizza models.Pizza
+		var moneyErr *models.MoneyError
+		assert.ErrorAs(t, json.Unmarshal([]byte(body), &pizza), &moneyErr, body)
+	}
+}
+
+func TestPriceFiltersUseMinorUnits(t *testing.T) {
+	service := NewPizzaService(setupTestDB(t))
+	seedPizzas(t, service)
+	_, err := service.CreatePizza(models.Pizza{Name: "Napoli", Price: models.Money{Amount: 1100, Currency: "JPY"}, CreatedBy: 1})
+	require.NoError(t, err)
+
+	gte, err := ParsePriceFilter("price_gte", "1000", "JPY")
+	require.NoError(t, err)
+	page, err := service.GetAllPizzas(PizzaListOptions{Currency: "jpy", PriceGTE: &gte})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "Napoli", page.Items[0].Name)
+
+	page, err = service.GetAllPizzas(PizzaListOptions{Filter: "currency:usd and price_lte:10.99"})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+
+	_, err = ParsePriceFilter("price_lte", "10.999", "")
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "price_lte", validationErr.Field)
+}
+
+func TestMigratePriceToMinorUnits(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Recreate the legacy floating point columns, quoted as GORM created them, and rows written before prices were exact
+	require.NoError(t, db.Exec("ALTER TABLE pizzas ADD COLUMN `price` real").Error)
+	require.NoError(t, db.Exec("ALTER TABLE pizza_variants ADD COLUMN `price` real").Error)
+	require.NoError(t, db.Exec(`INSERT INTO pizzas (name, created_by, price) VALUES
+		('Margherita', 1, 10.99), ('Pepperoni', 1, 12.3), ('Free', 1, NULL)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO pizza_variants (pizza_id, sku, size, price, available) VALUES
+		(1, 'MARG-L', 'large', 14.99, 1)`).Error)
+
+	require.NoError(t, MigratePriceToMinorUnits(db))
+	// Running again is a no-op once the legacy columns are gone
+	require.NoError(t, MigratePriceToMinorUnits(db))
+
+	assert.False(t, db.Migrator().HasColumn("pizzas", "price"))
+	assert.False(t, db.Migrator().HasColumn("pizza_variants", "price"))
+
+	service := NewPizzaService(db)
+	page, err := service.GetAllPizzas(PizzaListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 3)
+	assert.Equal(t, usd(1099), page.Items[0].Price)
+	assert.Equal(t, usd(1230), page.Items[1].Price)
+	assert.Equal(t, int64(0), page.Items[2].Price.Amount)
+	assert.Equal(t, []models.PizzaVariant{}, page.Items[2].Variants)
+
+	require.Len(t, page.Items[0].Variants, 1)
+	assert.Equal(t, usd(1499), page.Items[0].Variants[0].Price)
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrVariantSKUExists is returned when a SKU is already used by another variant
+var ErrVariantSKUExists = errors.New("variant_sku_already_exists")
+
+// skuPattern restricts SKUs to characters that are safe in URLs, CSV files and barcodes
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// PizzaVariantService manages the sizes and crust options of a pizza
+type PizzaVariantService interface {
+	// GetVariants lists the variants of a pizza
+	GetVariants(pizzaID int) ([]models.PizzaVariant, error)
+	// GetVariant retrieves a single variant of a pizza
+	GetVariant(pizzaID, variantID int) (models.PizzaVariant, error)
+	// CreateVariant adds a variant to a pizza
+	CreateVariant(variant models.PizzaVariant) (models.PizzaVariant, error)
+	// UpdateVariant replaces the fields of an existing variant
+	UpdateVariant(variant models.PizzaVariant) (models.PizzaVariant, error)
+	// DeleteVariant removes a variant from a pizza
+	DeleteVariant(pizzaID, variantID int) error
+}
+
+// pizzaVariantService is the implementation of the PizzaVariantService interface
+type pizzaVariantService struct {
+	db *gorm.DB
+}
+
+// NewPizzaVariantService creates a new instance of PizzaVariantService
+func NewPizzaVariantService(db *gorm.DB) PizzaVariantService {
+	return &pizzaVariantService{db: db}
+}
+
+func (s *pizzaVariantService) GetVariants(pizzaID int) ([]models.PizzaVariant, error) {
+	var variants []models.PizzaVariant
+	if err := s.db.Where("pizza_id = ?", pizzaID).Order("id ASC").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+func (s *pizzaVariantService) GetVariant(pizzaID, variantID int) (models.PizzaVariant, error) {
+	var variant models.PizzaVariant
+	if err := s.db.Where("pizza_id = ?", pizzaID).First(&variant, variantID).Error; err != nil {
+		return models.PizzaVariant{}, err
+	}
+	return variant, nil
+}
+
+func (s *pizzaVariantService) CreateVariant(variant models.PizzaVariant) (models.PizzaVariant, error) {
+	if err := normalizeVariant(&variant); err != nil {
+		return models.PizzaVariant{}, err
+	}
+	if err := s.ensureSKUAvailable(variant.SKU, 0); err != nil {
+		return models.PizzaVariant{}, err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&variant).Error; err != nil {
+			return err
+		}
+		return bumpPizzaVersion(tx, "id = ?", variant.PizzaID)
+	})
+	if err != nil {
+		return models.PizzaVariant{}, err
+	}
+	return variant, nil
+}
+
+func (s *pizzaVariantService) UpdateVariant(variant models.PizzaVariant) (models.PizzaVariant, error) {
+	existing, err := s.GetVariant(variant.PizzaID, variant.ID)
+	if err != nil {
+		return models.PizzaVariant{}, err
+	}
+	if err := normalizeVariant(&variant); err != nil {
+		return models.PizzaVariant{}, err
+	}
+	if err := s.ensureSKUAvailable(variant.SKU, variant.ID); err != nil {
+		return models.PizzaVariant{}, err
+	}
+
+	variant.CreatedAt = existing.CreatedAt
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&variant).Error; err != nil {
+			return err
+		}
+		return bumpPizzaVersion(tx, "id = ?", variant.PizzaID)
+	})
+	if err != nil {
+		return models.PizzaVariant{}, err
+	}
+	return variant, nil
+}
+
+func (s *pizzaVariantService) DeleteVariant(pizzaID, variantID int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("pizza_id = ?", pizzaID).Delete(&models.PizzaVariant{}, variantID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return bumpPizzaVersion(tx, "id = ?", pizzaID)
+	})
+}
+
+// ensureSKUAvailable checks that no other variant uses the SKU
+func (s *pizzaVariantService) ensureSKUAvailable(sku string, exceptID int) error {
+	var count int64
+	if err := s.db.Model(&models.PizzaVariant{}).
+		Where("sku = ? AND id <> ?", sku, exceptID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVariantSKUExists
+	}
+	return nil
+}
+
+// normalizeVariant validates a variant and canonicalizes its SKU, size and crust
+func normalizeVariant(variant *models.PizzaVariant) error {
+	variant.SKU = strings.ToUpper(strings.TrimSpace(variant.SKU))
+	if !skuPattern.MatchString(variant.SKU) {
+		return &ValidationError{Field: "sku", Message: "must be 1-64 letters, digits, '-' or '_'"}
+	}
+
+	variant.Size = strings.ToLower(strings.TrimSpace(variant.Size))
+	switch variant.Size {
+	case models.SizeSmall, models.SizeMedium, models.SizeLarge:
+	default:
+		return &ValidationError{Field: "size", Message: fmt.Sprintf("must be one of %s, %s, %s",
+			models.SizeSmall, models.SizeMedium, models.SizeLarge)}
+	}
+
+	variant.Crust = strings.ToLower(strings.Join(strings.Fields(variant.Crust), " "))
+
+	return normalizeMoney(&variant.Price)
+}
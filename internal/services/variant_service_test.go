@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/franciscosanchezn/gin-pizza-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPizzaVariantLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	pizzaService := NewPizzaService(db)
+	variantService := NewPizzaVariantService(db)
+
+	pizza, err := pizzaService.CreatePizza(models.Pizza{Name: "Margherita", Price: usd(1099), CreatedBy: 1})
+	require.NoError(t, err)
+	assert.Empty(t, pizza.Variants)
+
+	large, err := variantService.CreateVariant(models.PizzaVariant{
+		PizzaID: pizza.ID, SKU: " marg-l-thin ", Size: "Large", Crust: "Thin", Price: usd(1499), Available: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "MARG-L-THIN", large.SKU)
+	assert.Equal(t, models.SizeLarge, large.Size)
+	assert.Equal(t, "thin", large.Crust)
+
+	_, err = variantService.CreateVariant(models.PizzaVariant{PizzaID: pizza.ID, SKU: "MARG-L-THIN", Size: "small", Price: usd(800)})
+	assert.ErrorIs(t, err, ErrVariantSKUExists)
+
+	// Variants are embedded when the pizza is read
+	reloaded, err := pizzaService.GetPizzaByID(pizza.ID)
+	require.NoError(t, err)
+	require.Len(t, reloaded.Variants, 1)
+	assert.Equal(t, large.ID, reloaded.Variants[0].ID)
+
+	// Updating the pizza itself must not touch its variants
+	reloaded.Name = "Margherita Classica"
+	_, err = pizzaService.UpdatePizza(reloaded, 0)
+	require.NoError(t, err)
+
+	large.Available = false
+	updated, err := variantService.UpdateVariant(large)
+	require.NoError(t, err)
+	assert.False(t, updated.Available)
+
+	variants, err := variantService.GetVariants(pizza.ID)
+	require.NoError(t, err)
+	require.Len(t, variants, 1)
+	assert.False(t, variants[0].Available)
+
+	// A variant is only reachable through its own pizza
+	_, err = variantService.GetVariant(pizza.ID+1, large.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, variantService.DeleteVariant(pizza.ID+1, large.ID), gorm.ErrRecordNotFound)
+
+	require.NoError(t, variantService.DeleteVariant(pizza.ID, large.ID))
+	variants, err = variantService.GetVariants(pizza.ID)
+	require.NoError(t, err)
+	assert.Empty(t, variants)
+}
+
+func TestPizzaVariantValidation(t *testing.T) {
+	variantService := NewPizzaVariantService(setupTestDB(t))
+
+	testCases := []struct {
+		name    string
+		variant models.PizzaVariant
+		field   string
+	}{
+		{name: "missing sku", variant: models.PizzaVariant{Size: "small"}, field: "sku"},
+		{name: "sku with spaces", variant: models.PizzaVariant{SKU: "MARG L", Size: "small"}, field: "sku"},
+		{name: "unknown size", variant: models.PizzaVariant{SKU: "MARG-XL", Size: "family"}, field: "size"},
+		{name: "negative price", variant: models.PizzaVariant{SKU: "MARG-S", Size: "small", Price: usd(-1)}, field: "price"},
+		{name: "unknown currency", variant: models.PizzaVariant{SKU: "MARG-S", Size: "small", Price: models.Money{Amount: 800, Currency: "XYZ"}}, field: "currency"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.variant.PizzaID = 1
+			_, err := variantService.CreateVariant(tt.variant)
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+}
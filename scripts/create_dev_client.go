@@ -48,13 +48,15 @@ func main() {
 	}
 
 	// Determine client credentials based on role
-	var clientID, clientSecret string
+	var clientID, clientSecret, scopes string
 	if *role == "user" {
 		clientID = "user-client"
 		clientSecret = "user-secret-123"
+		scopes = "read pizzas:write orders:write"
 	} else {
 		clientID = "dev-client"
 		clientSecret = "dev-secret-123"
+		scopes = "read pizzas:write orders:write ingredients:write clients:admin keys:admin"
 	}
 
 	// Check if client already exists
@@ -84,8 +86,8 @@ func main() {
 		Name:        fmt.Sprintf("Development %s Client", *role),
 		Domain:      "http://localhost",
 		UserID:      userID,
-		Scopes:      "read write",
-		GrantTypes:  "client_credentials",
+		Scopes:      scopes,
+		GrantTypes:  "client_credentials refresh_token",
 		RedirectURI: "",
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
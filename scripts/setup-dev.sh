@@ -190,7 +190,7 @@ func main() {
 		ID:        clientID,
 		Secret:    string(hash),
 		Name:      "Development Client",
-		Scopes:    "read write",
+		Scopes:    "read pizzas:write orders:write ingredients:write clients:admin keys:admin",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}